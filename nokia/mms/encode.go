@@ -0,0 +1,354 @@
+package mms
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Encode writes mms as a binary PDU. Message type, transaction ID
+// and version come first, and Content-Type and the body last, as
+// required by WAP-209. Version defaults to 1.0.
+//
+// If ContentType is empty and the message has parts, the body is
+// application/vnd.wap.multipart.related if a part is a SMIL
+// presentation, and application/vnd.wap.multipart.mixed otherwise.
+func Encode(w io.Writer, mms MMS) error {
+	if mms.Type < 0x80 || mms.Type > 0xff {
+		return fmt.Errorf("invalid message type 0x%x", mms.Type)
+	}
+	buf := new(bytes.Buffer)
+	for _, h := range mms.headers() {
+		buf.WriteByte(0x80 | byte(h.id))
+		writeHeader(buf, headerTypes[h.id], h.value)
+	}
+	ct := mms.ContentType
+	if ct.Type == "" && len(mms.Parts) > 0 {
+		ct = defaultContentType(mms.Parts)
+	}
+	if ct.Type != "" {
+		buf.WriteByte(0x80 | HdrContentType)
+		writeContentType(buf, ct)
+		if ct.IsMultipart() {
+			writeMultipart(buf, mms.Parts)
+		} else if len(mms.Parts) > 1 {
+			return fmt.Errorf("%d parts for content type %s", len(mms.Parts), ct.Type)
+		} else if len(mms.Parts) == 1 {
+			buf.Write(mms.Parts[0].Data)
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type header struct {
+	id    int
+	value interface{}
+}
+
+// headers lists the headers of mms, except Content-Type, in
+// encoding order. Values have the types returned by readHeader.
+func (mms *MMS) headers() []header {
+	version := mms.Version
+	if version == 0 {
+		version = 0x10
+	}
+	hs := []header{{HdrMessageType, mms.Type}}
+	if mms.TransactionID != "" {
+		hs = append(hs, header{HdrTransactionID, mms.TransactionID})
+	}
+	hs = append(hs, header{HdrMMSVersion, version})
+	add := func(id int, ok bool, value interface{}) {
+		if ok {
+			hs = append(hs, header{id, value})
+		}
+	}
+	add(HdrMessageID, mms.MessageID != "", mms.MessageID)
+	add(HdrDate, !mms.Date.IsZero(), mms.Date)
+	add(HdrFrom, mms.From != "" || mms.Type == MSendReq, addAddressType(mms.From))
+	for _, addr := range mms.To {
+		add(HdrTo, true, addAddressType(addr))
+	}
+	for _, addr := range mms.CC {
+		add(HdrCC, true, addAddressType(addr))
+	}
+	for _, addr := range mms.BCC {
+		add(HdrBCC, true, addAddressType(addr))
+	}
+	add(HdrSubject, mms.Subject != "", mms.Subject)
+	add(HdrMessageClass, mms.MessageClass != "", mms.MessageClass)
+	add(HdrPriority, mms.Priority != 0, mms.Priority)
+	add(HdrDeliveryReport, mms.DeliveryReport, true)
+	add(HdrReadReply, mms.ReadReply, true)
+	add(HdrReportAllowed, mms.ReportAllowed, true)
+	add(HdrSenderVisibility, mms.HideSender, true)
+	add(HdrDeliveryTime, !mms.DeliveryTime.IsZero(), mms.DeliveryTime)
+	add(HdrExpiry, !mms.Expiry.IsZero(), mms.Expiry)
+	add(HdrMessageSize, mms.MessageSize != 0, mms.MessageSize)
+	add(HdrContentLocation, mms.ContentLocation != "", mms.ContentLocation)
+	add(HdrResponseStatus, mms.ResponseStatus != 0, mms.ResponseStatus)
+	add(HdrResponseText, mms.ResponseText != "", mms.ResponseText)
+	add(HdrStatus, mms.Status != 0, mms.Status)
+	return hs
+}
+
+// addAddressType adds the /TYPE=PLMN suffix to phone numbers.
+func addAddressType(addr string) string {
+	if addr == "" || strings.Contains(addr, "@") || strings.Contains(addr, "/TYPE=") {
+		return addr
+	}
+	return addr + "/TYPE=PLMN"
+}
+
+func defaultContentType(parts []Part) ContentType {
+	for _, p := range parts {
+		if p.ContentType.Type == "application/smil" {
+			ct := ContentType{
+				Type:   "application/vnd.wap.multipart.related",
+				Params: map[string]string{"type": "application/smil"},
+			}
+			if p.ContentID != "" {
+				ct.Params["start"] = p.ContentID
+			}
+			return ct
+		}
+	}
+	return ContentType{Type: "application/vnd.wap.multipart.mixed"}
+}
+
+// writeHeader writes a header value (see readHeader).
+func writeHeader(buf *bytes.Buffer, typ int, value interface{}) {
+	switch typ {
+	case hdrEncodedString:
+		writeEncodedString(buf, value.(string))
+	case hdrBool:
+		if value.(bool) {
+			buf.WriteByte(0x80)
+		} else {
+			buf.WriteByte(0x81)
+		}
+	case hdrEnum:
+		buf.WriteByte(byte(value.(int)))
+	case hdrShortInt:
+		buf.WriteByte(0x80 | byte(value.(int)))
+	case hdrLongInt:
+		writeLongInteger(buf, uint64(value.(int64)))
+	case hdrUnixTime:
+		writeLongInteger(buf, uint64(value.(time.Time).Unix()))
+	case hdrTime:
+		t := value.(Time)
+		v := new(bytes.Buffer)
+		if t.Date.IsZero() {
+			v.WriteByte(0x81) // relative
+			writeLongInteger(v, uint64(t.Delay/time.Second))
+		} else {
+			v.WriteByte(0x80) // absolute
+			writeLongInteger(v, uint64(t.Date.Unix()))
+		}
+		writeValue(buf, v.Bytes())
+	case hdrAddress:
+		v := new(bytes.Buffer)
+		if addr := value.(string); addr == "" {
+			v.WriteByte(0x81) // insert address
+		} else {
+			v.WriteByte(0x80) // address present
+			writeEncodedString(v, addr)
+		}
+		writeValue(buf, v.Bytes())
+	case hdrMessageClass:
+		class := value.(string)
+		for i, name := range messageClasses {
+			if strings.EqualFold(class, name) {
+				buf.WriteByte(0x80 | byte(i))
+				return
+			}
+		}
+		writeText(buf, class)
+	default:
+		panic("invalid header type")
+	}
+}
+
+func writeUintvar(buf *bytes.Buffer, n uint64) {
+	var b [10]byte
+	i := len(b) - 1
+	b[i] = byte(n & 0x7f)
+	for n >>= 7; n > 0; n >>= 7 {
+		i--
+		b[i] = 0x80 | byte(n&0x7f)
+	}
+	buf.Write(b[i:])
+}
+
+// writeValue writes a Value-length followed by data.
+func writeValue(buf *bytes.Buffer, data []byte) {
+	if len(data) <= 30 {
+		buf.WriteByte(byte(len(data)))
+	} else {
+		buf.WriteByte(31)
+		writeUintvar(buf, uint64(len(data)))
+	}
+	buf.Write(data)
+}
+
+// writeText writes a Text-string, quoting it if its first
+// character would otherwise be taken for a quote.
+func writeText(buf *bytes.Buffer, s string) {
+	if s != "" && (s[0] >= 0x7f || s[0] == '"') {
+		buf.WriteByte(0x7f)
+	}
+	buf.WriteString(s)
+	buf.WriteByte(0)
+}
+
+// writeEncodedString writes s as a Text-string if it is ASCII,
+// and as UTF-8 text with a charset otherwise. Strings that are
+// empty or start with a control character are also written with
+// a charset since a Text-string cannot start with them.
+func writeEncodedString(buf *bytes.Buffer, s string) {
+	plain := s != "" && s[0] >= 32
+	for i := 0; plain && i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			plain = false
+		}
+	}
+	if plain {
+		writeText(buf, s)
+		return
+	}
+	v := new(bytes.Buffer)
+	writeInteger(v, 106) // utf-8
+	writeText(v, s)
+	writeValue(buf, v.Bytes())
+}
+
+func writeLongInteger(buf *bytes.Buffer, n uint64) {
+	var b [8]byte
+	i := len(b) - 1
+	b[i] = byte(n)
+	for n >>= 8; n > 0; n >>= 8 {
+		i--
+		b[i] = byte(n)
+	}
+	buf.WriteByte(byte(len(b) - i))
+	buf.Write(b[i:])
+}
+
+// writeInteger writes an Integer-value.
+func writeInteger(buf *bytes.Buffer, n uint64) {
+	if n < 0x80 {
+		buf.WriteByte(0x80 | byte(n))
+	} else {
+		writeLongInteger(buf, n)
+	}
+}
+
+// writeMediaType writes a well-known media type as an integer,
+// and other media types as text.
+func writeMediaType(buf *bytes.Buffer, typ string) {
+	for i, name := range contentTypes {
+		if strings.EqualFold(typ, name) {
+			writeInteger(buf, uint64(i))
+			return
+		}
+	}
+	writeText(buf, typ)
+}
+
+// writeContentType writes a Content-type-value (see readContentType).
+func writeContentType(buf *bytes.Buffer, ct ContentType) {
+	if len(ct.Params) == 0 {
+		writeMediaType(buf, ct.Type)
+		return
+	}
+	v := new(bytes.Buffer)
+	writeMediaType(v, ct.Type)
+	keys := make([]string, 0, len(ct.Params))
+	for k := range ct.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeParam(v, k, ct.Params[k])
+	}
+	writeValue(buf, v.Bytes())
+}
+
+var paramIDs = map[string]int{
+	"name":       paramName,
+	"filename":   paramFilename,
+	"start":      paramStart,
+	"start-info": paramStartInfo,
+	"comment":    paramComment,
+	"domain":     paramDomain,
+	"path":       paramPath,
+}
+
+// writeParam writes a parameter (see readParam).
+func writeParam(buf *bytes.Buffer, key, value string) {
+	key = strings.ToLower(key)
+	switch key {
+	case "charset":
+		if value == "*" {
+			writeInteger(buf, paramCharset)
+			buf.WriteByte(0x80)
+			return
+		}
+		for mib, name := range charsets {
+			if strings.EqualFold(value, name) {
+				writeInteger(buf, paramCharset)
+				writeInteger(buf, mib)
+				return
+			}
+		}
+	case "type":
+		writeInteger(buf, paramRelType)
+		writeMediaType(buf, value)
+		return
+	}
+	if id, ok := paramIDs[key]; ok {
+		writeInteger(buf, uint64(id))
+	} else {
+		writeText(buf, key)
+	}
+	if value == "" {
+		buf.WriteByte(0) // No-value.
+	} else {
+		writeText(buf, value)
+	}
+}
+
+// writeMultipart writes a multipart body (see readMultipart).
+func writeMultipart(buf *bytes.Buffer, parts []Part) {
+	writeUintvar(buf, uint64(len(parts)))
+	for _, p := range parts {
+		h := new(bytes.Buffer)
+		writeContentType(h, p.ContentType)
+		if p.ContentID != "" {
+			h.WriteByte(0x80 | fieldContentID)
+			h.WriteString(`"` + p.ContentID + "\x00")
+		}
+		if p.ContentLocation != "" {
+			h.WriteByte(0x80 | fieldContentLocation)
+			writeText(h, p.ContentLocation)
+		}
+		names := make([]string, 0, len(p.Header))
+		for name := range p.Header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			// application header.
+			writeText(h, name)
+			writeText(h, p.Header[name])
+		}
+		writeUintvar(buf, uint64(h.Len()))
+		writeUintvar(buf, uint64(len(p.Data)))
+		buf.Write(h.Bytes())
+		buf.Write(p.Data)
+	}
+}
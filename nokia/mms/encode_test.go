@@ -0,0 +1,87 @@
+package mms
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	m, err := ReadMMS(bytes.NewBuffer(retrieveConf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.CC = []string{"bob@example.com"}
+	m.Expiry = Time{Delay: 7 * 24 * time.Hour}
+	m.DeliveryTime = Time{Date: time.Unix(0x51001000, 0)}
+	m.ReadReply = true
+	m.MessageSize = 1234
+	m.Parts[1].Header = map[string]string{"Content-Disposition": "attachment"}
+	var buf bytes.Buffer
+	if err := Encode(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := ReadMMS(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Errorf("got %+v\nexpected %+v", m2, m)
+	}
+
+	// Values that a bare Text-string cannot represent.
+	for _, subject := range []string{"\"quoted\"", "\x7fdel", "\x01ctl", "\tTab", "\"é"} {
+		m.Subject = subject
+		m.From = subject
+		buf.Reset()
+		if err := Encode(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+		m2, err := ReadMMS(&buf)
+		if err != nil {
+			t.Errorf("%q: %s", subject, err)
+			continue
+		}
+		if m2.Subject != subject || m2.From != subject {
+			t.Errorf("got subject %q, from %q, expected %q", m2.Subject, m2.From, subject)
+		}
+	}
+}
+
+func TestEncodeSendReq(t *testing.T) {
+	m := MMS{
+		Type:          MSendReq,
+		TransactionID: "42",
+		To:            []string{"+33612345678"},
+		Subject:       "Photo",
+		Parts: []Part{
+			{ContentType: ContentType{Type: "application/smil"}, ContentID: "<smil>", Data: []byte("<smil/>")},
+			{ContentType: ContentType{Type: "image/jpeg"}, ContentLocation: "photo.jpg", Data: []byte("JFIF")},
+		},
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	header := "\x8c\x80\x98" + "42\x00" + "\x8d\x90" + "\x89\x01\x81" +
+		"\x97+33612345678/TYPE=PLMN\x00"
+	if !bytes.HasPrefix(buf.Bytes(), []byte(header)) {
+		t.Errorf("got %q", buf.Bytes())
+	}
+	m2, err := ReadMMS(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := ContentType{
+		Type:   "application/vnd.wap.multipart.related",
+		Params: map[string]string{"type": "application/smil", "start": "<smil>"},
+	}
+	if !reflect.DeepEqual(m2.ContentType, ct) || m2.Version != 0x10 {
+		t.Errorf("got content type %+v, version %x", m2.ContentType, m2.Version)
+	}
+	m2.ContentType, m2.Version = ContentType{}, 0
+	if !reflect.DeepEqual(m, m2) {
+		t.Errorf("got %+v\nexpected %+v", m2, m)
+	}
+}
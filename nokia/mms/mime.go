@@ -0,0 +1,191 @@
+package mms
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ToMIME writes mms as a RFC 822 e-mail message. Multipart bodies
+// become multipart/related or multipart/mixed messages, text parts
+// are converted to UTF-8 when their charset is supported and keep
+// their charset otherwise.
+func (mms *MMS) ToMIME(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	header := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(bw, "%s: %s\r\n", key, headerValue(value))
+		}
+	}
+	header("From", mailAddress(mms.From))
+	header("To", formatAddresses(mms.To))
+	header("Cc", formatAddresses(mms.CC))
+	if !mms.Date.IsZero() {
+		header("Date", mms.Date.Format(time.RFC1123Z))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", mms.Subject))
+	if mms.MessageID != "" {
+		header("Message-ID", angleAddr(mms.MessageID))
+	}
+	header("MIME-Version", "1.0")
+
+	var err error
+	switch {
+	case mms.ContentType.IsMultipart():
+		mw := multipart.NewWriter(bw)
+		params := map[string]string{"boundary": mw.Boundary()}
+		typ := "multipart/mixed"
+		switch mms.ContentType.Type {
+		case "application/vnd.wap.multipart.related", "multipart/related":
+			typ = "multipart/related"
+			if t := mms.ContentType.Params["type"]; t != "" {
+				params["type"] = t
+			}
+			if start := mms.ContentType.Params["start"]; start != "" {
+				params["start"] = angleAddr(start)
+			}
+		case "application/vnd.wap.multipart.alternative", "multipart/alternative":
+			typ = "multipart/alternative"
+		}
+		header("Content-Type", mime.FormatMediaType(typ, params))
+		bw.WriteString("\r\n")
+		for _, p := range mms.Parts {
+			pw, err := mw.CreatePart(p.mimeHeader())
+			if err != nil {
+				return err
+			}
+			if err = p.writeMIMEBody(pw); err != nil {
+				return err
+			}
+		}
+		err = mw.Close()
+	case len(mms.Parts) == 1:
+		p := mms.Parts[0]
+		h := p.mimeHeader()
+		keys := make([]string, 0, len(h))
+		for key := range h {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			header(key, h.Get(key))
+		}
+		bw.WriteString("\r\n")
+		err = p.writeMIMEBody(bw)
+	default:
+		bw.WriteString("\r\n")
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func formatAddresses(addrs []string) string {
+	s := make([]string, len(addrs))
+	for i, addr := range addrs {
+		s[i] = mailAddress(addr)
+	}
+	return strings.Join(s, ", ")
+}
+
+// mailAddress formats a MMS address as a RFC 5322 address. Phone
+// numbers are used as display names of an address in the reserved
+// .invalid domain, e.g. "+33612345678" <+33612345678@mms.invalid>.
+func mailAddress(addr string) string {
+	addr = headerValue(stripAddressType(addr))
+	if addr == "" {
+		return ""
+	}
+	if a, err := mail.ParseAddress(addr); err == nil {
+		return a.String()
+	}
+	a := mail.Address{Name: addr, Address: addr + "@mms.invalid"}
+	return a.String()
+}
+
+var headerReplacer = strings.NewReplacer("\r", "", "\n", "")
+
+// headerValue removes line breaks from s, which would otherwise
+// end the header field.
+func headerValue(s string) string {
+	return headerReplacer.Replace(s)
+}
+
+// angleAddr encloses id in angle brackets if needed.
+func angleAddr(id string) string {
+	if strings.HasPrefix(id, "<") && strings.HasSuffix(id, ">") {
+		return id
+	}
+	return "<" + id + ">"
+}
+
+// isText reports whether p is sent as quoted-printable text.
+func (p *Part) isText() bool {
+	return strings.HasPrefix(p.ContentType.Type, "text/") ||
+		p.ContentType.Type == "application/smil"
+}
+
+func (p *Part) mimeHeader() textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	ct := p.ContentType
+	if p.isText() {
+		if decodesCharset(ct.Params["charset"]) {
+			params := map[string]string{"charset": "utf-8"}
+			for k, v := range ct.Params {
+				if k != "charset" {
+					params[k] = v
+				}
+			}
+			ct.Params = params
+		}
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+	} else {
+		h.Set("Content-Transfer-Encoding", "base64")
+	}
+	h.Set("Content-Type", ct.String())
+	if p.ContentID != "" {
+		h.Set("Content-ID", angleAddr(p.ContentID))
+	}
+	if p.ContentLocation != "" {
+		h.Set("Content-Location", p.ContentLocation)
+	}
+	for k, v := range p.Header {
+		h.Set(headerValue(k), v)
+	}
+	for _, values := range h {
+		for i, v := range values {
+			values[i] = headerValue(v)
+		}
+	}
+	return h
+}
+
+func (p *Part) writeMIMEBody(w io.Writer) error {
+	if p.isText() {
+		qw := quotedprintable.NewWriter(w)
+		if _, err := io.WriteString(qw, p.Text()); err != nil {
+			return err
+		}
+		return qw.Close()
+	}
+	// base64, in lines of 76 characters.
+	s := base64.StdEncoding.EncodeToString(p.Data)
+	for len(s) > 76 {
+		if _, err := io.WriteString(w, s[:76]+"\r\n"); err != nil {
+			return err
+		}
+		s = s[76:]
+	}
+	_, err := io.WriteString(w, s+"\r\n")
+	return err
+}
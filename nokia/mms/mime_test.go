@@ -0,0 +1,116 @@
+package mms
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"testing"
+)
+
+func TestToMIME(t *testing.T) {
+	m, err := ReadMMS(bytes.NewBuffer(retrieveConf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := m.ToMIME(&buf); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := new(mime.WordDecoder)
+	subject, _ := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if from := msg.Header.Get("From"); from != `"+33612345678" <+33612345678@mms.invalid>` || subject != "Café" {
+		t.Errorf("got From %q, Subject %q", from, subject)
+	}
+	if to, err := msg.Header.AddressList("To"); err != nil || len(to) != 1 || to[0].Name != "+33698765432" {
+		t.Errorf("got To %+v (%v)", to, err)
+	}
+	if date, err := msg.Header.Date(); err != nil || !date.Equal(m.Date) {
+		t.Errorf("got date %s (%v)", date, err)
+	}
+	typ, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || typ != "multipart/related" || params["start"] != "<smil>" {
+		t.Fatalf("got Content-Type %q", msg.Header.Get("Content-Type"))
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var bodies []string
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		data, _ := ioutil.ReadAll(p)
+		bodies = append(bodies, p.Header.Get("Content-Type")+" "+string(data))
+	}
+	if len(bodies) != 2 || bodies[0] != "application/smil; charset=utf-8 <smil></smil>" ||
+		bodies[1] != "text/plain; charset=utf-8 Hello" {
+		t.Errorf("got parts %q", bodies)
+	}
+}
+
+func TestMIMEHeaderCharset(t *testing.T) {
+	for _, test := range []struct {
+		charset  string
+		expected string
+	}{
+		{"", "text/plain; charset=utf-8"},
+		{"iso-8859-1", "text/plain; charset=utf-8"},
+		{"utf-16", "text/plain; charset=utf-8"},
+		// not converted: keep the original charset.
+		{"shift_jis", "text/plain; charset=shift_jis"},
+		{"big5", "text/plain; charset=big5"},
+	} {
+		p := Part{ContentType: ContentType{Type: "text/plain", Params: map[string]string{}}}
+		if test.charset != "" {
+			p.ContentType.Params["charset"] = test.charset
+		}
+		if ct := p.mimeHeader().Get("Content-Type"); ct != test.expected {
+			t.Errorf("charset %q: got Content-Type %q, expected %q", test.charset, ct, test.expected)
+		}
+	}
+}
+
+func TestToMIMEHeaderInjection(t *testing.T) {
+	m := MMS{
+		From:        "+33612345678/TYPE=PLMN\r\nBcc: evil@example.com",
+		To:          []string{"jean@example.com"},
+		Subject:     "Hi",
+		ContentType: ContentType{Type: "application/vnd.wap.multipart.mixed"},
+		Parts: []Part{{
+			ContentType:     ContentType{Type: "text/plain"},
+			ContentLocation: "hi.txt\r\nX-Injected: yes",
+			Header:          map[string]string{"X-Note": "a\r\n\r\nbody"},
+			Data:            []byte("Hello"),
+		}},
+	}
+	var buf bytes.Buffer
+	if err := m.ToMIME(&buf); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcc := msg.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("injected Bcc header %q", bcc)
+	}
+	if to, err := msg.Header.AddressList("To"); err != nil || len(to) != 1 || to[0].Address != "jean@example.com" {
+		t.Errorf("got To %+v (%v)", to, err)
+	}
+	_, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	p, err := multipart.NewReader(msg.Body, params["boundary"]).NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := p.Header.Get("X-Injected"); h != "" {
+		t.Errorf("injected part header %q", h)
+	}
+	if data, _ := ioutil.ReadAll(p); string(data) != "Hello" {
+		t.Errorf("got part body %q", data)
+	}
+}
@@ -7,6 +7,8 @@ package mms
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
 	"time"
 )
 
@@ -75,6 +77,7 @@ const (
 	hdrUnixTime
 	hdrTime // Date or relative delta
 	hdrAddress
+	hdrMessageClass
 )
 
 var headerTypes = [...]int{
@@ -87,7 +90,7 @@ var headerTypes = [...]int{
 	HdrDeliveryTime:     hdrTime,
 	HdrExpiry:           hdrTime,
 	HdrFrom:             hdrAddress,
-	HdrMessageClass:     hdrEnum,
+	HdrMessageClass:     hdrMessageClass,
 	HdrMessageID:        hdrEncodedString,
 	HdrMessageType:      hdrEnum,
 	HdrMMSVersion:       hdrShortInt,
@@ -104,93 +107,280 @@ var headerTypes = [...]int{
 	HdrTransactionID:    hdrEncodedString,
 }
 
+// Message types (X-Mms-Message-Type values).
+const (
+	MSendReq = 0x80 + iota
+	MSendConf
+	MNotificationInd
+	MNotifyRespInd
+	MRetrieveConf
+	MAcknowledgeInd
+	MDeliveryInd
+)
+
+// Priorities (X-Mms-Priority values).
+const (
+	PriorityLow = 0x80 + iota
+	PriorityNormal
+	PriorityHigh
+)
+
+var messageClasses = [...]string{"Personal", "Advertisement", "Informational", "Auto"}
+
 type ByteReader interface {
 	io.Reader
-	io.ByteReader
+	io.ByteScanner
 	ReadString(byte) (string, error)
 }
 
+// A MMS is a decoded MMS PDU. Enumerated header values
+// (Type, Priority, ResponseStatus, Status) are stored as their
+// encoded octet, e.g. MRetrieveConf or PriorityHigh.
 type MMS struct {
-	Header map[string]string
+	Type            int
+	TransactionID   string
+	Version         int // major version in bits 4-6, minor in bits 0-3.
+	MessageID       string
+	Date            time.Time
+	From            string // empty if the address is inserted by the relay.
+	To, CC, BCC     []string
+	Subject         string
+	MessageClass    string // Personal, Advertisement, Informational, Auto or a token.
+	Priority        int
+	DeliveryReport  bool
+	ReadReply       bool
+	ReportAllowed   bool
+	HideSender      bool
+	DeliveryTime    Time
+	Expiry          Time
+	MessageSize     int64
+	ContentLocation string
+	ResponseStatus  int
+	ResponseText    string
+	Status          int
+
+	ContentType ContentType
+	Parts       []Part
+}
+
+// A Time is either an absolute date or a delay (for
+// Delivery-Time and Expiry headers).
+type Time struct {
+	Date  time.Time
+	Delay time.Duration
 }
 
+// IsZero reports whether t is unset.
+func (t Time) IsZero() bool { return t.Date.IsZero() && t.Delay == 0 }
+
+// A Part is a part of a multipart MMS body.
+type Part struct {
+	ContentType     ContentType
+	ContentID       string
+	ContentLocation string
+	Header          map[string]string // other headers, as text.
+	Data            []byte
+}
+
+// Text returns the contents of p converted to UTF-8 according to
+// its charset parameter.
+func (p Part) Text() string {
+	return decodeText(p.ContentType.Params["charset"], p.Data)
+}
+
+// ReadMMS decodes a MMS PDU: headers (WAP-209, section 7) followed
+// by the message body, which is described by the Content-Type header.
 func ReadMMS(r ByteReader) (mms MMS, err error) {
-	// Read headers.
 	for {
 		b, err := r.ReadByte()
-		if b <= 0x80 || b >= byte(0x80+len(headerTypes)) {
-			return mms, fmt.Errorf("invalid header ID: %x", b)
-		}
-		key := headerNames[b-0x80]
-		var value string
-		// See WAP-230-WSP, section 8.4.2.1
-		switch typ := headerTypes[b-0x80]; typ {
-		case hdrBool, hdrEnum:
-			b, err = r.ReadByte()
-			value = fmt.Sprint(b - 0x80)
-		case hdrEncodedString:
-			value, err = r.ReadString(0)
-			value = value[:len(value)-1]
-		case hdrContentType:
-		case hdrLongInt, hdrUnixTime:
-			// big-endian, variable length.
-			b, err = r.ReadByte()
-			if b > 8 {
-				return mms, fmt.Errorf("integer too large")
-			}
-			var x [8]byte
-			_, err = io.ReadFull(r, x[:b])
-			n := uint64(0)
-			for _, c := range x[:b] {
-				n = (n << 8) | uint64(c)
-			}
-			if typ == hdrUnixTime {
-				value = time.Unix(int64(n), 0).Format(time.RFC1123Z)
-			} else {
-				value = fmt.Sprint(n)
+		if err == io.EOF {
+			// no body.
+			return mms, nil
+		}
+		if err != nil {
+			return mms, err
+		}
+		if b < 0x80 {
+			// application header: Token-text and text value.
+			r.UnreadByte()
+			_, err = readText(r)
+			if err == nil {
+				_, err = readText(r)
 			}
-		case hdrTime:
-			b, err = r.ReadByte() // length.
-			var buf [8]byte
-			_, err = io.ReadFull(r, buf[:b])
-			// buf[0] is type, buf[1] is int-length.
-			var n uint64
-			for _, c := range buf[2 : 2+buf[1]] {
-				n = (n << 8) | uint64(c)
+			if err != nil {
+				return mms, fmt.Errorf("invalid application header: %s", err)
 			}
-			switch buf[0] { // type
-			case 0x80:
-				value = time.Unix(int64(n), 0).Format(time.RFC1123Z)
-			case 0x81:
-				value = (time.Duration(n) * time.Second).String()
-			default:
-				return mms, fmt.Errorf("invalid type for address: 0x%x", b)
+			continue
+		}
+		id := int(b & 0x7f)
+		if id == 0 || id >= len(headerTypes) {
+			// extension header.
+			if _, err = readGenericValue(r); err != nil {
+				return mms, fmt.Errorf("invalid header 0x%x: %s", b, err)
 			}
-		case hdrAddress:
-			b, err = r.ReadByte() // length
-			s := make([]byte, b)
-			_, err = io.ReadFull(r, s)
-			switch s[0] { // type
-			case 0x80:
-				value = string(s[1:])
-			case 0x81:
-				// FIXME.
-				value = string(s[1:])
-			default:
-				return mms, fmt.Errorf("invalid type for address: 0x%x", s[0])
+			continue
+		}
+		if id == HdrContentType {
+			// Content-Type is the last header.
+			if mms.ContentType, err = readContentType(r); err != nil {
+				return mms, fmt.Errorf("invalid Content-Type: %s", err)
 			}
+			mms.Parts, err = readBody(r, mms.ContentType)
+			return mms, err
+		}
+		value, err := readHeader(r, headerTypes[id])
+		if err != nil {
+			return mms, fmt.Errorf("invalid %s header: %s", headerNames[id], err)
+		}
+		mms.set(id, value)
+	}
+}
+
+func readBody(r ByteReader, ct ContentType) ([]Part, error) {
+	if ct.IsMultipart() {
+		return readMultipart(r)
+	}
+	data, err := ioutil.ReadAll(r)
+	if len(data) == 0 {
+		return nil, err
+	}
+	return []Part{{ContentType: ct, Data: data}}, err
+}
+
+// readHeader reads a header value according to its type
+// (see WAP-209, section 7.2). The value is a string, bool, int,
+// int64, time.Time or Time.
+func readHeader(r ByteReader, typ int) (interface{}, error) {
+	switch typ {
+	case hdrEncodedString:
+		return readEncodedString(r)
+	case hdrBool, hdrEnum, hdrShortInt:
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		if b < 0x80 {
+			return nil, fmt.Errorf("invalid value 0x%x", b)
+		}
+		switch typ {
+		case hdrBool:
+			return b == 0x80, nil
 		case hdrShortInt:
-			// single byte.
-			b, err = r.ReadByte()
-			value = fmt.Sprint(b - 0x80)
+			return int(b & 0x7f), nil
 		}
-		if mms.Header == nil {
-			mms.Header = make(map[string]string)
+		return int(b), nil
+	case hdrLongInt:
+		n, err := readLongInteger(r)
+		return int64(n), err
+	case hdrUnixTime:
+		n, err := readLongInteger(r)
+		return time.Unix(int64(n), 0), err
+	case hdrTime:
+		v, err := readValue(r)
+		if err != nil {
+			return nil, err
 		}
-		print(key, ": ", value, "\n")
-		mms.Header[key] = value
+		var t Time
+		token, err := v.ReadByte()
 		if err != nil {
-			return mms, err
+			return nil, unexpected(err)
+		}
+		n, err := readInteger(v)
+		switch token {
+		case 0x80: // absolute
+			t.Date = time.Unix(int64(n), 0)
+		case 0x81: // relative
+			t.Delay = time.Duration(n) * time.Second
+		default:
+			return nil, fmt.Errorf("invalid time type 0x%x", token)
 		}
+		return t, err
+	case hdrAddress:
+		v, err := readValue(r)
+		if err != nil {
+			return nil, err
+		}
+		switch token, _ := v.ReadByte(); token {
+		case 0x80: // address present
+			return readEncodedString(v)
+		case 0x81: // insert address
+			return "", nil
+		default:
+			return nil, fmt.Errorf("invalid address type 0x%x", token)
+		}
+	case hdrMessageClass:
+		b, err := peekByte(r)
+		if err != nil {
+			return nil, err
+		}
+		if b < 0x80 {
+			return readText(r)
+		}
+		r.ReadByte()
+		if int(b-0x80) < len(messageClasses) {
+			return messageClasses[b-0x80], nil
+		}
+		return fmt.Sprintf("0x%x", b), nil
+	}
+	panic("invalid header type")
+}
+
+func (mms *MMS) set(id int, value interface{}) {
+	switch id {
+	case HdrBCC:
+		mms.BCC = append(mms.BCC, stripAddressType(value.(string)))
+	case HdrCC:
+		mms.CC = append(mms.CC, stripAddressType(value.(string)))
+	case HdrTo:
+		mms.To = append(mms.To, stripAddressType(value.(string)))
+	case HdrFrom:
+		mms.From = stripAddressType(value.(string))
+	case HdrContentLocation:
+		mms.ContentLocation = value.(string)
+	case HdrDate:
+		mms.Date = value.(time.Time)
+	case HdrDeliveryReport:
+		mms.DeliveryReport = value.(bool)
+	case HdrDeliveryTime:
+		mms.DeliveryTime = value.(Time)
+	case HdrExpiry:
+		mms.Expiry = value.(Time)
+	case HdrMessageClass:
+		mms.MessageClass = value.(string)
+	case HdrMessageID:
+		mms.MessageID = value.(string)
+	case HdrMessageType:
+		mms.Type = value.(int)
+	case HdrMMSVersion:
+		mms.Version = value.(int)
+	case HdrMessageSize:
+		mms.MessageSize = value.(int64)
+	case HdrPriority:
+		mms.Priority = value.(int)
+	case HdrReadReply:
+		mms.ReadReply = value.(bool)
+	case HdrReportAllowed:
+		mms.ReportAllowed = value.(bool)
+	case HdrResponseStatus:
+		mms.ResponseStatus = value.(int)
+	case HdrResponseText:
+		mms.ResponseText = value.(string)
+	case HdrSenderVisibility:
+		mms.HideSender = value.(bool)
+	case HdrStatus:
+		mms.Status = value.(int)
+	case HdrSubject:
+		mms.Subject = value.(string)
+	case HdrTransactionID:
+		mms.TransactionID = value.(string)
+	}
+}
+
+// stripAddressType removes the type suffix of addresses
+// such as +33612345678/TYPE=PLMN.
+func stripAddressType(addr string) string {
+	if i := strings.LastIndex(addr, "/TYPE="); i >= 0 {
+		return addr[:i]
 	}
+	return addr
 }
@@ -0,0 +1,92 @@
+package mms
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// retrieveConf is a M-Retrieve.conf PDU with a SMIL and a text part.
+var retrieveConf = []byte("" +
+	"\x8c\x84" + // X-Mms-Message-Type: m-retrieve-conf
+	"\x98T1\x00" + // X-Mms-Transaction-Id: T1
+	"\x8d\x90" + // X-Mms-MMS-Version: 1.0
+	"\x8bmsg1\x00" + // Message-ID: msg1
+	"\x85\x04\x51\x00\x00\x00" + // Date
+	"\x89\x18\x80+33612345678/TYPE=PLMN\x00" + // From
+	"\x97+33698765432/TYPE=PLMN\x00" + // To
+	"\x96\x07\xeaCaf\xc3\xa9\x00" + // Subject (utf-8)
+	"\x8f\x81" + // X-Mms-Priority: Normal
+	"\x8a\x80" + // X-Mms-Message-Class: Personal
+	"\xa0\x80" + // unknown header
+	// Content-Type: application/vnd.wap.multipart.related;
+	// type=application/smil; start=<smil>
+	"\x84\x1b\xb3\x89application/smil\x00\x8a<smil>\x00" +
+	"\x02" + // 2 parts
+	"\x1a\x0d" + "application/smil\x00\xc0\"<smil>\x00" + "<smil></smil>" +
+	"\x0e\x05" + "\x03\x83\x81\xea\x8etext.txt\x00" + "Hello")
+
+func TestReadMMS(t *testing.T) {
+	m, err := ReadMMS(bytes.NewBuffer(retrieveConf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := MMS{
+		Type:          MRetrieveConf,
+		TransactionID: "T1",
+		Version:       0x10,
+		MessageID:     "msg1",
+		Date:          time.Unix(0x51000000, 0),
+		From:          "+33612345678",
+		To:            []string{"+33698765432"},
+		Subject:       "Café",
+		Priority:      PriorityNormal,
+		MessageClass:  "Personal",
+		ContentType: ContentType{
+			Type:   "application/vnd.wap.multipart.related",
+			Params: map[string]string{"type": "application/smil", "start": "<smil>"},
+		},
+		Parts: []Part{
+			{
+				ContentType: ContentType{Type: "application/smil"},
+				ContentID:   "<smil>",
+				Data:        []byte("<smil></smil>"),
+			},
+			{
+				ContentType:     ContentType{Type: "text/plain", Params: map[string]string{"charset": "utf-8"}},
+				ContentLocation: "text.txt",
+				Data:            []byte("Hello"),
+			},
+		},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("got %+v\nexpected %+v", m, expected)
+	}
+
+	// PDUs truncated after the Content-Type header must fail.
+	body := bytes.Index(retrieveConf, []byte("\x84\x1b"))
+	for i := body + 1; i < len(retrieveConf); i++ {
+		_, err := ReadMMS(bytes.NewBuffer(retrieveConf[:i]))
+		if err == nil {
+			t.Errorf("no error for PDU truncated at %d", i)
+		}
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	for _, test := range []struct {
+		charset string
+		data    string
+		text    string
+	}{
+		{"utf-8", "caf\xc3\xa9", "café"},
+		{"iso-8859-1", "caf\xe9", "café"},
+		{"iso-10646-ucs-2", "\x00c\x00a\x00f\x00\xe9", "café"},
+		{"utf-16", "\xff\xfec\x00a\x00f\x00\xe9\x00", "café"},
+	} {
+		if s := decodeText(test.charset, []byte(test.data)); s != test.text {
+			t.Errorf("%s: got %q, expected %q", test.charset, s, test.text)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package mms
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MMS presentations are described by a SMIL document (see the
+// MMS Conformance Document, section 8):
+//
+//	<smil>
+//	  <head><layout>...</layout></head>
+//	  <body>
+//	    <par dur="5000ms">
+//	      <img src="cid:image1" region="Image"/>
+//	      <text src="text1.txt" region="Text"/>
+//	    </par>
+//	  </body>
+//	</smil>
+//
+// Each par element is a slide.
+
+// A Slide is a page of a SMIL presentation.
+type Slide struct {
+	Duration time.Duration // zero if unspecified.
+	Media    []Media
+}
+
+// A Media is a reference to a part of the message.
+type Media struct {
+	Kind   string // img, text, audio, video or ref.
+	Src    string
+	Region string
+	Alt    string
+	Begin  time.Duration
+	End    time.Duration
+}
+
+type smilDoc struct {
+	Body struct {
+		Pars []smilPar `xml:"par"`
+	} `xml:"body"`
+}
+
+type smilPar struct {
+	Dur   string      `xml:"dur,attr"`
+	Media []smilMedia `xml:",any"`
+}
+
+type smilMedia struct {
+	XMLName xml.Name
+	Src     string `xml:"src,attr"`
+	Region  string `xml:"region,attr"`
+	Alt     string `xml:"alt,attr"`
+	Begin   string `xml:"begin,attr"`
+	End     string `xml:"end,attr"`
+}
+
+// ParseSMIL parses the slides of a SMIL presentation.
+func ParseSMIL(data []byte) ([]Slide, error) {
+	var doc smilDoc
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	slides := make([]Slide, 0, len(doc.Body.Pars))
+	for i, par := range doc.Body.Pars {
+		var s Slide
+		var err error
+		if s.Duration, err = parseClock(par.Dur); err != nil {
+			return slides, fmt.Errorf("slide %d: %s", i+1, err)
+		}
+		for _, m := range par.Media {
+			media := Media{Kind: m.XMLName.Local, Src: m.Src, Region: m.Region, Alt: m.Alt}
+			if media.Begin, err = parseClock(m.Begin); err == nil {
+				media.End, err = parseClock(m.End)
+			}
+			if err != nil {
+				return slides, fmt.Errorf("slide %d: %s", i+1, err)
+			}
+			s.Media = append(s.Media, media)
+		}
+		slides = append(slides, s)
+	}
+	return slides, nil
+}
+
+// parseClock parses a SMIL clock value such as 5000ms, 5s, 1.5
+// or 00:00:05.
+func parseClock(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "indefinite" {
+		return 0, nil
+	}
+	if strings.Contains(s, ":") {
+		var d time.Duration
+		for _, f := range strings.Split(s, ":") {
+			x, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid clock value %q", s)
+			}
+			d = d*60 + time.Duration(x*float64(time.Second))
+		}
+		return d, nil
+	}
+	unit := time.Second
+	for _, u := range []struct {
+		suffix string
+		unit   time.Duration
+	}{{"ms", time.Millisecond}, {"min", time.Minute}, {"h", time.Hour}, {"s", time.Second}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSuffix(s, u.suffix), u.unit
+			break
+		}
+	}
+	x, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid clock value %q", s)
+	}
+	return time.Duration(x * float64(unit)), nil
+}
+
+// Slides returns the slides of the SMIL presentation of mms. If
+// it has none, all parts are put in a single slide.
+func (mms *MMS) Slides() ([]Slide, error) {
+	for _, p := range mms.Parts {
+		if p.ContentType.Type == "application/smil" {
+			return ParseSMIL(p.Data)
+		}
+	}
+	var s Slide
+	for _, p := range mms.Parts {
+		kind := "ref"
+		switch typ := p.ContentType.Type; {
+		case strings.HasPrefix(typ, "image/"):
+			kind = "img"
+		case strings.HasPrefix(typ, "text/"):
+			kind = "text"
+		case strings.HasPrefix(typ, "audio/"):
+			kind = "audio"
+		case strings.HasPrefix(typ, "video/"):
+			kind = "video"
+		}
+		src := p.ContentLocation
+		if src == "" {
+			src = "cid:" + strings.Trim(p.ContentID, "<>")
+		}
+		s.Media = append(s.Media, Media{Kind: kind, Src: src})
+	}
+	return []Slide{s}, nil
+}
+
+// Part returns the part referenced by src, which is either a
+// cid: URL or a content location.
+func (mms *MMS) Part(src string) *Part {
+	for i := range mms.Parts {
+		p := &mms.Parts[i]
+		if strings.HasPrefix(src, "cid:") {
+			if strings.Trim(p.ContentID, "<>") == src[len("cid:"):] {
+				return p
+			}
+		} else if p.ContentLocation == src || p.ContentType.Params["name"] == src {
+			return p
+		}
+	}
+	return nil
+}
+
+// WriteHTML renders the presentation of mms as a self-contained
+// HTML page, with media embedded as data URIs.
+func (mms *MMS) WriteHTML(w io.Writer) error {
+	slides, err := mms.Slides()
+	if err != nil {
+		return err
+	}
+	type htmlMedia struct {
+		Kind, Alt, Text string
+		URL             template.URL
+	}
+	type htmlSlide struct {
+		Duration time.Duration
+		Millis   int64
+		Media    []htmlMedia
+	}
+	page := struct {
+		MMS    *MMS
+		Slides []htmlSlide
+	}{MMS: mms}
+	for _, s := range slides {
+		hs := htmlSlide{Duration: s.Duration, Millis: int64(s.Duration / time.Millisecond)}
+		for _, m := range s.Media {
+			p := mms.Part(m.Src)
+			if p == nil {
+				continue
+			}
+			hm := htmlMedia{Kind: m.Kind, Alt: m.Alt}
+			switch m.Kind {
+			case "text":
+				hm.Text = p.Text()
+			case "img", "audio", "video":
+				hm.URL = dataURL(p.ContentType.Type, p.Data)
+			default:
+				// links are downloaded rather than displayed.
+				hm.URL = dataURL("application/octet-stream", p.Data)
+			}
+			hs.Media = append(hs.Media, hm)
+		}
+		page.Slides = append(page.Slides, hs)
+	}
+	buf := new(bytes.Buffer)
+	if err := htmlTemplate.Execute(buf, page); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func dataURL(typ string, data []byte) template.URL {
+	return template.URL("data:" + typ + ";base64," +
+		base64.StdEncoding.EncodeToString(data))
+}
+
+var htmlTemplate = template.Must(template.New("mms").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{with .MMS.Subject}}{{.}}{{else}}MMS{{end}}</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: auto; }
+.slide { border: 1px solid #ccc; margin: 1em 0; padding: 1em; }
+.slide .duration { float: right; color: #888; }
+.slide img, .slide video { max-width: 100%; display: block; }
+.slide p { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<header>
+{{with .MMS.From}}<div>From: {{.}}</div>{{end}}
+{{with .MMS.To}}<div>To: {{range $i, $to := .}}{{if $i}}, {{end}}{{$to}}{{end}}</div>{{end}}
+{{if not .MMS.Date.IsZero}}<div>Date: {{.MMS.Date.Format "2006-01-02 15:04:05"}}</div>{{end}}
+{{with .MMS.Subject}}<h1>{{.}}</h1>{{end}}
+</header>
+{{range $i, $s := .Slides}}
+<section class="slide"{{if $s.Duration}} data-duration="{{$s.Millis}}"{{end}}>
+{{if $s.Duration}}<span class="duration">{{$s.Duration}}</span>{{end}}
+{{range $s.Media}}
+{{- if eq .Kind "text"}}<p>{{.Text}}</p>
+{{else if eq .Kind "img"}}<img src="{{.URL}}" alt="{{.Alt}}">
+{{else if eq .Kind "audio"}}<audio controls src="{{.URL}}"></audio>
+{{else if eq .Kind "video"}}<video controls src="{{.URL}}"></video>
+{{else}}<a href="{{.URL}}">{{with .Alt}}{{.}}{{else}}attachment{{end}}</a>
+{{end}}
+{{- end}}
+</section>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,71 @@
+package mms
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSMIL = `<smil>
+<head><layout><root-layout/><region id="Image" top="0" left="0"/></layout></head>
+<body>
+<par dur="5000ms"><img src="cid:image1" region="Image"/><text src="text.txt" region="Text"/></par>
+<par dur="2s"><audio src="cid:sound" begin="0" end="1.5s"/></par>
+</body>
+</smil>`
+
+func TestParseSMIL(t *testing.T) {
+	slides, err := ParseSMIL([]byte(testSMIL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Slide{
+		{Duration: 5 * time.Second, Media: []Media{
+			{Kind: "img", Src: "cid:image1", Region: "Image"},
+			{Kind: "text", Src: "text.txt", Region: "Text"},
+		}},
+		{Duration: 2 * time.Second, Media: []Media{
+			{Kind: "audio", Src: "cid:sound", End: 1500 * time.Millisecond},
+		}},
+	}
+	if !reflect.DeepEqual(slides, expected) {
+		t.Errorf("got %+v\nexpected %+v", slides, expected)
+	}
+	for s, d := range map[string]time.Duration{
+		"00:01:05": 65 * time.Second,
+		"1.5":      1500 * time.Millisecond,
+		"2min":     2 * time.Minute,
+	} {
+		if got, err := parseClock(s); err != nil || got != d {
+			t.Errorf("parseClock(%q) = %s, %v", s, got, err)
+		}
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	m := MMS{
+		Subject: "Holidays",
+		Parts: []Part{
+			{ContentType: ContentType{Type: "application/smil"}, Data: []byte(testSMIL)},
+			{ContentType: ContentType{Type: "image/jpeg"}, ContentID: "<image1>", Data: []byte("JFIF")},
+			{ContentType: ContentType{Type: "text/plain"}, ContentLocation: "text.txt", Data: []byte("Hello <world>")},
+		},
+	}
+	var buf bytes.Buffer
+	if err := m.WriteHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, s := range []string{
+		`<title>Holidays</title>`,
+		`data-duration="5000"`,
+		`<img src="data:image/jpeg;base64,SkZJRg=="`,
+		`<p>Hello &lt;world&gt;</p>`,
+	} {
+		if !strings.Contains(page, s) {
+			t.Errorf("page does not contain %s:\n%s", s, page)
+		}
+	}
+}
@@ -0,0 +1,599 @@
+package mms
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// WSP encoding of values: WAP-230-WSP, section 8.4.2.
+
+// A ContentType is a media type with its parameters.
+type ContentType struct {
+	Type   string            // e.g. image/jpeg
+	Params map[string]string // e.g. charset, name, start, type
+}
+
+// String formats the content type as a MIME header value.
+func (ct ContentType) String() string {
+	if s := mime.FormatMediaType(ct.Type, ct.Params); s != "" {
+		return s
+	}
+	return ct.Type
+}
+
+// IsMultipart reports whether ct is a multipart type.
+func (ct ContentType) IsMultipart() bool {
+	return strings.HasPrefix(ct.Type, "multipart/") ||
+		strings.HasPrefix(ct.Type, "application/vnd.wap.multipart.")
+}
+
+// Well-known content types: WAP-230-WSP, table 40.
+var contentTypes = [...]string{
+	0x00: "*/*",
+	0x01: "text/*",
+	0x02: "text/html",
+	0x03: "text/plain",
+	0x04: "text/x-hdml",
+	0x05: "text/x-ttml",
+	0x06: "text/x-vCalendar",
+	0x07: "text/x-vCard",
+	0x08: "text/vnd.wap.wml",
+	0x09: "text/vnd.wap.wmlscript",
+	0x0A: "text/vnd.wap.wta-event",
+	0x0B: "multipart/*",
+	0x0C: "multipart/mixed",
+	0x0D: "multipart/form-data",
+	0x0E: "multipart/byteranges",
+	0x0F: "multipart/alternative",
+	0x10: "application/*",
+	0x11: "application/java-vm",
+	0x12: "application/x-www-form-urlencoded",
+	0x13: "application/x-hdmlc",
+	0x14: "application/vnd.wap.wmlc",
+	0x15: "application/vnd.wap.wmlscriptc",
+	0x16: "application/vnd.wap.wta-eventc",
+	0x17: "application/vnd.wap.uaprof",
+	0x18: "application/vnd.wap.wtls-ca-certificate",
+	0x19: "application/vnd.wap.wtls-user-certificate",
+	0x1A: "application/x-x509-ca-cert",
+	0x1B: "application/x-x509-user-cert",
+	0x1C: "image/*",
+	0x1D: "image/gif",
+	0x1E: "image/jpeg",
+	0x1F: "image/tiff",
+	0x20: "image/png",
+	0x21: "image/vnd.wap.wbmp",
+	0x22: "application/vnd.wap.multipart.*",
+	0x23: "application/vnd.wap.multipart.mixed",
+	0x24: "application/vnd.wap.multipart.form-data",
+	0x25: "application/vnd.wap.multipart.byteranges",
+	0x26: "application/vnd.wap.multipart.alternative",
+	0x27: "application/xml",
+	0x28: "text/xml",
+	0x29: "application/vnd.wap.wbxml",
+	0x2A: "application/x-x968-cross-cert",
+	0x2B: "application/x-x968-ca-cert",
+	0x2C: "application/x-x968-user-cert",
+	0x2D: "text/vnd.wap.si",
+	0x2E: "application/vnd.wap.sic",
+	0x2F: "text/vnd.wap.sl",
+	0x30: "application/vnd.wap.slc",
+	0x31: "text/vnd.wap.co",
+	0x32: "application/vnd.wap.coc",
+	0x33: "application/vnd.wap.multipart.related",
+	0x34: "application/vnd.wap.sia",
+	0x35: "text/vnd.wap.connectivity-xml",
+	0x36: "application/vnd.wap.connectivity-wbxml",
+	0x37: "application/pkcs7-mime",
+	0x38: "application/vnd.wap.hashed-certificate",
+	0x39: "application/vnd.wap.signed-certificate",
+	0x3A: "application/vnd.wap.cert-response",
+	0x3B: "application/xhtml+xml",
+	0x3C: "application/wml+xml",
+	0x3D: "text/css",
+	0x3E: "application/vnd.wap.mms-message",
+}
+
+// Well-known parameters: WAP-230-WSP, table 38.
+const (
+	paramQ          = 0x00
+	paramCharset    = 0x01
+	paramLevel      = 0x02
+	paramType       = 0x03
+	paramName       = 0x05
+	paramFilename   = 0x06
+	paramPadding    = 0x08
+	paramRelType    = 0x09 // type of multipart/related.
+	paramStart      = 0x0A
+	paramStartInfo  = 0x0B
+	paramComment    = 0x0C
+	paramDomain     = 0x0D
+	paramMaxAge     = 0x0E
+	paramPath       = 0x0F
+	paramSecure     = 0x10
+	paramSize       = 0x16
+	paramName2      = 0x17 // encoding version 1.4
+	paramFilename2  = 0x18
+	paramStart2     = 0x19
+	paramStartInfo2 = 0x1A
+)
+
+var paramNames = map[uint64]string{
+	paramQ:          "q",
+	paramCharset:    "charset",
+	paramLevel:      "level",
+	paramType:       "type",
+	paramName:       "name",
+	paramFilename:   "filename",
+	paramPadding:    "padding",
+	paramRelType:    "type",
+	paramStart:      "start",
+	paramStartInfo:  "start-info",
+	paramComment:    "comment",
+	paramDomain:     "domain",
+	paramMaxAge:     "max-age",
+	paramPath:       "path",
+	paramSecure:     "secure",
+	paramSize:       "size",
+	paramName2:      "name",
+	paramFilename2:  "filename",
+	paramStart2:     "start",
+	paramStartInfo2: "start-info",
+}
+
+// Character sets, identified by their IANA MIBenum.
+var charsets = map[uint64]string{
+	3:    "us-ascii",
+	4:    "iso-8859-1",
+	5:    "iso-8859-2",
+	6:    "iso-8859-3",
+	7:    "iso-8859-4",
+	8:    "iso-8859-5",
+	9:    "iso-8859-6",
+	10:   "iso-8859-7",
+	11:   "iso-8859-8",
+	12:   "iso-8859-9",
+	17:   "shift_jis",
+	106:  "utf-8",
+	1000: "iso-10646-ucs-2",
+	1015: "utf-16",
+	2026: "big5",
+}
+
+// Well-known part header fields: WAP-230-WSP, table 39.
+const (
+	fieldContentLocation    = 0x0E
+	fieldContentDisposition = 0x2E
+	fieldContentID          = 0x40
+	fieldContentDisp2       = 0x45 // encoding version 1.4
+)
+
+// decodesCharset reports whether decodeText converts text in
+// charset to UTF-8.
+func decodesCharset(charset string) bool {
+	switch strings.ToLower(charset) {
+	case "", "us-ascii", "utf-8", "iso-8859-1", "iso-10646-ucs-2", "utf-16":
+		return true
+	}
+	return false
+}
+
+// decodeText converts text in the given character set to UTF-8.
+// Unsupported character sets are returned as is.
+func decodeText(charset string, data []byte) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1":
+		r := make([]rune, len(data))
+		for i, c := range data {
+			r[i] = rune(c)
+		}
+		return string(r)
+	case "iso-10646-ucs-2", "utf-16":
+		bigEndian := true
+		if len(data) >= 2 {
+			switch {
+			case data[0] == 0xfe && data[1] == 0xff:
+				data = data[2:]
+			case data[0] == 0xff && data[1] == 0xfe:
+				data, bigEndian = data[2:], false
+			}
+		}
+		s := make([]uint16, len(data)/2)
+		for i := range s {
+			if bigEndian {
+				s[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+			} else {
+				s[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+			}
+		}
+		return string(utf16.Decode(s))
+	}
+	return string(data)
+}
+
+func peekByte(r ByteReader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, unexpected(err)
+	}
+	return b, r.UnreadByte()
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readBytes reads n bytes. The buffer grows as data is read,
+// so that a corrupted length cannot cause a huge allocation.
+func readBytes(r io.Reader, n uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, r, int64(n))
+	return buf.Bytes(), unexpected(err)
+}
+
+// readUintvar reads a variable length unsigned integer:
+// 7 bits per byte, most significant first.
+func readUintvar(r ByteReader) (uint64, error) {
+	var n uint64
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return n, unexpected(err)
+		}
+		n = n<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			return n, nil
+		}
+	}
+	return n, fmt.Errorf("uintvar too long")
+}
+
+// readValueLength reads a Value-length: a short length
+// or a quoted uintvar.
+func readValueLength(r ByteReader) (uint64, error) {
+	b, err := r.ReadByte()
+	switch {
+	case err != nil:
+		return 0, unexpected(err)
+	case b <= 30:
+		return uint64(b), nil
+	case b == 31:
+		return readUintvar(r)
+	}
+	return 0, fmt.Errorf("invalid value length 0x%x", b)
+}
+
+// readValue reads a Value-length and the following data.
+func readValue(r ByteReader) (*bytes.Buffer, error) {
+	n, err := readValueLength(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readBytes(r, n)
+	return bytes.NewBuffer(data), err
+}
+
+// readText reads a NUL-terminated string, removing the quote
+// character of Text-string or Quoted-string.
+func readText(r ByteReader) (string, error) {
+	s, err := r.ReadString(0)
+	if err != nil {
+		return s, unexpected(err)
+	}
+	s = s[:len(s)-1]
+	if strings.HasPrefix(s, "\x7f") || strings.HasPrefix(s, `"`) {
+		s = s[1:]
+	}
+	return s, nil
+}
+
+// readLongInteger reads a Short-length followed by a big-endian
+// integer.
+func readLongInteger(r ByteReader) (uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, unexpected(err)
+	}
+	if b > 8 {
+		return 0, fmt.Errorf("integer too large")
+	}
+	var n uint64
+	for i := 0; i < int(b); i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			return n, unexpected(err)
+		}
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+// readInteger reads an Integer-value: a Short-integer (a single
+// byte with high bit set) or a Long-integer.
+func readInteger(r ByteReader) (uint64, error) {
+	b, err := peekByte(r)
+	switch {
+	case err != nil:
+		return 0, err
+	case b >= 0x80:
+		r.ReadByte()
+		return uint64(b & 0x7f), nil
+	case b <= 30:
+		return readLongInteger(r)
+	}
+	return 0, fmt.Errorf("invalid integer 0x%x", b)
+}
+
+// readEncodedString reads an Encoded-string-value: a text string,
+// or a value holding a charset and text.
+func readEncodedString(r ByteReader) (string, error) {
+	b, err := peekByte(r)
+	if err != nil {
+		return "", err
+	}
+	if b >= 32 {
+		return readText(r)
+	}
+	v, err := readValue(r)
+	if err != nil {
+		return "", err
+	}
+	mib, err := readInteger(v)
+	if err != nil {
+		return "", err
+	}
+	data := bytes.TrimSuffix(v.Bytes(), []byte{0})
+	if bytes.HasPrefix(data, []byte{0x7f}) {
+		data = data[1:]
+	}
+	return decodeText(charsets[mib], data), nil
+}
+
+// readUntypedValue reads an integer or text value.
+func readUntypedValue(r ByteReader) (string, error) {
+	b, err := peekByte(r)
+	switch {
+	case err != nil:
+		return "", err
+	case b == 0:
+		r.ReadByte() // No-value.
+		return "", nil
+	case b >= 0x80 || b <= 30:
+		n, err := readInteger(r)
+		return strconv.FormatUint(n, 10), err
+	}
+	return readText(r)
+}
+
+// readGenericValue reads a value whose type is unknown, returning
+// it as text if possible.
+func readGenericValue(r ByteReader) (string, error) {
+	b, err := peekByte(r)
+	switch {
+	case err != nil:
+		return "", err
+	case b <= 31:
+		_, err = readValue(r)
+		return "", err
+	case b >= 0x80:
+		r.ReadByte()
+		return strconv.Itoa(int(b & 0x7f)), nil
+	}
+	return readText(r)
+}
+
+// readMediaType reads a well-known media type or a text media type.
+func readMediaType(r ByteReader) (string, error) {
+	b, err := peekByte(r)
+	if err != nil {
+		return "", err
+	}
+	if b >= 32 && b < 0x80 {
+		return readText(r)
+	}
+	n, err := readInteger(r)
+	if err != nil {
+		return "", err
+	}
+	if n < uint64(len(contentTypes)) {
+		return contentTypes[n], nil
+	}
+	return fmt.Sprintf("application/x-wsp-0x%x", n), nil
+}
+
+// readContentType reads a Content-type-value: a media type,
+// possibly followed by parameters.
+func readContentType(r ByteReader) (ct ContentType, err error) {
+	b, err := peekByte(r)
+	if err != nil {
+		return ct, err
+	}
+	if b > 31 {
+		ct.Type, err = readMediaType(r)
+		return ct, err
+	}
+	v, err := readValue(r)
+	if err != nil {
+		return ct, err
+	}
+	ct.Type, err = readMediaType(v)
+	for err == nil && v.Len() > 0 {
+		var key, value string
+		key, value, err = readParam(v)
+		if err == nil {
+			if ct.Params == nil {
+				ct.Params = make(map[string]string)
+			}
+			ct.Params[key] = value
+		}
+	}
+	return ct, err
+}
+
+// readParam reads a typed or untyped parameter.
+func readParam(r ByteReader) (key, value string, err error) {
+	b, err := peekByte(r)
+	if err != nil {
+		return
+	}
+	if b >= 32 && b < 0x80 {
+		key, err = readText(r)
+		if err == nil {
+			value, err = readUntypedValue(r)
+		}
+		return strings.ToLower(key), value, err
+	}
+	id, err := readInteger(r)
+	if err != nil {
+		return
+	}
+	key = paramNames[id]
+	if key == "" {
+		key = fmt.Sprintf("x-wsp-param-0x%x", id)
+	}
+	switch id {
+	case paramCharset:
+		var mib uint64
+		if mib, err = readInteger(r); mib == 0 {
+			value = "*"
+		} else if value = charsets[mib]; value == "" {
+			value = strconv.FormatUint(mib, 10)
+		}
+	case paramRelType:
+		value, err = readMediaType(r)
+	case paramQ:
+		var q uint64
+		q, err = readUintvar(r)
+		value = strconv.FormatUint(q, 10)
+	default:
+		value, err = readUntypedValue(r)
+	}
+	return key, value, err
+}
+
+// readMultipart reads a multipart body: WAP-230-WSP, section 8.5.
+func readMultipart(r ByteReader) (parts []Part, err error) {
+	n, err := readUintvar(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < n; i++ {
+		hlen, err := readUintvar(r)
+		if err != nil {
+			return parts, err
+		}
+		dlen, err := readUintvar(r)
+		if err != nil {
+			return parts, err
+		}
+		headers, err := readBytes(r, hlen)
+		if err != nil {
+			return parts, err
+		}
+		var p Part
+		p.Data, err = readBytes(r, dlen)
+		if err != nil {
+			return parts, err
+		}
+		if err = p.readHeaders(bytes.NewBuffer(headers)); err != nil {
+			return parts, fmt.Errorf("part %d: %s", i+1, err)
+		}
+		parts = append(parts, p)
+	}
+	return parts, nil
+}
+
+// readHeaders reads the content type and headers of a part.
+func (p *Part) readHeaders(r *bytes.Buffer) (err error) {
+	p.ContentType, err = readContentType(r)
+	for err == nil && r.Len() > 0 {
+		var name, value string
+		b, _ := r.ReadByte()
+		switch {
+		case b == 0x7f:
+			r.ReadByte() // shift to another code page.
+			continue
+		case b < 32:
+			continue // short-cut shift.
+		case b < 0x80:
+			r.UnreadByte()
+			name, err = readText(r)
+			if err == nil {
+				value, err = readText(r)
+			}
+		case b&0x7f == fieldContentLocation:
+			name = "Content-Location"
+			value, err = readText(r)
+		case b&0x7f == fieldContentID:
+			name = "Content-ID"
+			value, err = readText(r)
+		case b&0x7f == fieldContentDisposition, b&0x7f == fieldContentDisp2:
+			name = "Content-Disposition"
+			value, err = readDisposition(r)
+		default:
+			name = fmt.Sprintf("X-Wsp-Header-0x%x", b&0x7f)
+			value, err = readGenericValue(r)
+		}
+		if err != nil {
+			return err
+		}
+		p.setHeader(name, value)
+	}
+	return err
+}
+
+func (p *Part) setHeader(name, value string) {
+	switch strings.ToLower(name) {
+	case "content-location":
+		p.ContentLocation = value
+	case "content-id":
+		p.ContentID = value
+	default:
+		if p.Header == nil {
+			p.Header = make(map[string]string)
+		}
+		p.Header[name] = value
+	}
+}
+
+var dispositions = [...]string{"form-data", "attachment", "inline"}
+
+// readDisposition reads a Content-Disposition value and formats
+// it as text.
+func readDisposition(r ByteReader) (string, error) {
+	v, err := readValue(r)
+	if err != nil {
+		return "", err
+	}
+	var disp string
+	if b, err := peekByte(v); err != nil {
+		return "", err
+	} else if b >= 0x80 {
+		v.ReadByte()
+		if int(b&0x7f) < len(dispositions) {
+			disp = dispositions[b&0x7f]
+		}
+	} else if disp, err = readText(v); err != nil {
+		return "", err
+	}
+	params := make(map[string]string)
+	for v.Len() > 0 {
+		key, value, err := readParam(v)
+		if err != nil {
+			return "", err
+		}
+		params[key] = value
+	}
+	if s := mime.FormatMediaType(disp, params); s != "" {
+		return s, nil
+	}
+	return disp, nil
+}
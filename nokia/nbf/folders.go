@@ -0,0 +1,122 @@
+package nbf
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var messageFolders = map[string]string{
+	"1": "inbox",
+	"2": "outbox",
+	"3": "sent",
+	"4": "archive",
+	"5": "drafts",
+	"6": "templates",
+}
+
+// A Folder is a directory of the archive.
+type Folder struct {
+	Name    string // e.g. inbox, sent, drafts for message folders.
+	Path    string // path in the archive, without trailing slash.
+	Entries int    // number of files.
+}
+
+// Folders lists the directories of the archive holding files,
+// sorted by path.
+func (r *Reader) Folders() []Folder {
+	idx := make(map[string]int)
+	var folders []Folder
+	for _, f := range r.z.File {
+		if f.Mode().IsDir() {
+			continue
+		}
+		dir := path.Dir(f.Name)
+		i, ok := idx[dir]
+		if !ok {
+			i = len(folders)
+			idx[dir] = i
+			folders = append(folders, Folder{Name: folderName(dir), Path: dir})
+		}
+		folders[i].Entries++
+	}
+	sort.Slice(folders, func(i, j int) bool { return folders[i].Path < folders[j].Path })
+	return folders
+}
+
+func folderName(dir string) string {
+	if !strings.HasPrefix(dir, "predefmessages/") {
+		return dir
+	}
+	n := strings.TrimPrefix(dir, "predefmessages/")
+	if name, ok := messageFolders[n]; ok {
+		return name
+	}
+	return "folder " + n
+}
+
+// Messages returns the text messages of a message folder, given
+// by name (as returned by Folders) or by path.
+func (r *Reader) Messages(folder string) ([]SMS, error) {
+	for _, f := range r.Folders() {
+		if !strings.HasPrefix(f.Path, "predefmessages/") {
+			continue
+		}
+		if f.Name == folder || f.Path == folder {
+			return r.messages(f.Path+"/", f.Name)
+		}
+	}
+	return nil, fmt.Errorf("no message folder %q", folder)
+}
+
+// A MMS is a multimedia message, as a binary PDU which can be
+// decoded by package mms.
+type MMS struct {
+	NBFFile string
+	Folder  string
+	Stamp   time.Time
+	Peer    string
+	Data    []byte
+}
+
+// MMS returns the multimedia messages of all message folders.
+// Files which cannot be read are skipped, and the first error
+// is returned.
+func (r *Reader) MMS() (msgs []MMS, err error) {
+	for _, f := range r.z.File {
+		if !strings.HasPrefix(f.Name, "predefmessages/") || f.Mode().IsDir() {
+			continue
+		}
+		base := path.Base(f.Name)
+		info, perr := parseNBFFilename(base)
+		if perr != nil {
+			log.Printf("invalid entry name %q: %s", base, perr)
+			continue
+		}
+		if info.Flags&0xff00 != FLAGS_MMS {
+			continue
+		}
+		blob, rerr := readFile(f)
+		if rerr != nil {
+			if err == nil {
+				err = fmt.Errorf("cannot read %s: %s", f.Name, rerr)
+			}
+			continue
+		}
+		if !isMMS(blob) {
+			log.Printf("no MMS PDU in %s", base)
+			continue
+		}
+		msgs = append(msgs, MMS{
+			NBFFile: base,
+			Folder:  folderName(path.Dir(f.Name)),
+			Stamp:   DosTime(info.Timestamp).Local(),
+			Peer:    info.Peer,
+			Data:    blob[0xb0:],
+		})
+	}
+	return msgs, err
+}
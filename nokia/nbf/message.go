@@ -10,7 +10,12 @@ import (
 )
 
 // predefmessages/1: inbox
-// predefmessages/3: outbox
+// predefmessages/2: outbox (pending messages)
+// predefmessages/3: sent items
+// predefmessages/4: archive
+// predefmessages/5: drafts
+// predefmessages/6: templates
+// other numbers are user-defined folders.
 
 type msgInfo struct {
 	// Filename information
@@ -117,6 +122,11 @@ type message interface {
 // [23]byte unknown data
 
 func parseMessage(s []byte) (m rawMessage, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			m, err = rawMessage{}, fmt.Errorf("invalid message: %v", p)
+		}
+	}()
 	// peer (fixed offset 0x5e)
 	var runes []uint16
 	for off := 0x5e; s[off]|s[off+1] != 0; off += 2 {
@@ -134,7 +144,7 @@ func parseMessage(s []byte) (m rawMessage, err error) {
 	// received SMS: 04 0b 91
 	pdu := s[0xb0:]
 	msgType := pdu[0]
-	if msgType == 0x8c {
+	if isMMS(s) {
 		err = fmt.Errorf("MMS is not supported")
 		return
 	}
@@ -218,6 +228,42 @@ func parseMessage(s []byte) (m rawMessage, err error) {
 	return m, nil
 }
 
+// isMMS reports whether s holds a MMS PDU (starting with a
+// X-Mms-Message-Type header) rather than a SMS.
+func isMMS(s []byte) bool {
+	return len(s) > 0xb0 && s[0xb0] == 0x8c
+}
+
+// DecodePDU decodes a SMS-DELIVER or SMS-SUBMIT TPDU as per
+// GSM 03.40. The time stamp is only known for incoming messages.
+func DecodePDU(pdu []byte) (sms SMS, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("invalid PDU: %v", p)
+		}
+	}()
+	if len(pdu) == 0 {
+		return sms, fmt.Errorf("empty PDU")
+	}
+	switch pdu[0] & 3 {
+	case 0: // SMS-DELIVER
+		msg, _, err := parseDeliverMessage(pdu)
+		if err != nil {
+			return sms, err
+		}
+		sms = SMS{Type: 0, Peer: msg.FromAddr, When: msg.SMSCStamp, Text: msg.UserData()}
+	case 1: // SMS-SUBMIT
+		msg, _, err := parseSubmitMessage(pdu)
+		if err != nil {
+			return sms, err
+		}
+		sms = SMS{Type: 1, Peer: msg.ToAddr, Peers: []string{msg.ToAddr}, Text: msg.UserData()}
+	default:
+		return sms, fmt.Errorf("unsupported message type %d", pdu[0]&3)
+	}
+	return sms, nil
+}
+
 // Parsing of DELIVER-MESSAGE
 
 // A deliverMessage represents the contents of a SMS-DELIVER message
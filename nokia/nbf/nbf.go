@@ -29,77 +29,32 @@ func (r *Reader) Close() error {
 	return r.z.Close()
 }
 
+// A SMS is a text message. NBU archives use the same type.
 type SMS struct {
 	Type  int // 0: incoming, 1: outgoing
 	Peer  string
 	Peers []string
 	When  time.Time
 	Text  string
+
+	Folder string // folder name, if known.
+	Read   bool   // false for unread incoming messages.
 }
 
+// Inbox returns the received messages (predefmessages/1).
 func (r *Reader) Inbox() ([]SMS, error) {
-	msgs := make([]SMS, 0, len(r.z.File)/4)
-
-	type multiKey struct {
-		Peer string
-		Ref  int
-	}
-	multiparts := make(map[multiKey][]userData)
-	baseMsg := make(map[multiKey]SMS)
-	for _, f := range r.z.File {
-		if !strings.HasPrefix(f.Name, "predefmessages/1/") {
-			continue
-		}
-		base := path.Base(f.Name)
-		fr, err := f.Open()
-		if err != nil {
-			log.Printf("cannot read %s: %s", base, err)
-			continue
-		}
-		blob, err := ioutil.ReadAll(fr)
-		if err != nil {
-			log.Printf("cannot read %s: %s", base, err)
-			continue
-		}
-		m, err := parseMessage(blob)
-		if err != nil {
-			log.Printf("cannot parse %s: %s", base, err)
-			continue
-		}
-
-		msg := m.Msg.(deliverMessage)
-		sms := SMS{
-			Type:  int(msg.MsgType),
-			Peer:  msg.FromAddr,
-			Peers: m.Peers,
-			When:  msg.SMSCStamp,
-			Text:  msg.UserData(),
-		}
-
-		if msg.Concat {
-			key := multiKey{Peer: sms.Peer, Ref: msg.Ref}
-			parts := append(multiparts[key], msg.userData)
-			if msg.Part == 1 {
-				baseMsg[key] = sms
-			}
-			if len(parts) == msg.NParts {
-				delete(multiparts, key)
-				sms := baseMsg[key]
-				delete(baseMsg, key)
-				sms.Text = mergeConcatSMS(parts, msg.Unicode)
-				msgs = append(msgs, sms)
-			} else {
-				multiparts[key] = parts
-			}
-		} else {
-			msgs = append(msgs, sms)
-		}
-	}
-	sort.Sort(smsByDate(msgs))
-	return msgs, nil
+	return r.messages("predefmessages/1/", folderName("predefmessages/1"))
 }
 
+// Outbox returns the sent messages (predefmessages/3), in the
+// "sent" folder as named by Folders.
 func (r *Reader) Outbox() ([]SMS, error) {
+	return r.messages("predefmessages/3/", folderName("predefmessages/3"))
+}
+
+// messages reads the text messages of directory dir, merging
+// concatenated messages. MMS are skipped.
+func (r *Reader) messages(dir, folder string) ([]SMS, error) {
 	msgs := make([]SMS, 0, len(r.z.File)/4)
 
 	type multiKey struct {
@@ -108,25 +63,17 @@ func (r *Reader) Outbox() ([]SMS, error) {
 	}
 	multiparts := make(map[multiKey][]userData)
 	baseMsg := make(map[multiKey]SMS)
-
 	for _, f := range r.z.File {
-		if !strings.HasPrefix(f.Name, "predefmessages/3/") {
+		if path.Dir(f.Name)+"/" != dir || f.Mode().IsDir() {
 			continue
 		}
 		base := path.Base(f.Name)
-		info, err := parseNBFFilename(base)
-		if err != nil {
-			log.Printf("invalid entry name %q: %s", base, err)
-			continue
-		}
-		fr, err := f.Open()
+		blob, err := readFile(f)
 		if err != nil {
 			log.Printf("cannot read %s: %s", base, err)
 			continue
 		}
-		blob, err := ioutil.ReadAll(fr)
-		if err != nil {
-			log.Printf("cannot read %s: %s", base, err)
+		if isMMS(blob) {
 			continue
 		}
 		m, err := parseMessage(blob)
@@ -135,29 +82,56 @@ func (r *Reader) Outbox() ([]SMS, error) {
 			continue
 		}
 
-		msg := m.Msg.(submitMessage)
-		if m.Peer == "" && len(m.Peers) == 0 {
-			log.Printf("WARN: empty peer in %s", base)
-		}
-		sms := SMS{
-			Type:  int(msg.MsgType),
-			Peer:  m.Peer,
-			Peers: m.Peers,
-			When:  DosTime(info.Timestamp).Local(),
-			Text:  msg.UserData(),
+		var sms SMS
+		var key multiKey
+		var data userData
+		var uni bool
+		switch msg := m.Msg.(type) {
+		case deliverMessage:
+			sms = SMS{
+				Type:  int(msg.MsgType),
+				Peer:  msg.FromAddr,
+				Peers: m.Peers,
+				When:  msg.SMSCStamp,
+				Text:  msg.UserData(),
+				// read status is not recorded.
+				Folder: folder,
+				Read:   true,
+			}
+			key = multiKey{Peer: sms.Peer, Ref: msg.Ref}
+			data, uni = msg.userData, msg.Unicode
+		case submitMessage:
+			info, err := parseNBFFilename(base)
+			if err != nil {
+				log.Printf("invalid entry name %q: %s", base, err)
+				continue
+			}
+			if m.Peer == "" && len(m.Peers) == 0 {
+				log.Printf("WARN: empty peer in %s", base)
+			}
+			sms = SMS{
+				Type:   int(msg.MsgType),
+				Peer:   m.Peer,
+				Peers:  m.Peers,
+				When:   DosTime(info.Timestamp).Local(),
+				Text:   msg.UserData(),
+				Folder: folder,
+				Read:   true,
+			}
+			key = multiKey{Peer: sms.Peer, Ref: int(msg.RefID)<<16 | msg.Ref}
+			data, uni = msg.userData, msg.Unicode
 		}
 
-		if msg.Concat {
-			key := multiKey{Peer: sms.Peer, Ref: int(msg.RefID)<<16 | msg.Ref}
-			if msg.Part == 1 {
+		if data.Concat {
+			if data.Part == 1 {
 				baseMsg[key] = sms
 			}
-			parts := append(multiparts[key], msg.userData)
-			if len(parts) == msg.NParts {
+			parts := append(multiparts[key], data)
+			if len(parts) == data.NParts {
 				delete(multiparts, key)
 				sms := baseMsg[key]
 				delete(baseMsg, key)
-				sms.Text = mergeConcatSMS(parts, msg.Unicode)
+				sms.Text = mergeConcatSMS(parts, uni)
 				msgs = append(msgs, sms)
 			} else {
 				multiparts[key] = parts
@@ -170,6 +144,15 @@ func (r *Reader) Outbox() ([]SMS, error) {
 	return msgs, nil
 }
 
+func readFile(f *zip.File) ([]byte, error) {
+	fr, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+	return ioutil.ReadAll(fr)
+}
+
 type smsByDate []SMS
 
 func (s smsByDate) Len() int           { return len(s) }
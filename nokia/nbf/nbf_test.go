@@ -0,0 +1,145 @@
+package nbf
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/remyoudompheng/go-misc/nokia/vobject"
+)
+
+// writeArchive writes a zip file with the given entries, given as
+// name, contents pairs.
+func writeArchive(t *testing.T, name string, files ...string) {
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for i := 0; i < len(files); i += 2 {
+		w, err := zw.Create(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReaderObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "backup.nbf")
+	writeArchive(t, name,
+		"predefcontacts/1.vcf", "BEGIN:VCARD\r\nVERSION:2.1\r\nN:Doe;John\r\nTEL;CELL:+33612345678\r\nEND:VCARD\r\n",
+		"predefcalendar/1.vcs", "BEGIN:VCALENDAR\r\nVERSION:1.0\r\nBEGIN:VEVENT\r\nSUMMARY:Lunch\r\n"+
+			"DTSTART:20120101T120000\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+		"predefnotes/1.vnt", "\xff\xfeB\x00E\x00G\x00I\x00N\x00:\x00V\x00N\x00O\x00T\x00E\x00\r\x00\n\x00"+
+			"B\x00O\x00D\x00Y\x00:\x00h\x00i\x00\r\x00\n\x00E\x00N\x00D\x00:\x00V\x00N\x00O\x00T\x00E\x00\r\x00\n\x00",
+		"predefbookmarks/1.vbm", "BEGIN:VBKM\r\nVERSION:1.0\r\nTITLE:Go\r\nURL:https://golang.org/\r\nEND:VBKM\r\n",
+		"predefbookmarks/Blog.url", "[InternetShortcut]\r\nURL=http://example.com/\r\n",
+		"predefmessages/5/short", "truncated")
+	r, err := OpenFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	folders := r.Folders()
+	expected := []Folder{
+		{"predefbookmarks", "predefbookmarks", 2},
+		{"predefcalendar", "predefcalendar", 1},
+		{"predefcontacts", "predefcontacts", 1},
+		{"drafts", "predefmessages/5", 1},
+		{"predefnotes", "predefnotes", 1},
+	}
+	if !reflect.DeepEqual(folders, expected) {
+		t.Errorf("got folders %+v, expected %+v", folders, expected)
+	}
+
+	contacts, err := r.Contacts()
+	if err != nil || len(contacts) != 1 || contacts[0].Name.Family != "Doe" {
+		t.Errorf("got contacts %+v, %v", contacts, err)
+	}
+	entries, err := r.Calendar()
+	if err != nil || len(entries) != 1 || entries[0].Summary != "Lunch" {
+		t.Errorf("got calendar %+v, %v", entries, err)
+	}
+	notes, err := r.Notes()
+	if err != nil || len(notes) != 1 || notes[0].Text != "hi" {
+		t.Errorf("got notes %+v, %v", notes, err)
+	}
+	bookmarks, err := r.Bookmarks()
+	if err != nil || len(bookmarks) != 2 {
+		t.Fatalf("got bookmarks %+v, %v", bookmarks, err)
+	}
+	expectedBookmarks := []vobject.Bookmark{
+		{Title: "Go", URL: "https://golang.org/"},
+		{Title: "Blog", URL: "http://example.com/"},
+	}
+	if !reflect.DeepEqual(bookmarks, expectedBookmarks) {
+		t.Errorf("got bookmarks %+v, expected %+v", bookmarks, expectedBookmarks)
+	}
+
+	// invalid messages are skipped.
+	msgs, err := r.Messages("drafts")
+	if err != nil || len(msgs) != 0 {
+		t.Errorf("got messages %+v, %v", msgs, err)
+	}
+	if _, err := r.Messages("nosuchfolder"); err == nil {
+		t.Errorf("no error for unknown folder")
+	}
+}
+
+func TestReaderObjectsReadError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"predefbookmarks/1.url", "predefbookmarks/2.url"} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("[InternetShortcut]\r\nURL=http://example.com/" + name + "\r\n"))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// corrupt the first entry: its checksum no longer matches.
+	data := buf.Bytes()
+	i := bytes.Index(data, []byte("example.com/predefbookmarks/1"))
+	data[i] = 'E'
+	name := filepath.Join(dir, "corrupt.nbf")
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	bookmarks, err := r.Bookmarks()
+	if err == nil {
+		t.Errorf("expected read error")
+	}
+	if len(bookmarks) != 1 || bookmarks[0].URL != "http://example.com/predefbookmarks/2.url" {
+		t.Errorf("got bookmarks %+v", bookmarks)
+	}
+}
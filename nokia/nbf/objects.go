@@ -0,0 +1,150 @@
+package nbf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/remyoudompheng/go-misc/nokia/vobject"
+)
+
+// Contacts, calendar entries, notes and bookmarks are stored
+// as vObject files, one per entry, and are recognized by their
+// extension: .vcf (vCard), .vcs (vCalendar), .vnt (vNote), .vbm
+// (vBookmark). Bookmarks may also be Internet shortcuts (.url).
+
+// Contacts returns the contacts of the archive.
+func (r *Reader) Contacts() (contacts []vobject.Contact, err error) {
+	err = r.walkObjects(func(name, ext, text string) {
+		if ext != ".vcf" {
+			return
+		}
+		c, err := vobject.ParseVCard(text)
+		if err != nil {
+			log.Printf("cannot parse %s: %s", name, err)
+			return
+		}
+		contacts = append(contacts, c)
+	})
+	return contacts, err
+}
+
+// Calendar returns the calendar entries and to-do items of the archive.
+func (r *Reader) Calendar() (entries []vobject.CalendarEntry, err error) {
+	err = r.walkObjects(func(name, ext, text string) {
+		if ext != ".vcs" {
+			return
+		}
+		e, err := vobject.ParseVCalendar(text)
+		if err != nil {
+			log.Printf("cannot parse %s: %s", name, err)
+			return
+		}
+		entries = append(entries, e...)
+	})
+	return entries, err
+}
+
+// Notes returns the notes of the archive.
+func (r *Reader) Notes() (notes []vobject.Memo, err error) {
+	err = r.walkObjects(func(name, ext, text string) {
+		if ext == ".vnt" {
+			notes = append(notes, vobject.ParseVNote(text))
+		}
+	})
+	return notes, err
+}
+
+// Bookmarks returns the web bookmarks of the archive.
+func (r *Reader) Bookmarks() (bookmarks []vobject.Bookmark, err error) {
+	err = r.walkObjects(func(name, ext, text string) {
+		var b vobject.Bookmark
+		var err error
+		switch ext {
+		case ".vbm":
+			b, err = vobject.ParseVBookmark(text)
+		case ".url":
+			b, err = parseShortcut(text)
+			b.Title = strings.TrimSuffix(path.Base(name), ext)
+		default:
+			return
+		}
+		if err != nil {
+			log.Printf("cannot parse %s: %s", name, err)
+			return
+		}
+		bookmarks = append(bookmarks, b)
+	})
+	return bookmarks, err
+}
+
+// walkObjects calls fn for each file outside message folders,
+// with its lowercase extension and decoded contents. Files which
+// cannot be read are skipped, and the first error is returned.
+func (r *Reader) walkObjects(fn func(name, ext, text string)) (err error) {
+	for _, f := range r.z.File {
+		if strings.HasPrefix(f.Name, "predefmessages/") || f.Mode().IsDir() {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(f.Name))
+		switch ext {
+		case ".vcf", ".vcs", ".vnt", ".vbm", ".url":
+		default:
+			continue
+		}
+		data, rerr := readFile(f)
+		if rerr != nil {
+			if err == nil {
+				err = fmt.Errorf("cannot read %s: %s", f.Name, rerr)
+			}
+			continue
+		}
+		fn(f.Name, ext, decodeText(data))
+	}
+	return err
+}
+
+// decodeText decodes UTF-8 text, or UTF-16 text starting with
+// a byte order mark.
+func decodeText(data []byte) string {
+	var order binary.ByteOrder
+	switch {
+	case len(data) >= 2 && data[0] == 0xff && data[1] == 0xfe:
+		order = binary.LittleEndian
+	case len(data) >= 2 && data[0] == 0xfe && data[1] == 0xff:
+		order = binary.BigEndian
+	default:
+		return strings.TrimPrefix(string(data), "\ufeff")
+	}
+	runes := make([]uint16, (len(data)-2)/2)
+	for i := range runes {
+		runes[i] = order.Uint16(data[2+2*i:])
+	}
+	return string(utf16.Decode(runes))
+}
+
+var errNoURL = errors.New("missing URL")
+
+// parseShortcut parses the URL of an Internet shortcut:
+//
+//	[InternetShortcut]
+//	URL=http://www.example.com/
+func parseShortcut(s string) (b vobject.Bookmark, err error) {
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "URL=") {
+			b.URL = line[len("URL="):]
+			return b, nil
+		}
+	}
+	if err = sc.Err(); err == nil {
+		err = errNoURL
+	}
+	return b, err
+}
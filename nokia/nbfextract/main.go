@@ -3,14 +3,19 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
-	//"github.com/remyoudompheng/go-misc/nokia/mms"
+	"github.com/remyoudompheng/go-misc/nokia/mms"
 	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/vobject"
 )
 
 func main() {
@@ -28,6 +33,11 @@ func main() {
 	}
 	defer f.Close()
 
+	folders := f.Folders()
+	for _, folder := range folders {
+		log.Printf("folder %s (%s): %d entries", folder.Path, folder.Name, folder.Entries)
+	}
+
 	inbox, err := f.Inbox()
 	if err != nil {
 		log.Fatal(err)
@@ -36,7 +46,8 @@ func main() {
 	dumpMessage := func(m nbf.SMS, p string) {
 		mout, err := os.Create(p)
 		if err != nil {
-			log.Fatalf("cannot create %s/inbox: %s", destdir, err)
+			log.Printf("cannot create %s: %s", p, err)
+			return
 		}
 		fmt.Fprintf(mout, "Date: %s\n", m.When.Format("02 Jan 2006 15:04:05 -0700"))
 		if m.Type == 0 {
@@ -54,7 +65,7 @@ func main() {
 	}
 	for i, m := range inbox {
 		p := filepath.Join(destdir, m.When.Format("20060102-150405")+
-			fmt.Sprintf("-%04d-%s-inbox.msg", i, m.Peer))
+			fmt.Sprintf("-%04d-%s-inbox.msg", i, fileName(m.Peer)))
 		dumpMessage(m, p)
 	}
 
@@ -67,10 +78,41 @@ func main() {
 			m.Peer = "multiple"
 		}
 		p := filepath.Join(destdir, m.When.Format("20060102-150405")+
-			fmt.Sprintf("-%04d-%s-outbox.msg", i, m.Peer))
+			fmt.Sprintf("-%04d-%s-outbox.msg", i, fileName(m.Peer)))
 		dumpMessage(m, p)
 	}
 
+	// other message folders: drafts, archive...
+	for _, folder := range folders {
+		switch folder.Path {
+		case "predefmessages/1", "predefmessages/3":
+			continue // inbox and outbox
+		}
+		if !strings.HasPrefix(folder.Path, "predefmessages/") {
+			continue
+		}
+		msgs, err := f.Messages(folder.Path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		name := fileName(folder.Name)
+		for i, m := range msgs {
+			if m.Peer == "" && len(m.Peers) > 0 {
+				m.Peer = "multiple"
+			}
+			p := filepath.Join(destdir, m.When.Format("20060102-150405")+
+				fmt.Sprintf("-%04d-%s-%s.msg", i, fileName(m.Peer), name))
+			dumpMessage(m, p)
+		}
+	}
+
+	dumpMMS(f, filepath.Join(destdir, "mms"))
+	stamp := time.Now()
+	if fi, err := os.Stat(input); err == nil {
+		stamp = fi.ModTime()
+	}
+	dumpObjects(f, destdir, stamp)
+
 	images, err := f.Images()
 	if err != nil {
 		log.Fatal("cannot extract images:", err)
@@ -78,10 +120,111 @@ func main() {
 	log.Printf("dumping %d images to %s", len(images), destdir)
 	for i, img := range images {
 		stamp := img.Stamp.Format("20060102-150405")
-		out := filepath.Join(destdir, fmt.Sprintf("%s-%s-%03d.%s", stamp, img.Peer, i, img.Type))
+		out := filepath.Join(destdir, fmt.Sprintf("%s-%s-%03d.%s", stamp, fileName(img.Peer), i, img.Type))
 		err := ioutil.WriteFile(out, img.Data, 0644)
 		if err != nil {
 			log.Printf("error writing image to %s: %s", out, err)
 		}
 	}
 }
+
+func dumpMMS(f *nbf.Reader, dir string) {
+	msgs, err := f.MMS()
+	if err != nil {
+		log.Printf("cannot extract all MMS: %s", err)
+	}
+	if len(msgs) == 0 {
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatalf("could not create directory %s: %s", dir, err)
+	}
+	log.Printf("dumping %d MMS to %s", len(msgs), dir)
+	for i, msg := range msgs {
+		base := msg.Stamp.Format("20060102-150405") +
+			fmt.Sprintf("-%04d-%s-%s", i, fileName(msg.Peer), fileName(msg.Folder))
+		base = filepath.Join(dir, base)
+		if err := ioutil.WriteFile(base+".mms", msg.Data, 0644); err != nil {
+			log.Printf("could not write %s.mms: %s", base, err)
+		}
+		m, err := mms.ReadMMS(bytes.NewBuffer(msg.Data))
+		if err != nil {
+			log.Printf("could not decode %s: %s", msg.NBFFile, err)
+			continue
+		}
+		writeFile(base+".eml", m.ToMIME)
+		writeFile(base+".html", m.WriteHTML)
+	}
+}
+
+// dumpObjects writes contacts as vCard 3.0 files, calendar entries
+// and notes as iCalendar files, and bookmarks as Internet shortcuts.
+// stamp is the DTSTAMP of calendar entries.
+func dumpObjects(f *nbf.Reader, destdir string, stamp time.Time) {
+	contacts, err := f.Contacts()
+	if err != nil {
+		log.Printf("cannot extract all contacts: %s", err)
+	}
+	entries, err := f.Calendar()
+	if err != nil {
+		log.Printf("cannot extract all calendar entries: %s", err)
+	}
+	notes, err := f.Notes()
+	if err != nil {
+		log.Printf("cannot extract all notes: %s", err)
+	}
+	bookmarks, err := f.Bookmarks()
+	if err != nil {
+		log.Printf("cannot extract all bookmarks: %s", err)
+	}
+
+	log.Printf("dumping %d contacts, %d calendar entries, %d notes, %d bookmarks to %s",
+		len(contacts), len(entries), len(notes), len(bookmarks), destdir)
+	for i, c := range contacts {
+		writeObject(filepath.Join(destdir, "contacts", fmt.Sprintf("%06d.vcf", i+1)), vobject.FormatVCard3(c))
+	}
+	if len(entries) > 0 {
+		writeObject(filepath.Join(destdir, "calendar.ics"),
+			vobject.FormatICalendar(entries, nil, stamp, "nbfextract"))
+	}
+	if len(notes) > 0 {
+		writeObject(filepath.Join(destdir, "memos.ics"),
+			vobject.FormatICalendar(nil, notes, stamp, "nbfextract"))
+	}
+	for i, b := range bookmarks {
+		writeObject(filepath.Join(destdir, "bookmarks", fmt.Sprintf("%06d.url", i+1)),
+			"[InternetShortcut]\r\nURL="+b.URL+"\r\n")
+	}
+}
+
+var fileNameReplacer = strings.NewReplacer(" ", "", "/", "_", `\`, "_")
+
+// fileName makes s, a folder name or a phone number, usable as
+// part of a file name: spaces are removed and path separators
+// replaced.
+func fileName(s string) string {
+	return fileNameReplacer.Replace(s)
+}
+
+// writeObject writes data to path, creating its directory.
+func writeObject(path, data string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Fatalf("could not create directory %s: %s", filepath.Dir(path), err)
+	}
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		log.Printf("could not write %s: %s", path, err)
+	}
+}
+
+// writeFile creates path and fills it using write.
+func writeFile(path string, write func(w io.Writer) error) {
+	out, err := os.Create(path)
+	if err != nil {
+		log.Printf("could not create %s: %s", path, err)
+		return
+	}
+	defer out.Close()
+	if err := write(out); err != nil {
+		log.Printf("could not write %s: %s", path, err)
+	}
+}
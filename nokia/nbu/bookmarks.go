@@ -0,0 +1,111 @@
+package nbu
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/remyoudompheng/go-misc/nokia/vobject"
+)
+
+// Bookmark and group folders are laid out as message folders:
+// folder id, title, item count, then items. Bookmarks are vBookmark
+// documents:
+//
+//	BEGIN:VBKM
+//	VERSION:1.0
+//	TITLE:Example
+//	URL:http://www.example.com/
+//	END:VBKM
+//
+// A group is described by its name and the identifiers of its
+// members (see Contact.ID).
+
+// A Bookmark is a web browser bookmark.
+type Bookmark = vobject.Bookmark
+
+// A Group is a group of contacts.
+type Group struct {
+	ID      uint32
+	Name    string
+	Members []uint32 // contact identifiers.
+}
+
+// ReadBookmarkFolderAt reads the bookmark folder at offset off.
+func (r *Reader) ReadBookmarkFolderAt(off int64) (title string, bookmarks []Bookmark, err error) {
+	sr, err := r.section(off)
+	if err != nil {
+		return
+	}
+	title, bookmarks, err = parseBookmarkFolder(sr)
+	return title, bookmarks, errorAt(sr, off, err)
+}
+
+// ReadGroupFolderAt reads the contact group folder at offset off.
+func (r *Reader) ReadGroupFolderAt(off int64) (title string, groups []Group, err error) {
+	sr, err := r.section(off)
+	if err != nil {
+		return
+	}
+	title, groups, err = parseGroupFolder(sr)
+	return title, groups, errorAt(sr, off, err)
+}
+
+func parseBookmarkFolder(r io.Reader) (title string, bookmarks []Bookmark, err error) {
+	title, n, err := readFolderHeader(r)
+	if err != nil {
+		return
+	}
+	for i := 0; i < int(n); i++ {
+		_, err = read32(r) // skip
+		if err == nil {
+			_, err = read32(r) // skip
+		}
+		var data []byte
+		if err == nil {
+			data, err = readBlob(r)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return title, bookmarks, err
+		}
+		b, err := vobject.ParseVBookmark(decodeText(data))
+		if err != nil {
+			return title, bookmarks, fmt.Errorf("bookmark %d in folder %q: %s", i+1, title, err)
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	return title, bookmarks, nil
+}
+
+func parseGroupFolder(r io.Reader) (title string, groups []Group, err error) {
+	title, n, err := readFolderHeader(r)
+	if err != nil {
+		return
+	}
+	for i := 0; i < int(n); i++ {
+		var g Group
+		var count uint32
+		g.ID, err = read32(r)
+		if err == nil {
+			g.Name, err = readString(r)
+		}
+		if err == nil {
+			count, err = read32(r)
+		}
+		for j := 0; j < int(count) && err == nil; j++ {
+			var id uint32
+			id, err = read32(r)
+			g.Members = append(g.Members, id)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return title, groups, err
+		}
+		groups = append(groups, g)
+	}
+	return title, groups, nil
+}
@@ -0,0 +1,67 @@
+package nbu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+func writeTestString(buf *bytes.Buffer, s string) {
+	u := utf16.Encode([]rune(s))
+	binary.Write(buf, binary.LittleEndian, uint16(len(u)))
+	binary.Write(buf, binary.LittleEndian, u)
+}
+
+func TestParseBookmarkFolder(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(1))
+	writeTestString(&buf, "Bookmarks")
+	binary.Write(&buf, binary.LittleEndian, uint32(1))
+	binary.Write(&buf, binary.LittleEndian, [2]uint32{})
+	text := utf16.Encode([]rune("BEGIN:VBKM\r\nVERSION:1.0\r\nTITLE:Go\r\nURL:https://golang.org/\r\nEND:VBKM\r\n"))
+	binary.Write(&buf, binary.LittleEndian, uint32(2*len(text)))
+	binary.Write(&buf, binary.LittleEndian, text)
+
+	title, bookmarks, err := parseBookmarkFolder(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Bookmark{{Title: "Go", URL: "https://golang.org/"}}
+	if title != "Bookmarks" || !reflect.DeepEqual(bookmarks, expected) {
+		t.Errorf("got %q %+v", title, bookmarks)
+	}
+}
+
+func TestParseGroupFolder(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(1))
+	writeTestString(&buf, "Groups")
+	binary.Write(&buf, binary.LittleEndian, uint32(2))
+	binary.Write(&buf, binary.LittleEndian, uint32(10))
+	writeTestString(&buf, "Family")
+	binary.Write(&buf, binary.LittleEndian, []uint32{2, 7, 9})
+	binary.Write(&buf, binary.LittleEndian, uint32(11))
+	writeTestString(&buf, "Work")
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+
+	data := buf.Bytes()
+	_, groups, err := parseGroupFolder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Group{
+		{ID: 10, Name: "Family", Members: []uint32{7, 9}},
+		{ID: 11, Name: "Work"},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("got %+v", groups)
+	}
+
+	// truncated folder.
+	_, _, err = parseGroupFolder(bytes.NewReader(data[:20]))
+	if err == nil {
+		t.Errorf("expected error on truncated folder")
+	}
+}
@@ -0,0 +1,82 @@
+package nbu
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/remyoudompheng/go-misc/nokia/vobject"
+)
+
+// Calendar entries are stored as vCalendar 1.0 documents, memos
+// as plain text or vNote documents. In both sections, items
+// follow the section header, each being a 32-bit identifier and
+// a 32-bit byte length followed by text.
+
+type (
+	CalendarEntry = vobject.CalendarEntry
+	Recurrence    = vobject.Recurrence
+	Memo          = vobject.Memo
+)
+
+// The kind of a calendar entry.
+const (
+	Appointment = vobject.Appointment
+	Reminder    = vobject.Reminder
+	Anniversary = vobject.Anniversary
+	Todo        = vobject.Todo
+)
+
+// ReadCalendarAt reads n calendar entries from the section at
+// offset off.
+func (r *Reader) ReadCalendarAt(off int64, n int64) ([]CalendarEntry, error) {
+	sr, err := r.section(off)
+	if err != nil {
+		return nil, err
+	}
+	texts, err := readItems(sr, n)
+	entries := make([]CalendarEntry, 0, len(texts))
+	for i, text := range texts {
+		e, err := vobject.ParseVCalendar(text)
+		if err != nil {
+			return entries, errorAt(sr, off, fmt.Errorf("calendar entry %d: %s", i+1, err))
+		}
+		entries = append(entries, e...)
+	}
+	return entries, errorAt(sr, off, err)
+}
+
+// ReadMemosAt reads n memos from the section at offset off.
+func (r *Reader) ReadMemosAt(off int64, n int64) ([]Memo, error) {
+	sr, err := r.section(off)
+	if err != nil {
+		return nil, err
+	}
+	texts, err := readItems(sr, n)
+	memos := make([]Memo, 0, len(texts))
+	for _, text := range texts {
+		memos = append(memos, vobject.ParseVNote(text))
+	}
+	return memos, errorAt(sr, off, err)
+}
+
+func readItems(r io.Reader, n int64) (texts []string, err error) {
+	// skip section header.
+	if _, err = io.ReadFull(r, make([]byte, 0x14)); err != nil {
+		return nil, err
+	}
+	for i := int64(0); i < n; i++ {
+		_, err := read32(r) // id
+		var data []byte
+		if err == nil {
+			data, err = readBlob(r)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return texts, err
+		}
+		texts = append(texts, decodeText(data))
+	}
+	return texts, nil
+}
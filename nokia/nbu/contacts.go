@@ -0,0 +1,85 @@
+package nbu
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/remyoudompheng/go-misc/nokia/vobject"
+)
+
+// Contacts are stored as vCard 2.1 documents, decoded by
+// package vobject.
+type (
+	Contact    = vobject.Contact
+	Name       = vobject.Name
+	TypedValue = vobject.TypedValue
+	Address    = vobject.Address
+)
+
+// ReadContactFolderAt reads the contact folder at offset off.
+func (r *Reader) ReadContactFolderAt(off int64) (title string, contacts []Contact, err error) {
+	sr, err := r.section(off)
+	if err != nil {
+		return
+	}
+	title, contacts, err = parseContactFolder(sr)
+	return title, contacts, errorAt(sr, off, err)
+}
+
+// Contacts returns the contacts of all folders of the archive.
+func (r *Reader) Contacts() ([]Contact, error) {
+	info, err := r.Info()
+	if err != nil {
+		return nil, err
+	}
+	var contacts []Contact
+	for _, sec := range info.Sections {
+		if sec.Type != SecContacts {
+			continue
+		}
+		idx := make([]int, 0, len(sec.Folders))
+		for i := range sec.Folders {
+			idx = append(idx, i)
+		}
+		sort.Ints(idx)
+		for _, i := range idx {
+			_, c, err := r.ReadContactFolderAt(sec.Folders[i])
+			contacts = append(contacts, c...)
+			if err != nil {
+				return contacts, err
+			}
+		}
+	}
+	return contacts, nil
+}
+
+func parseContactFolder(r io.Reader) (title string, contacts []Contact, err error) {
+	title, n, err := readFolderHeader(r)
+	if err != nil {
+		return
+	}
+	for i := 0; i < int(n); i++ {
+		id, err := read32(r)
+		if err == nil {
+			_, err = read32(r) // skip
+		}
+		var data []byte
+		if err == nil {
+			data, err = readBlob(r)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return title, contacts, err
+		}
+		c, err := vobject.ParseVCard(decodeText(data))
+		if err != nil {
+			return title, contacts, fmt.Errorf("contact %d in folder %q: %s", i+1, title, err)
+		}
+		c.ID = id
+		contacts = append(contacts, c)
+	}
+	return title, contacts, nil
+}
@@ -0,0 +1,195 @@
+package nbu
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Internal files (photos, ringtones, themes...) are stored one
+// after the other from the file table offset. Each file is
+// described by its directory and name (strings), 4 unknown
+// bytes, a 64-bit size and a modification time, followed by the
+// file data.
+
+// A File is a file from the internal memory of the phone.
+type File struct {
+	Path    string // slash-separated, e.g. C/Data/Images/photo.jpg
+	Size    int64
+	ModTime time.Time
+	Offset  int64 // offset of data in the archive.
+}
+
+// ReadFilesAt reads the description of n files from offset off.
+func (r *Reader) ReadFilesAt(off int64, n int64) ([]File, error) {
+	var files []File
+	for i := int64(0); i < n; i++ {
+		sr, err := r.section(off)
+		if err != nil {
+			return files, err
+		}
+		var dir, name string
+		var size uint64
+		var mtime time.Time
+		dir, err = readString(sr)
+		if err == nil {
+			name, err = readString(sr)
+		}
+		if err == nil {
+			_, err = read32(sr) // ?
+		}
+		if err == nil {
+			size, err = read64(sr)
+		}
+		if err == nil {
+			mtime, err = readTime(sr)
+		}
+		if err != nil {
+			return files, errorAt(sr, off, err)
+		}
+		pos, _ := sr.Seek(0, os.SEEK_CUR)
+		if size > uint64(sr.Size()-pos) {
+			return files, errorAt(sr, off, errTooLong)
+		}
+		f := File{
+			Path:    cleanPath(dir + `\` + name),
+			Size:    int64(size),
+			ModTime: mtime,
+			Offset:  off + pos,
+		}
+		files = append(files, f)
+		off = f.Offset + f.Size
+	}
+	return files, nil
+}
+
+// cleanPath turns a phone path such as C:\Data\Sounds\ring.aac
+// into a relative slash-separated path (C/Data/Sounds/ring.aac).
+func cleanPath(p string) string {
+	p = strings.Replace(p, `\`, "/", -1)
+	p = strings.Replace(p, ":", "", -1)
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// Open returns a reader for the contents of f.
+func (r *Reader) Open(f File) *io.SectionReader {
+	return io.NewSectionReader(r.File, f.Offset, f.Size)
+}
+
+// NewFS returns a view of files as a http.FileSystem.
+func NewFS(r *Reader, files []File) http.FileSystem {
+	fs := &nbuFS{r: r, files: make(map[string]File), dirs: make(map[string][]os.FileInfo)}
+	fs.dirs["/"] = nil
+	for _, f := range files {
+		name := "/" + f.Path
+		if _, dup := fs.files[name]; dup || f.Path == "" {
+			continue
+		}
+		fs.files[name] = f
+		fs.addEntry(name, fileInfo{name: path.Base(name), size: f.Size, mtime: f.ModTime})
+	}
+	for _, entries := range fs.dirs {
+		sort.Sort(byName(entries))
+	}
+	return fs
+}
+
+type nbuFS struct {
+	r     *Reader
+	files map[string]File
+	dirs  map[string][]os.FileInfo // directory contents
+}
+
+// addEntry adds a file to its parent directory, creating it
+// if needed.
+func (fs *nbuFS) addEntry(name string, fi os.FileInfo) {
+	dir := path.Dir(name)
+	_, exists := fs.dirs[dir]
+	fs.dirs[dir] = append(fs.dirs[dir], fi)
+	if !exists {
+		fs.addEntry(dir, fileInfo{name: path.Base(dir), mtime: fi.ModTime(), dir: true})
+	}
+}
+
+var _ http.FileSystem = new(nbuFS)
+
+func (fs *nbuFS) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	if f, ok := fs.files[name]; ok {
+		info := fileInfo{name: path.Base(name), size: f.Size, mtime: f.ModTime}
+		return &nbuFile{SectionReader: fs.r.Open(f), info: info}, nil
+	}
+	if entries, ok := fs.dirs[name]; ok {
+		info := fileInfo{name: path.Base(name), dir: true}
+		return &nbuDir{info: info, entries: entries}, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+type nbuFile struct {
+	*io.SectionReader
+	info fileInfo
+}
+
+func (f *nbuFile) Close() error                             { return nil }
+func (f *nbuFile) Stat() (os.FileInfo, error)               { return f.info, nil }
+func (f *nbuFile) Readdir(count int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+
+var _ http.File = new(nbuFile)
+
+type nbuDir struct {
+	info    fileInfo
+	entries []os.FileInfo
+}
+
+func (f *nbuDir) Close() error                              { return nil }
+func (f *nbuDir) Stat() (os.FileInfo, error)                { return f.info, nil }
+func (f *nbuDir) Read(s []byte) (int, error)                { return 0, os.ErrInvalid }
+func (f *nbuDir) Seek(off int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+
+func (f *nbuDir) Readdir(count int) ([]os.FileInfo, error) {
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.entries) {
+		count = len(f.entries)
+	}
+	entries := f.entries[:count]
+	f.entries = f.entries[count:]
+	return entries, nil
+}
+
+type fileInfo struct {
+	name  string
+	size  int64
+	mtime time.Time
+	dir   bool
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) ModTime() time.Time { return fi.mtime }
+func (fi fileInfo) IsDir() bool        { return fi.dir }
+func (fi fileInfo) Sys() interface{}   { return nil }
+
+func (fi fileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
+
+type byName []os.FileInfo
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Less(i, j int) bool { return s[i].Name() < s[j].Name() }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,81 @@
+package nbu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+type nopCloser struct{ *bytes.Reader }
+
+func (nopCloser) Close() error { return nil }
+
+func TestFS(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("header")
+	writeString := func(s string) {
+		u := utf16.Encode([]rune(s))
+		binary.Write(&buf, binary.LittleEndian, uint16(len(u)))
+		binary.Write(&buf, binary.LittleEndian, u)
+	}
+	for _, f := range []struct{ dir, name, data string }{
+		{`C:\Data\Images\`, "photo.jpg", "JFIF"},
+		{`C:\Data\Sounds\`, "ring.aac", "AAC data"},
+		{`C:\Data\Images\`, "..\\..\\..\\evil", "x"},
+	} {
+		writeString(f.dir)
+		writeString(f.name)
+		binary.Write(&buf, binary.LittleEndian, uint32(0))
+		binary.Write(&buf, binary.LittleEndian, uint64(len(f.data)))
+		buf.WriteString("\x61\x18\xce\x01\x40\xde\x71\x9e") // 2013-03-03
+		buf.WriteString(f.data)
+	}
+	r := &Reader{File: nopCloser{bytes.NewReader(buf.Bytes())}, Size: int64(buf.Len())}
+
+	files, err := r.ReadFilesAt(6, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	if s := strings.Join(paths, " "); s != "C/Data/Images/photo.jpg C/Data/Sounds/ring.aac evil" {
+		t.Errorf("got paths %s", s)
+	}
+	if files[0].Size != 4 || files[0].ModTime.Year() != 2013 {
+		t.Errorf("got file %+v", files[0])
+	}
+
+	fs := NewFS(r, files)
+	f, err := fs.Open("/C/Data/Sounds/ring.aac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil || string(data) != "AAC data" {
+		t.Errorf("got %q, %v", data, err)
+	}
+	if fi, _ := f.Stat(); fi.ModTime().Before(time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong mtime %s", fi.ModTime())
+	}
+	dir, err := fs.Open("/C/Data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := dir.Readdir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range entries {
+		names = append(names, fi.Name())
+	}
+	if s := strings.Join(names, " "); s != "Images Sounds" {
+		t.Errorf("got entries %s", s)
+	}
+}
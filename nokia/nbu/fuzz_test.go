@@ -0,0 +1,76 @@
+//go:build go1.18
+// +build go1.18
+
+package nbu
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+func FuzzReader(f *testing.F) {
+	var archive memFile
+	w, err := NewWriter(&archive, FileInfo{IMEI: "351234567890123", Model: "RM-356"})
+	if err != nil {
+		f.Fatal(err)
+	}
+	w.AddMessages("Inbox", []nbf.SMS{{Peer: "+33612345678", Text: "Hello", Read: true}})
+	w.AddContacts("Phone", []Contact{{ID: 1, FullName: "Jean Dupont"}})
+	w.AddGroups("Groups", []Group{{ID: 1, Name: "Family", Members: []uint32{1}}})
+	w.AddBookmarks("Bookmarks", []Bookmark{{Title: "Go", URL: "https://golang.org/"}})
+	w.AddCalendar([]CalendarEntry{{Summary: "Lunch", Categories: []string{"MEETING"},
+		Start: time.Date(2013, 3, 4, 12, 0, 0, 0, time.UTC)}})
+	w.AddMemos([]Memo{{Text: "Buy milk"}})
+	w.AddFile(File{Path: "C/Data/hello.txt", Size: 5}, strings.NewReader("hello"))
+	if err := w.Close(); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(archive.data)
+	f.Add(archive.data[:len(archive.data)/2])
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		check := func(err error) {
+			if _, ok := err.(*FormatError); err != nil && !ok {
+				t.Errorf("got error %#v, expected a FormatError", err)
+			}
+		}
+		r := &Reader{File: nopCloser{bytes.NewReader(data)}, Size: int64(len(data))}
+		info, err := r.Info()
+		if check(err); err != nil {
+			return
+		}
+		for _, sec := range info.Sections {
+			switch sec.Type {
+			case SecFS:
+				_, err = r.ReadFilesAt(sec.FileTable, sec.Items)
+				check(err)
+			case SecCalendar:
+				_, err = r.ReadCalendarAt(sec.Offset, sec.Items)
+				check(err)
+			case SecMemo:
+				_, err = r.ReadMemosAt(sec.Offset, sec.Items)
+				check(err)
+			}
+			for _, off := range sec.Folders {
+				switch sec.Type {
+				case SecContacts:
+					_, _, err = r.ReadContactFolderAt(off)
+				case SecGroups:
+					_, _, err = r.ReadGroupFolderAt(off)
+				case SecMessages:
+					_, _, err = r.ReadMessageFolderAt(off)
+				case SecMMS:
+					_, _, err = r.ReadMMSFolderAt(off)
+				case SecBookmarks:
+					_, _, err = r.ReadBookmarkFolderAt(off)
+				}
+				check(err)
+			}
+		}
+	})
+}
@@ -1,8 +1,12 @@
 package nbu
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"log"
 	"os"
 	"time"
 	"unicode/utf16"
@@ -49,9 +53,12 @@ type Section struct {
 	Offset int64
 	Length int64
 
-	// For memos, calendar
+	// For memos, calendar, internal files
 	Items int64
 
+	// For internal files
+	FileTable int64 // offset of the first file
+
 	// For messages
 	Folders map[int]int64 // idx => offset
 }
@@ -65,107 +72,152 @@ func (r *Reader) Info() (info FileInfo, err error) {
 	// Find TOC offset.
 	_, err = r.File.ReadAt(buf[:], 0x14)
 	if err != nil {
-		return
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return info, &FormatError{Offset: 0x14, Err: err}
 	}
 	off := int64(binary.LittleEndian.Uint64(buf[:]))
 	// Read metadata.
 	debugf("TOC offset: %x", off)
-	sec := io.NewSectionReader(r.File, off+0x14, r.Size-off-0x14)
+	sec, err := r.section(off + 0x14)
+	if err != nil {
+		return
+	}
+	defer func() { err = errorAt(sec, off+0x14, err) }()
 	info.BackupTime, err = readTime(sec)
 	for _, s := range []*string{&info.IMEI, &info.Model, &info.Name, &info.Firmware, &info.Language} {
 		if err == nil {
 			*s, err = readString(sec)
 		}
 	}
+	if err != nil {
+		return
+	}
 	// skip 20 bytes.
-	sec.Seek(0x14, os.SEEK_CUR)
+	if _, err = io.ReadFull(sec, make([]byte, 0x14)); err != nil {
+		return
+	}
 	// here begin the TOC.
-	_, err = sec.Read(buf[:4])
+	parts, err := read32(sec)
 	if err != nil {
 		return
 	}
-	parts := binary.LittleEndian.Uint32(buf[:4])
 	for p := 0; p < int(parts); p++ {
-		var guid [2]uint64
-		err := binary.Read(sec, binary.BigEndian, &guid)
+		var section Section
+		section, err = r.readTOCEntry(sec)
 		if err != nil {
-			return info, err
+			return
 		}
-		off, err := read64(sec)
-		if err != nil {
-			return info, err
+		info.Sections = append(info.Sections, section)
+	}
+	return
+}
+
+// readTOCEntry reads the description of a section.
+func (r *Reader) readTOCEntry(sec io.Reader) (section Section, err error) {
+	var guid [2]uint64
+	err = binary.Read(sec, binary.BigEndian, &guid)
+	if err != nil {
+		return
+	}
+	off, err := read64(sec)
+	if err != nil {
+		return
+	}
+	length, err := read64(sec)
+	if err != nil {
+		return
+	}
+	typ := SecERROR
+	for i, g := range secUUID {
+		if guid == g {
+			typ = i
+		}
+	}
+	if typ == SecERROR {
+		debugf("unknown section GUID %x", guid)
+	}
+	debugf("section %x (%s) at offset %x+%x",
+		guid, secNames[typ], off, length)
+	if off > uint64(r.Size) || length > uint64(r.Size)-off {
+		return section, errBadOffset
+	}
+	section = Section{
+		Type:   typ,
+		GUID:   guid,
+		Offset: int64(off),
+		Length: int64(length),
+	}
+	switch typ {
+	case SecFS:
+		var unknown [5 * 4]byte
+		var ftable uint64
+		nFiles, err := read32(sec)
+		if err == nil {
+			_, err = io.ReadFull(sec, unknown[:])
+		}
+		if err == nil {
+			ftable, err = read64(sec) // off
 		}
-		length, err := read64(sec)
 		if err != nil {
-			return info, err
+			return section, err
 		}
-		typ := SecERROR
-		for i, g := range secUUID {
-			if guid == g {
-				typ = i
-			}
+		debugf("%d files at %x", nFiles, ftable)
+		if ftable > uint64(r.Size) {
+			return section, errBadOffset
 		}
-		if typ == SecERROR {
-			debugf("unknown section GUID %x", guid)
+		section.Items = int64(nFiles)
+		section.FileTable = int64(ftable)
+
+	case SecContacts,
+		SecGroups,
+		SecMessages,
+		SecMMS,
+		SecBookmarks:
+		nItems, err := read32(sec) // files
+		if err != nil {
+			return section, err
 		}
-		debugf("section %x (%s) at offset %x+%x",
-			guid, secNames[typ], off, length)
-		section := Section{
-			Type:   typ,
-			GUID:   guid,
-			Offset: int64(off),
-			Length: int64(length),
+		section.Items = int64(nItems)
+		nFolder, err := read32(sec) // folders
+		if err != nil {
+			return section, err
 		}
-		switch typ {
-		case SecFS:
-			nFiles, _ := read32(sec)
-			read32(sec)           // ?
-			read32(sec)           // ?
-			read32(sec)           // ?
-			read32(sec)           // ?
-			read32(sec)           // ?
-			off, _ := read64(sec) // off
-			_, _ = nFiles, off
-		case SecContacts:
-			nItems, _ := read32(sec) // files
-			section.Items = int64(nItems)
-			nFolder, _ := read32(sec) // folders
-			section.Folders = make(map[int]int64, nFolder)
-			for i := 0; i < int(nFolder); i++ {
-				idx, _ := read32(sec) // idx
-				off, _ := read64(sec) // off
-				debugf("folder %d at %x", idx, off)
-				section.Folders[int(idx)] = int64(off)
+		section.Folders = make(map[int]int64)
+		for i := 0; i < int(nFolder); i++ {
+			idx, err := read32(sec) // idx
+			if err != nil {
+				return section, err
 			}
-
-		case SecGroups,
-			SecMessages,
-			SecMMS,
-			SecBookmarks:
-			nItems, _ := read32(sec) // files
-			section.Items = int64(nItems)
-			nFolder, _ := read32(sec) // folders
-			section.Folders = make(map[int]int64, nFolder)
-			for i := 0; i < int(nFolder); i++ {
-				idx, _ := read32(sec) // idx
-				off, _ := read64(sec) // off
-				debugf("folder %d at %x", idx, off)
-				section.Folders[int(idx)] = int64(off)
+			off, err := read64(sec) // off
+			if err != nil {
+				return section, err
 			}
+			debugf("folder %d at %x", idx, off)
+			if off > uint64(r.Size) {
+				return section, errBadOffset
+			}
+			section.Folders[int(idx)] = int64(off)
+		}
 
-		case SecCalendar, SecMemo:
-			nbMemos, _ := read64(sec)
-			debugf("%d memos", nbMemos)
-			section.Items = int64(nbMemos)
-
-		case SecSettingsContacts,
-			SecSettingsCalendar:
-			_, _ = read32(sec)
-			_, _ = read32(sec)
+	case SecCalendar, SecMemo:
+		nbMemos, err := read64(sec)
+		if err != nil {
+			return section, err
 		}
-		info.Sections = append(info.Sections, section)
+		debugf("%d memos", nbMemos)
+		if nbMemos > uint64(r.Size) {
+			// each item takes at least one byte.
+			return section, errTooLong
+		}
+		section.Items = int64(nbMemos)
+
+	case SecSettingsContacts,
+		SecSettingsCalendar:
+		_, err = io.ReadFull(sec, make([]byte, 8))
 	}
-	return
+	return section, err
 }
 
 const (
@@ -210,85 +262,113 @@ var secNames = [...]string{
 	SecERROR:            "ERROR",
 }
 
-func (r *Reader) ReadMessageFolderAt(off int64) (title string, messages []string, err error) {
-	sr := io.NewSectionReader(r.File, off, r.Size-off)
-	return parseMessageFolder(sr)
-}
-
 func (r *Reader) ReadMMSFolderAt(off int64) (title string, messages [][]byte, err error) {
-	sr := io.NewSectionReader(r.File, off, r.Size-off)
-	return parseMMSFolder(sr)
-}
-
-func parseMessageFolder(r io.Reader) (title string, messages []string, err error) {
-	_, err = read32(r) // folder id.
-	title, err = readString(r)
+	sr, err := r.section(off)
 	if err != nil {
 		return
 	}
-	nMsg, err := read32(r)
-	messages = make([]string, 0, nMsg)
-	for i := 0; i < int(nMsg); i++ {
-		// FIXME: check errors.
-		read32(r) // skip
-		read32(r) // skip
-		msg, err := readLongString(r)
-		messages = append(messages, msg)
-		if err == io.EOF {
-			if i+1 != int(nMsg) {
-				err = io.ErrUnexpectedEOF
-			} else {
-				err = nil
-			}
-		}
-	}
-	return
+	title, messages, err = parseMMSFolder(sr)
+	return title, messages, errorAt(sr, off, err)
 }
 
 func parseMMSFolder(r io.Reader) (title string, messages [][]byte, err error) {
-	var buf [8]byte
-	_, err = read32(r) // folder id.
-	title, err = readString(r)
+	title, nMsg, err := readFolderHeader(r)
 	if err != nil {
 		return
 	}
-	nMsg, err := read32(r)
-	messages = make([][]byte, 0, nMsg)
+	var buf [20]byte
 	for i := 0; i < int(nMsg); i++ {
-		// FIXME: check errors.
-		read32(r) // 0x2c
-		read32(r) // 0x1500
+		// 0x2c, 0x1500, then an unknown byte and two words.
+		_, err = io.ReadFull(r, buf[:17])
 		// addresses
-		r.Read(buf[:1])
-		read32(r)
-		read32(r)
-		readString(r)
-		read32(r) // 0
-		read64(r) // ?
-		read64(r) // ?
-		length, err := read32(r)
-		if err != nil {
-			return title, messages, err
+		if err == nil {
+			_, err = readString(r)
 		}
-		data := make([]byte, length)
-		_, err = io.ReadFull(r, data)
-		messages = append(messages, data)
-		if err == io.EOF {
-			if i+1 != int(nMsg) {
-				err = io.ErrUnexpectedEOF
-			} else {
-				err = nil
-			}
+		// 0 and two unknown 64-bit words.
+		if err == nil {
+			_, err = io.ReadFull(r, buf[:20])
+		}
+		var data []byte
+		if err == nil {
+			data, err = readBlob(r)
 		}
 		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
 			return title, messages, err
 		}
+		messages = append(messages, data)
 	}
-	return
+	return title, messages, nil
 }
 
 // Utility functions.
 
+var DEBUG = false
+
+func debugf(format string, args ...interface{}) {
+	if DEBUG {
+		log.Printf(format, args...)
+	}
+}
+
+// A FormatError reports invalid data in an archive.
+type FormatError struct {
+	Offset int64 // offset in the archive, near the invalid data.
+	Err    error
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("nbu: %s at offset %#x", e.Err, e.Offset)
+}
+
+// Unwrap returns the underlying error.
+func (e *FormatError) Unwrap() error { return e.Err }
+
+var (
+	errBadOffset = errors.New("offset out of range")
+	errTooLong   = errors.New("length exceeds archive size")
+)
+
+// section returns a reader for archive data from off to the end.
+func (r *Reader) section(off int64) (*io.SectionReader, error) {
+	if off < 0 || off > r.Size {
+		return nil, &FormatError{Offset: off, Err: errBadOffset}
+	}
+	return io.NewSectionReader(r.File, off, r.Size-off), nil
+}
+
+// errorAt turns an error that occurred while reading sr, which
+// starts at offset base, into a FormatError.
+func errorAt(sr *io.SectionReader, base int64, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*FormatError); ok {
+		return err
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	pos, _ := sr.Seek(0, os.SEEK_CUR)
+	return &FormatError{Offset: base + pos, Err: err}
+}
+
+// readFolderHeader reads the folder id, title and item count.
+func readFolderHeader(r io.Reader) (title string, n uint32, err error) {
+	_, err = read32(r) // folder id.
+	if err != nil {
+		return
+	}
+	title, err = readString(r)
+	if err != nil {
+		return
+	}
+	n, err = read32(r)
+	return
+}
+
 // From MSDN: "A Windows file time is a 64-bit value that represents the number
 // of 100-nanosecond intervals that have elapsed since 12:00 midnight, January
 // 1, 1601 A.D. (C.E.) Coordinated Universal Time (UTC)."
@@ -322,21 +402,48 @@ func readString(r io.Reader) (string, error) {
 		return "", err
 	}
 	length := int(buf[1])<<8 | int(buf[0])
-	s := make([]uint16, length)
-	err = binary.Read(r, binary.LittleEndian, s)
-	return string(utf16.Decode(s)), err
+	data, err := readData(r, 2*int64(length))
+	return decodeUTF16(data), err
 }
 
 func readLongString(r io.Reader) (string, error) {
 	// Little endian 32 bit byte length + UTF-16LE string.
-	var length uint32
-	err := binary.Read(r, binary.LittleEndian, &length)
+	length, err := read32(r)
 	if err != nil {
 		return "", err
 	}
-	s := make([]uint16, length/2)
-	err = binary.Read(r, binary.LittleEndian, s)
-	return string(utf16.Decode(s)), err
+	data, err := readData(r, int64(length&^1))
+	return decodeUTF16(data), err
+}
+
+// readData reads n bytes. The length is checked against the
+// remaining size of section readers, and other readers fill a
+// growing buffer, so that a corrupted length cannot cause a huge
+// allocation.
+func readData(r io.Reader, n int64) ([]byte, error) {
+	if sr, ok := r.(*io.SectionReader); ok {
+		pos, _ := sr.Seek(0, os.SEEK_CUR)
+		if n > sr.Size()-pos {
+			return nil, errTooLong
+		}
+		data := make([]byte, n)
+		_, err := io.ReadFull(sr, data)
+		return data, err
+	}
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, r, n)
+	if err == io.EOF && buf.Len() > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), err
+}
+
+func decodeUTF16(data []byte) string {
+	s := make([]uint16, len(data)/2)
+	for i := range s {
+		s[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(s))
 }
 
 func read32(r io.Reader) (uint32, error) {
@@ -1,10 +1,14 @@
 package nbu
 
 import (
+	"bytes"
+	"encoding/binary"
 	"flag"
 	"io"
+	"reflect"
 	"strings"
 	"testing"
+	"unicode/utf16"
 )
 
 func TestReadTime(t *testing.T) {
@@ -30,14 +34,95 @@ func TestReadString(t *testing.T) {
 	}
 }
 
-var path = flag.String("input", "", "input file for testing")
+func TestDecodeText(t *testing.T) {
+	utf16le := func(s string) string {
+		var b []byte
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = append(b, byte(u), byte(u>>8))
+		}
+		return string(b)
+	}
+	for _, text := range []string{
+		"BEGIN:VNOTE",
+		"Арбуз",
+		"А",
+		"中文备忘录",
+		"Καλημέρα",
+	} {
+		if s := decodeText([]byte(utf16le(text))); s != text {
+			t.Errorf("UTF-16 %q: got %q", text, s)
+		}
+		if s := decodeText([]byte("\xff\xfe" + utf16le(text))); s != text {
+			t.Errorf("UTF-16 with BOM %q: got %q", text, s)
+		}
+	}
+	for _, text := range []string{"BEGIN:VNOTE\r\n", "Café", "Арбуз", "中文"} {
+		if s := decodeText([]byte(text)); s != text {
+			t.Errorf("UTF-8 %q: got %q", text, s)
+		}
+		if s := decodeText([]byte("\xef\xbb\xbf" + text)); s != text {
+			t.Errorf("UTF-8 with BOM %q: got %q", text, s)
+		}
+	}
+}
+
+func TestParseContactFolder(t *testing.T) {
+	const card = "BEGIN:VCARD\r\nVERSION:2.1\r\n" +
+		"N:Dupont;Jean;;;\r\n" +
+		"FN:Jean Dupont\r\n" +
+		"TEL;CELL;PREF:+33612345678\r\n" +
+		"TEL;TYPE=HOME:+33123456789\r\n" +
+		"EMAIL;INTERNET:jean@example.com\r\n" +
+		"ADR;HOME:;;1 rue de la Paix;Paris;;75002;France\r\n" +
+		"NOTE;ENCODING=QUOTED-PRINTABLE;CHARSET=UTF-8:Caf=C3=A9 =\r\ncr=C3=A8me\r\n" +
+		"PHOTO;TYPE=JPEG;ENCODING=BASE64:\r\n /9j/\r\n 4AA=\r\n\r\n" +
+		"END:VCARD\r\n"
+	var buf bytes.Buffer
+	title := utf16.Encode([]rune("Phone"))
+	binary.Write(&buf, binary.LittleEndian, uint32(1))
+	binary.Write(&buf, binary.LittleEndian, uint16(len(title)))
+	binary.Write(&buf, binary.LittleEndian, title)
+	binary.Write(&buf, binary.LittleEndian, uint32(1))
+	binary.Write(&buf, binary.LittleEndian, [2]uint32{7, 0})
+	text := utf16.Encode([]rune(card))
+	binary.Write(&buf, binary.LittleEndian, uint32(2*len(text)))
+	binary.Write(&buf, binary.LittleEndian, text)
+
+	name, contacts, err := parseContactFolder(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Phone" || len(contacts) != 1 {
+		t.Fatalf("got folder %q with %d contacts", name, len(contacts))
+	}
+	expected := Contact{
+		ID:       7,
+		FullName: "Jean Dupont",
+		Name:     Name{Family: "Dupont", Given: "Jean"},
+		Tel: []TypedValue{
+			{Type: []string{"CELL", "PREF"}, Value: "+33612345678"},
+			{Type: []string{"HOME"}, Value: "+33123456789"},
+		},
+		Email: []TypedValue{{Type: []string{"INTERNET"}, Value: "jean@example.com"}},
+		Address: []Address{{Type: []string{"HOME"}, Street: "1 rue de la Paix",
+			Locality: "Paris", PostalCode: "75002", Country: "France"}},
+		Note:      "Café crème",
+		Photo:     []byte{0xff, 0xd8, 0xff, 0xe0, 0},
+		PhotoType: "JPEG",
+	}
+	if !reflect.DeepEqual(contacts[0], expected) {
+		t.Errorf("got %+v\nexpected %+v", contacts[0], expected)
+	}
+}
+
+var inputFile = flag.String("input", "", "input file for testing")
 
 func TestFile(t *testing.T) {
-	if *path == "" {
+	if *inputFile == "" {
 		t.Logf("skipping since no input file specified")
 		return
 	}
-	r, err := OpenFile(*path)
+	r, err := OpenFile(*inputFile)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -64,8 +149,8 @@ func TestFile(t *testing.T) {
 				t.Logf("Folder %d %q", id, title)
 				t.Logf("%d messages", len(msgs))
 				if len(msgs) > 0 {
-					t.Logf("First message: %s", msgs[0])
-					t.Logf("Last message: %s", msgs[len(msgs)-1])
+					t.Logf("First message: %+v", msgs[0])
+					t.Logf("Last message: %+v", msgs[len(msgs)-1])
 				}
 			}
 		}
@@ -87,3 +172,46 @@ func TestFile(t *testing.T) {
 		}
 	}
 }
+
+// memFile is an in-memory io.WriteSeeker.
+type memFile struct {
+	data []byte
+	off  int64
+}
+
+func (f *memFile) Write(b []byte) (int, error) {
+	if end := int(f.off) + len(b); end > len(f.data) {
+		f.data = append(f.data, make([]byte, end-len(f.data))...)
+	}
+	n := copy(f.data[f.off:], b)
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Seek(off int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		off += f.off
+	case io.SeekEnd:
+		off += int64(len(f.data))
+	}
+	f.off = off
+	return off, nil
+}
+
+func TestFormatError(t *testing.T) {
+	// a folder whose title claims 0xffff characters.
+	data := []byte("\x01\x00\x00\x00\xff\xffabcd")
+	r := &Reader{File: nopCloser{bytes.NewReader(data)}, Size: int64(len(data))}
+	_, _, err := r.ReadMessageFolderAt(0)
+	if e, ok := err.(*FormatError); !ok || e.Err != errTooLong || e.Offset != 6 {
+		t.Errorf("got error %v", err)
+	}
+	_, _, err = r.ReadMessageFolderAt(100)
+	if e, ok := err.(*FormatError); !ok || e.Err != errBadOffset {
+		t.Errorf("got error %v", err)
+	}
+	if _, err = r.Info(); err == nil {
+		t.Errorf("expected error for truncated header")
+	}
+}
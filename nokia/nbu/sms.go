@@ -0,0 +1,273 @@
+package nbu
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/vobject"
+)
+
+// Messages are stored as vMessage documents:
+//
+//	BEGIN:VMSG
+//	VERSION:1.1
+//	X-IRMC-STATUS:READ
+//	X-IRMC-BOX:INBOX
+//	BEGIN:VCARD       originator
+//	VERSION:2.1
+//	N:name
+//	TEL:+33612345678
+//	END:VCARD
+//	BEGIN:VENV
+//	BEGIN:VCARD       recipients (optional)
+//	...
+//	END:VCARD
+//	BEGIN:VENV
+//	BEGIN:VBODY
+//	Date:03.03.2013 22:51:18
+//	text
+//	END:VBODY
+//	END:VENV
+//	END:VENV
+//	END:VMSG
+//
+// The body may also be a hex-encoded PDU.
+
+// ReadMessageFolderAt reads the SMS folder at offset off.
+func (r *Reader) ReadMessageFolderAt(off int64) (title string, messages []nbf.SMS, err error) {
+	sr, err := r.section(off)
+	if err != nil {
+		return
+	}
+	title, messages, err = parseMessageFolder(sr)
+	return title, messages, errorAt(sr, off, err)
+}
+
+// parseMessageFolder decodes the messages of a folder. Invalid
+// vMessages are skipped and reported after the other messages
+// are decoded.
+func parseMessageFolder(r io.Reader) (title string, messages []nbf.SMS, err error) {
+	title, nMsg, err := readFolderHeader(r)
+	if err != nil {
+		return
+	}
+	var bad []int
+	var badErr error
+	for i := 0; i < int(nMsg); i++ {
+		var raw string
+		_, err = read32(r) // skip
+		if err == nil {
+			_, err = read32(r) // skip
+		}
+		if err == nil {
+			raw, err = readLongString(r)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return title, messages, err
+		}
+		msg, err := parseVMessage(raw)
+		if err != nil {
+			debugf("message %d in folder %q: %s", i+1, title, err)
+			if badErr == nil {
+				badErr = err
+			}
+			bad = append(bad, i+1)
+			continue
+		}
+		msg.Folder = title
+		messages = append(messages, msg)
+	}
+	if len(bad) > 0 {
+		return title, messages, fmt.Errorf("%d invalid messages in folder %q, message %d: %s",
+			len(bad), title, bad[0], badErr)
+	}
+	return title, messages, nil
+}
+
+// parseVMessage decodes a vMessage.
+func parseVMessage(s string) (msg nbf.SMS, err error) {
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "BEGIN:VMSG" {
+		return msg, fmt.Errorf("not a vMessage")
+	}
+	msg.Read = true
+	var stack []string // nested objects.
+	var from string    // originator number.
+	var peers, tels []string
+	var body []string
+	var tel, name string
+	for _, l := range lines[1:] {
+		// in the body, only END:VBODY is structure.
+		inBody := len(stack) > 0 && stack[len(stack)-1] == "VBODY"
+		if inBody && strings.TrimSpace(l) != "END:VBODY" {
+			if strings.HasPrefix(l, "Date:") && len(body) == 0 && msg.When.IsZero() {
+				if t, err := parseMessageDate(strings.TrimSpace(l[len("Date:"):])); err == nil {
+					msg.When = t
+					continue
+				}
+			}
+			body = append(body, l)
+			continue
+		}
+		switch {
+		case strings.HasPrefix(l, "BEGIN:"):
+			stack = append(stack, strings.TrimSpace(l[len("BEGIN:"):]))
+			tel, name = "", ""
+			continue
+		case strings.HasPrefix(l, "END:"):
+			obj := strings.TrimSpace(l[len("END:"):])
+			if len(stack) == 0 {
+				if obj != "VMSG" {
+					return msg, fmt.Errorf("unexpected END:%s", obj)
+				}
+				finishMessage(&msg, from, peers, tels, body)
+				return msg, nil
+			}
+			if obj != stack[len(stack)-1] {
+				return msg, fmt.Errorf("unexpected END:%s in %s", obj, stack[len(stack)-1])
+			}
+			stack = stack[:len(stack)-1]
+			if obj == "VCARD" {
+				// the first card is the originator, others are
+				// recipients.
+				if len(stack) == 0 {
+					from = tel
+				} else if tel != "" || name != "" {
+					peers = append(peers, formatPeer(tel, name))
+					tels = append(tels, tel)
+				}
+			}
+			continue
+		}
+		colon := strings.IndexByte(l, ':')
+		if colon < 0 {
+			continue
+		}
+		key, value := strings.ToUpper(l[:colon]), strings.TrimSpace(l[colon+1:])
+		if semi := strings.IndexByte(key, ';'); semi >= 0 {
+			key = key[:semi]
+		}
+		switch key {
+		case "X-IRMC-STATUS":
+			msg.Read = strings.ToUpper(value) != "UNREAD"
+		case "X-IRMC-BOX":
+			if strings.ToUpper(value) == "INBOX" {
+				msg.Type = 0
+			} else {
+				msg.Type = 1
+			}
+		case "TEL":
+			tel = value
+		case "N", "FN":
+			if name == "" {
+				name = strings.TrimSpace(strings.Join(vobject.SplitValue(value), " "))
+			}
+		}
+	}
+	return msg, fmt.Errorf("missing END:VMSG")
+}
+
+func finishMessage(msg *nbf.SMS, from string, peers, tels, body []string) {
+	msg.Text = strings.Join(body, "\n")
+	if isPDU(msg.Text) {
+		pdu, _ := hex.DecodeString(msg.Text)
+		if sms, err := nbf.DecodePDU(pdu); err == nil {
+			msg.Text = sms.Text
+			if from == "" && sms.Type == 0 {
+				from = sms.Peer
+			}
+			if msg.When.IsZero() {
+				msg.When = sms.When
+			}
+		}
+	}
+	if msg.Type == 0 {
+		msg.Peer = from
+	} else {
+		msg.Peers = peers
+		if len(tels) > 0 {
+			msg.Peer = tels[0]
+		}
+	}
+}
+
+// isPDU reports whether a message body looks like a hex-encoded
+// PDU rather than text.
+func isPDU(s string) bool {
+	if len(s) < 24 || len(s)%2 != 0 {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func formatPeer(tel, name string) string {
+	if name == "" || name == tel {
+		return tel
+	}
+	return fmt.Sprintf("%s <%s>", tel, name)
+}
+
+// parseMessageDate parses dates such as 03.03.2013 22:51:18,
+// in local time.
+func parseMessageDate(s string) (time.Time, error) {
+	for _, layout := range []string{"02.01.2006 15:04:05", "20060102T150405"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// formatVMessage formats a message as a vMessage document.
+func formatVMessage(m nbf.SMS) string {
+	buf := new(bytes.Buffer)
+	buf.WriteString("BEGIN:VMSG\r\nVERSION:1.1\r\n")
+	if m.Read {
+		buf.WriteString("X-IRMC-STATUS:READ\r\n")
+	} else {
+		buf.WriteString("X-IRMC-STATUS:UNREAD\r\n")
+	}
+	from, to := "", m.Peers
+	if m.Type == 0 {
+		buf.WriteString("X-IRMC-BOX:INBOX\r\n")
+		from, to = m.Peer, nil
+	} else {
+		buf.WriteString("X-IRMC-BOX:SENT\r\n")
+		if len(to) == 0 && m.Peer != "" {
+			to = []string{m.Peer}
+		}
+	}
+	buf.WriteString("BEGIN:VCARD\r\nVERSION:2.1\r\nN:\r\nTEL:" + from + "\r\nEND:VCARD\r\n")
+	buf.WriteString("BEGIN:VENV\r\n")
+	for _, peer := range to {
+		// peers are formatted as "number <name>".
+		tel, name := peer, ""
+		if i := strings.Index(peer, " <"); i >= 0 && strings.HasSuffix(peer, ">") {
+			tel, name = peer[:i], peer[i+2:len(peer)-1]
+		}
+		buf.WriteString("BEGIN:VCARD\r\nVERSION:2.1\r\nN:" + vobject.JoinValue(name) +
+			"\r\nTEL:" + tel + "\r\nEND:VCARD\r\n")
+	}
+	buf.WriteString("BEGIN:VENV\r\nBEGIN:VBODY\r\n")
+	if !m.When.IsZero() {
+		buf.WriteString("Date:" + m.When.Local().Format("02.01.2006 15:04:05") + "\r\n")
+	}
+	if m.Text != "" {
+		buf.WriteString(strings.Replace(m.Text, "\n", "\r\n", -1) + "\r\n")
+	}
+	buf.WriteString("END:VBODY\r\nEND:VENV\r\nEND:VENV\r\nEND:VMSG\r\n")
+	return buf.String()
+}
@@ -0,0 +1,110 @@
+package nbu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func TestParseVMessage(t *testing.T) {
+	const in = `BEGIN:VMSG
+VERSION:1.1
+X-IRMC-STATUS:UNREAD
+X-IRMC-BOX:INBOX
+BEGIN:VCARD
+VERSION:2.1
+N:
+TEL:+33612345678
+END:VCARD
+BEGIN:VENV
+BEGIN:VENV
+BEGIN:VBODY
+Date:03.03.2013 22:51:18
+Hello,
+see you tomorrow
+END:VBODY
+END:VENV
+END:VENV
+END:VMSG
+`
+	msg, err := parseVMessage(strings.Replace(in, "\n", "\r\n", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	when := time.Date(2013, 3, 3, 22, 51, 18, 0, time.Local)
+	if msg.Type != 0 || msg.Read || msg.Peer != "+33612345678" || !msg.When.Equal(when) {
+		t.Errorf("got %+v", msg)
+	}
+	if msg.Text != "Hello,\nsee you tomorrow" {
+		t.Errorf("got text %q", msg.Text)
+	}
+
+	const out = `BEGIN:VMSG
+VERSION:1.1
+X-IRMC-STATUS:READ
+X-IRMC-BOX:SENT
+BEGIN:VCARD
+VERSION:2.1
+N:
+TEL:
+END:VCARD
+BEGIN:VENV
+BEGIN:VCARD
+VERSION:2.1
+N:Dupont;Jean
+TEL:+33698765432
+END:VCARD
+BEGIN:VENV
+BEGIN:VBODY
+Date:04.03.2013 08:00:00
+OK
+END:VBODY
+END:VENV
+END:VENV
+END:VMSG
+`
+	msg, err = parseVMessage(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != 1 || !msg.Read || msg.Peer != "+33698765432" ||
+		len(msg.Peers) != 1 || msg.Peers[0] != "+33698765432 <Dupont Jean>" || msg.Text != "OK" {
+		t.Errorf("got %+v", msg)
+	}
+
+	if _, err := parseVMessage("BEGIN:VMSG\nBEGIN:VBODY\nhello\n"); err == nil {
+		t.Errorf("expected error for truncated message")
+	}
+}
+
+func TestParseMessageFolder(t *testing.T) {
+	// bodies may contain lines looking like structure,
+	// or an unexpected date.
+	const good = "BEGIN:VMSG\r\nX-IRMC-BOX:INBOX\r\nBEGIN:VCARD\r\nTEL:+33612345678\r\nEND:VCARD\r\n" +
+		"BEGIN:VENV\r\nBEGIN:VENV\r\nBEGIN:VBODY\r\nDate:tomorrow\r\nBEGIN:hi\r\nEND:VMSG\r\n" +
+		"END:VBODY\r\nEND:VENV\r\nEND:VENV\r\nEND:VMSG\r\n"
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(1))
+	writeTestString(&buf, "Inbox")
+	binary.Write(&buf, binary.LittleEndian, uint32(3))
+	for _, m := range []string{good, "BEGIN:VMSG\r\nEND:VCARD\r\n", good} {
+		binary.Write(&buf, binary.LittleEndian, [2]uint32{})
+		text := utf16.Encode([]rune(m))
+		binary.Write(&buf, binary.LittleEndian, uint32(2*len(text)))
+		binary.Write(&buf, binary.LittleEndian, text)
+	}
+
+	title, msgs, err := parseMessageFolder(&buf)
+	if err == nil {
+		t.Errorf("expected error for invalid message")
+	}
+	if title != "Inbox" || len(msgs) != 2 {
+		t.Fatalf("got folder %q with %d messages", title, len(msgs))
+	}
+	if m := msgs[1]; m.Peer != "+33612345678" || m.Text != "Date:tomorrow\nBEGIN:hi\nEND:VMSG" {
+		t.Errorf("got %+v", m)
+	}
+}
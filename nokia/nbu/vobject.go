@@ -0,0 +1,43 @@
+package nbu
+
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+// readBlob reads a 32-bit byte length followed by data.
+func readBlob(r io.Reader) ([]byte, error) {
+	length, err := read32(r)
+	if err != nil {
+		return nil, err
+	}
+	return readData(r, int64(length))
+}
+
+// decodeText decodes text items, which are UTF-16LE text, possibly
+// starting with a byte order mark, or UTF-8 if data does not look
+// like UTF-16.
+func decodeText(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		return decodeUTF16(data[2:])
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		return string(data[3:])
+	case len(data)%2 == 0 && !looksUTF8(data):
+		return decodeUTF16(data)
+	}
+	return string(data)
+}
+
+// looksUTF8 reports whether data is valid UTF-8 without NUL or
+// control characters, which are frequent in UTF-16 text: they are
+// the high bytes of ASCII, Greek or Cyrillic characters.
+func looksUTF8(data []byte) bool {
+	for _, c := range data {
+		if c < 0x20 && c != '\t' && c != '\r' && c != '\n' {
+			return false
+		}
+	}
+	return utf8.Valid(data)
+}
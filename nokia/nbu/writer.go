@@ -0,0 +1,322 @@
+package nbu
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+	"github.com/remyoudompheng/go-misc/nokia/vobject"
+)
+
+// A Writer writes a NBU archive. Items are written in sections,
+// in the order of calls: consecutive calls for the same kind of
+// items are grouped in a single section.
+//
+// The archive is laid out as follows: a header pointing to the
+// TOC, sections (each starting with its GUID) and the TOC,
+// holding archive metadata and the list of sections.
+type Writer struct {
+	w        io.WriteSeeker
+	info     FileInfo
+	off      int64
+	sections []Section
+	cur      *Section // the section being written, or nil.
+	err      error
+}
+
+// NewWriter starts writing a NBU archive to w. The metadata of
+// info is written to the archive, its sections are ignored.
+func NewWriter(w io.WriteSeeker, info FileInfo) (*Writer, error) {
+	wr := &Writer{w: w, info: info}
+	// unknown 20 bytes, then TOC offset.
+	wr.write(make([]byte, 0x14))
+	wr.write64(0)
+	return wr, wr.err
+}
+
+var errWriterClosed = errors.New("nbu: writer is closed")
+
+// AddContacts writes a folder of contacts.
+func (w *Writer) AddContacts(title string, contacts []Contact) error {
+	w.folder(SecContacts, title, len(contacts))
+	for _, c := range contacts {
+		w.write32(c.ID)
+		w.write32(0)
+		w.writeText(vobject.FormatVCard(c))
+	}
+	return w.err
+}
+
+// AddGroups writes a folder of contact groups.
+func (w *Writer) AddGroups(title string, groups []Group) error {
+	w.folder(SecGroups, title, len(groups))
+	for _, g := range groups {
+		w.write32(g.ID)
+		w.writeString(g.Name)
+		w.write32(uint32(len(g.Members)))
+		for _, id := range g.Members {
+			w.write32(id)
+		}
+	}
+	return w.err
+}
+
+// AddMessages writes a folder of SMS.
+func (w *Writer) AddMessages(title string, messages []nbf.SMS) error {
+	w.folder(SecMessages, title, len(messages))
+	for _, m := range messages {
+		w.write32(0)
+		w.write32(0)
+		w.writeText(formatVMessage(m))
+	}
+	return w.err
+}
+
+// AddBookmarks writes a folder of bookmarks.
+func (w *Writer) AddBookmarks(title string, bookmarks []Bookmark) error {
+	w.folder(SecBookmarks, title, len(bookmarks))
+	for _, b := range bookmarks {
+		w.write32(0)
+		w.write32(0)
+		w.writeText(vobject.FormatVBookmark(b))
+	}
+	return w.err
+}
+
+// AddCalendar writes calendar entries.
+func (w *Writer) AddCalendar(entries []CalendarEntry) error {
+	w.section(SecCalendar)
+	for _, e := range entries {
+		if w.cur != nil {
+			w.cur.Items++
+			w.write32(uint32(w.cur.Items))
+		}
+		w.writeText(vobject.FormatVCalendar(e))
+	}
+	return w.err
+}
+
+// AddMemos writes memos.
+func (w *Writer) AddMemos(memos []Memo) error {
+	w.section(SecMemo)
+	for _, m := range memos {
+		if w.cur != nil {
+			w.cur.Items++
+			w.write32(uint32(w.cur.Items))
+		}
+		w.writeText(vobject.FormatVNote(m))
+	}
+	return w.err
+}
+
+// AddFile writes f.Size bytes read from r as the internal file
+// described by f. The offset of f is ignored.
+func (w *Writer) AddFile(f File, r io.Reader) error {
+	if w.section(SecFS); w.cur != nil {
+		if w.cur.Items == 0 {
+			w.cur.FileTable = w.off
+		}
+		w.cur.Items++
+	}
+	dir, name := phonePath(f.Path)
+	w.writeString(dir)
+	w.writeString(name)
+	w.write32(0)
+	w.write64(uint64(f.Size))
+	w.writeTime(f.ModTime)
+	if w.err == nil {
+		var n int64
+		n, w.err = io.CopyN(w.w, r, f.Size)
+		w.off += n
+	}
+	return w.err
+}
+
+// phonePath splits a path such as C/Data/Sounds/ring.aac into
+// C:\Data\Sounds\ and ring.aac.
+func phonePath(p string) (dir, name string) {
+	parts := strings.Split(p, "/")
+	if len(parts[0]) == 1 && len(parts) > 1 {
+		parts[0] += ":"
+	}
+	name = parts[len(parts)-1]
+	dir = strings.Join(parts[:len(parts)-1], `\`)
+	if dir != "" {
+		dir += `\`
+	}
+	return dir, name
+}
+
+// Close finishes the archive by writing its TOC. It does not
+// close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.endSection()
+	toc := w.off
+	w.write(make([]byte, 0x14))
+	w.writeTime(w.info.BackupTime)
+	for _, s := range []string{w.info.IMEI, w.info.Model, w.info.Name, w.info.Firmware, w.info.Language} {
+		w.writeString(s)
+	}
+	w.write(make([]byte, 0x14))
+	w.write32(uint32(len(w.sections)))
+	for _, sec := range w.sections {
+		w.writeTOCEntry(sec)
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if _, err := w.w.Seek(0x14, os.SEEK_SET); err != nil {
+		return err
+	}
+	w.write64(uint64(toc))
+	if w.err == nil {
+		_, w.err = w.w.Seek(0, os.SEEK_END)
+	}
+	if w.err == nil {
+		w.err = errWriterClosed
+		return nil
+	}
+	return w.err
+}
+
+func (w *Writer) writeTOCEntry(sec Section) {
+	w.writeGUID(sec.GUID)
+	w.write64(uint64(sec.Offset))
+	w.write64(uint64(sec.Length))
+	switch sec.Type {
+	case SecFS:
+		w.write32(uint32(sec.Items))
+		w.write(make([]byte, 5*4))
+		w.write64(uint64(sec.FileTable))
+	case SecCalendar, SecMemo:
+		w.write64(uint64(sec.Items))
+	default:
+		w.write32(uint32(sec.Items))
+		w.write32(uint32(len(sec.Folders)))
+		idx := make([]int, 0, len(sec.Folders))
+		for i := range sec.Folders {
+			idx = append(idx, i)
+		}
+		sort.Ints(idx)
+		for _, i := range idx {
+			w.write32(uint32(i))
+			w.write64(uint64(sec.Folders[i]))
+		}
+	}
+}
+
+// section makes sure that a section of type typ is being written.
+func (w *Writer) section(typ int) {
+	if w.err != nil || w.cur != nil && w.cur.Type == typ {
+		return
+	}
+	w.endSection()
+	w.cur = &Section{Type: typ, GUID: secUUID[typ], Offset: w.off}
+	w.writeGUID(w.cur.GUID)
+	w.write32(0)
+}
+
+func (w *Writer) endSection() {
+	if w.cur == nil {
+		return
+	}
+	w.cur.Length = w.off - w.cur.Offset - 16
+	w.sections = append(w.sections, *w.cur)
+	w.cur = nil
+}
+
+// folder starts a new folder of n items.
+func (w *Writer) folder(typ int, title string, n int) {
+	w.section(typ)
+	if w.cur == nil {
+		return
+	}
+	if w.cur.Folders == nil {
+		w.cur.Folders = make(map[int]int64)
+	}
+	idx := len(w.cur.Folders) + 1
+	w.cur.Folders[idx] = w.off
+	w.cur.Items += int64(n)
+	w.write32(uint32(idx))
+	w.writeString(title)
+	w.write32(uint32(n))
+}
+
+// write writes b to the archive. Errors are sticky.
+func (w *Writer) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(b)
+	w.off += int64(n)
+	w.err = err
+}
+
+func (w *Writer) write32(n uint32) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], n)
+	w.write(buf[:])
+}
+
+func (w *Writer) write64(n uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], n)
+	w.write(buf[:])
+}
+
+func (w *Writer) writeGUID(guid [2]uint64) {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], guid[0])
+	binary.BigEndian.PutUint64(buf[8:], guid[1])
+	w.write(buf[:])
+}
+
+func (w *Writer) writeUTF16(u []uint16) {
+	buf := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(buf[2*i:], c)
+	}
+	w.write(buf)
+}
+
+// writeString writes a 16-bit length and UTF-16 text (see readString).
+func (w *Writer) writeString(s string) {
+	u := utf16.Encode([]rune(s))
+	if len(u) > 0xffff {
+		w.err = fmt.Errorf("nbu: string too long (%d characters)", len(u))
+		return
+	}
+	var buf [2]byte
+	binary.LittleEndian.PutUint16(buf[:], uint16(len(u)))
+	w.write(buf[:])
+	w.writeUTF16(u)
+}
+
+// writeText writes a 32-bit byte length and UTF-16 text
+// (see readLongString).
+func (w *Writer) writeText(s string) {
+	u := utf16.Encode([]rune(s))
+	w.write32(uint32(2 * len(u)))
+	w.writeUTF16(u)
+}
+
+// writeTime writes t as a Windows file time (see readTime).
+func (w *Writer) writeTime(t time.Time) {
+	var ticks uint64
+	if t.After(baseWinTime) {
+		secs := t.Unix() - baseWinTime.Unix()
+		ticks = uint64(secs)*1e7 + uint64(t.Nanosecond()/100)
+	}
+	w.write32(uint32(ticks >> 32))
+	w.write32(uint32(ticks))
+}
@@ -0,0 +1,162 @@
+package nbu
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
+)
+
+func TestWriter(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "nbu-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	when := time.Date(2013, 3, 3, 22, 51, 18, 0, time.Local)
+	info := FileInfo{
+		BackupTime: time.Date(2013, 3, 4, 10, 0, 0, 0, time.UTC),
+		IMEI:       "351234567890123",
+		Model:      "RM-356",
+		Name:       "Nokia 5800",
+		Firmware:   "V 52.0.007",
+		Language:   "fr",
+	}
+	contacts := []Contact{{
+		ID:       3,
+		FullName: "Jean Dupont",
+		Name:     Name{Family: "Dupont", Given: "Jean"},
+		Tel:      []TypedValue{{Type: []string{"CELL"}, Value: "+33612345678"}},
+		Note:     "line 1\nline 2; with semicolon",
+	}}
+	groups := []Group{{ID: 1, Name: "Family", Members: []uint32{3}}}
+	messages := []nbf.SMS{
+		{Type: 0, Peer: "+33612345678", When: when, Text: "Hello\nworld", Read: true},
+		{Type: 1, Peer: "+33698765432", Peers: []string{"+33698765432 <Marie>"}, When: when, Text: "Hi", Read: true},
+	}
+	bookmarks := []Bookmark{{Title: "Example", URL: "http://www.example.com/"}}
+	entries := []CalendarEntry{{
+		Kind:    Appointment,
+		Summary: "Meeting",
+		Start:   when,
+		End:     when.Add(time.Hour),
+		Recurrence: &Recurrence{
+			Freq: "WEEKLY", Interval: 1, Count: 4, ByDay: []string{"MO"},
+		},
+	}}
+	memos := []Memo{{Text: "Buy milk"}}
+
+	w, err := NewWriter(tmp, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.AddContacts("Phone", contacts)
+	w.AddGroups("Groups", groups)
+	w.AddMessages("Inbox", messages[:1])
+	w.AddMessages("Sent", messages[1:])
+	w.AddBookmarks("Bookmarks", bookmarks)
+	w.AddCalendar(entries)
+	w.AddMemos(memos)
+	w.AddFile(File{Path: "C/Data/hello.txt", Size: 5, ModTime: when}, strings.NewReader("hello"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddMemos(memos); err == nil {
+		t.Errorf("could write to closed writer")
+	}
+
+	r, err := OpenFile(tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := r.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.BackupTime.Equal(info.BackupTime) || got.IMEI != info.IMEI ||
+		got.Model != info.Model || got.Language != info.Language {
+		t.Errorf("got info %+v", got)
+	}
+	if len(got.Sections) != 7 {
+		t.Fatalf("got %d sections, expected 7", len(got.Sections))
+	}
+	for _, sec := range got.Sections {
+		switch sec.Type {
+		case SecContacts:
+			_, cs, err := r.ReadContactFolderAt(sec.Folders[1])
+			if err != nil || len(cs) != 1 {
+				t.Errorf("contacts: %v, %+v", err, cs)
+				continue
+			}
+			c := cs[0]
+			if c.ID != 3 || c.Name != contacts[0].Name || c.Note != contacts[0].Note ||
+				!reflect.DeepEqual(c.Tel, contacts[0].Tel) {
+				t.Errorf("got contact %+v", c)
+			}
+		case SecGroups:
+			_, gs, err := r.ReadGroupFolderAt(sec.Folders[1])
+			if err != nil || !reflect.DeepEqual(gs, groups) {
+				t.Errorf("groups: %v, %+v", err, gs)
+			}
+		case SecMessages:
+			if len(sec.Folders) != 2 || sec.Items != 2 {
+				t.Errorf("got message section %+v", sec)
+			}
+			for i, title := range []string{"Inbox", "Sent"} {
+				name, ms, err := r.ReadMessageFolderAt(sec.Folders[i+1])
+				if err != nil || name != title || len(ms) != 1 {
+					t.Errorf("messages: %v, %q, %+v", err, name, ms)
+					continue
+				}
+				m, exp := ms[0], messages[i]
+				if m.Type != exp.Type || m.Peer != exp.Peer || !m.When.Equal(exp.When) ||
+					m.Text != exp.Text || !reflect.DeepEqual(m.Peers, exp.Peers) {
+					t.Errorf("got message %+v, expected %+v", m, exp)
+				}
+			}
+		case SecBookmarks:
+			_, bs, err := r.ReadBookmarkFolderAt(sec.Folders[1])
+			if err != nil || !reflect.DeepEqual(bs, bookmarks) {
+				t.Errorf("bookmarks: %v, %+v", err, bs)
+			}
+		case SecCalendar:
+			es, err := r.ReadCalendarAt(sec.Offset, sec.Items)
+			if err != nil || len(es) != 1 {
+				t.Errorf("calendar: %v, %+v", err, es)
+				continue
+			}
+			e := es[0]
+			if e.Summary != "Meeting" || !e.Start.Equal(when) || !e.End.Equal(when.Add(time.Hour)) ||
+				e.Recurrence == nil || e.Recurrence.String() != entries[0].Recurrence.String() {
+				t.Errorf("got entry %+v (%v)", e, e.Recurrence)
+			}
+		case SecMemo:
+			ms, err := r.ReadMemosAt(sec.Offset, sec.Items)
+			if err != nil || len(ms) != 1 || ms[0].Text != "Buy milk" {
+				t.Errorf("memos: %v, %+v", err, ms)
+			}
+		case SecFS:
+			files, err := r.ReadFilesAt(sec.FileTable, sec.Items)
+			if err != nil || len(files) != 1 {
+				t.Errorf("files: %v, %+v", err, files)
+				continue
+			}
+			if files[0].Path != "C/Data/hello.txt" || !files[0].ModTime.Equal(when) {
+				t.Errorf("got file %+v", files[0])
+			}
+			data, err := ioutil.ReadAll(r.Open(files[0]))
+			if err != nil || string(data) != "hello" {
+				t.Errorf("got %q, %v", data, err)
+			}
+		default:
+			t.Errorf("unexpected section %s", secNames[sec.Type])
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/remyoudompheng/go-misc/nokia/nbu"
+)
+
+// A BookmarkFolder is a named list of bookmarks.
+type BookmarkFolder struct {
+	Title     string
+	Bookmarks []nbu.Bookmark
+}
+
+// DumpBookmarks writes bookmarks in the Netscape bookmark file
+// format, which browsers can import.
+func DumpBookmarks(folders []BookmarkFolder, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Fatalf("could not create directory %s: %s", filepath.Dir(path), err)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		log.Printf("could not create %s: %s", path, err)
+		return
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	fmt.Fprint(w, `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+`)
+	n := 0
+	for _, folder := range folders {
+		indent := "    "
+		if len(folders) > 1 {
+			fmt.Fprintf(w, "    <DT><H3>%s</H3>\n    <DL><p>\n", html.EscapeString(folder.Title))
+			indent = "        "
+		}
+		for _, b := range folder.Bookmarks {
+			title := b.Title
+			if title == "" {
+				title = b.URL
+			}
+			fmt.Fprintf(w, "%s<DT><A HREF=\"%s\">%s</A>\n", indent,
+				html.EscapeString(b.URL), html.EscapeString(title))
+			n++
+		}
+		if len(folders) > 1 {
+			fmt.Fprintf(w, "    </DL><p>\n")
+		}
+	}
+	fmt.Fprint(w, "</DL><p>\n")
+	if err := w.Flush(); err != nil {
+		log.Printf("could not write %s: %s", path, err)
+		return
+	}
+	log.Printf("wrote %d bookmarks to %s", n, path)
+}
@@ -5,13 +5,16 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 
 	"github.com/remyoudompheng/go-misc/nokia/mms"
+	"github.com/remyoudompheng/go-misc/nokia/nbf"
 	"github.com/remyoudompheng/go-misc/nokia/nbu"
+	"github.com/remyoudompheng/go-misc/nokia/vobject"
 )
 
 func main() {
@@ -40,8 +43,30 @@ func main() {
 	log.Printf("IMEI: %s", info.IMEI)
 	log.Printf("Backup time: %s", info.BackupTime)
 
+	// Groups are exported as categories of contacts.
+	groups := make(map[uint32][]string)
+	for _, sec := range info.Sections {
+		if sec.Type == nbu.SecGroups {
+			for _, off := range sec.Folders {
+				ReadGroups(f, off, groups)
+			}
+		}
+	}
+	var bookmarks []BookmarkFolder
+
 	for _, sec := range info.Sections {
 		switch sec.Type {
+		case nbu.SecFS:
+			// Restore files
+			DumpFiles(f, sec, destdir)
+		case nbu.SecContacts:
+			// Dump vCards
+			for _, off := range sec.Folders {
+				DumpContactFolder(f, off, groups, destdir)
+			}
+		case nbu.SecCalendar, nbu.SecMemo:
+			// Dump iCalendar
+			DumpCalendar(f, sec, info, destdir)
 		case nbu.SecMessages:
 			// Dump SMS
 			for _, off := range sec.Folders {
@@ -52,7 +77,47 @@ func main() {
 			for _, off := range sec.Folders {
 				DumpMMSFolder(f, off, destdir)
 			}
+		case nbu.SecBookmarks:
+			for _, off := range sec.Folders {
+				title, b, err := f.ReadBookmarkFolderAt(off)
+				if err != nil {
+					log.Printf("could not parse bookmark folder at offset 0x%x: %s", off, err)
+				}
+				bookmarks = append(bookmarks, BookmarkFolder{Title: title, Bookmarks: b})
+			}
+		}
+	}
+	if len(bookmarks) > 0 {
+		DumpBookmarks(bookmarks, filepath.Join(destdir, "bookmarks.html"))
+	}
+}
+
+func DumpFiles(f *nbu.Reader, sec nbu.Section, destdir string) {
+	files, err := f.ReadFilesAt(sec.FileTable, sec.Items)
+	if err != nil {
+		log.Printf("could not parse file table at offset 0x%x: %s", sec.FileTable, err)
+	}
+	log.Printf("writing %d files to %s", len(files), filepath.Join(destdir, "files"))
+	for _, file := range files {
+		path := filepath.Join(destdir, "files", filepath.FromSlash(file.Path))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			log.Fatalf("could not create directory %s: %s", filepath.Dir(path), err)
+		}
+		out, err := os.Create(path)
+		if err != nil {
+			log.Printf("could not create %s: %s", path, err)
+			continue
+		}
+		_, err = io.Copy(out, f.Open(file))
+		if err2 := out.Close(); err == nil {
+			err = err2
 		}
+		if err != nil {
+			log.Printf("could not write %s: %s", path, err)
+			continue
+		}
+		os.Chtimes(path, file.ModTime, file.ModTime)
 	}
 }
 
@@ -60,7 +125,9 @@ func DumpSMSFolder(f *nbu.Reader, off int64, destdir string) {
 	title, msgs, err := f.ReadMessageFolderAt(off)
 	if err != nil {
 		log.Printf("could not parse message folder at offset 0x%x: %s", off, err)
-		return
+		if len(msgs) == 0 {
+			return
+		}
 	}
 	dir := filepath.Join(destdir, "sms", title)
 	err = os.MkdirAll(dir, 0755)
@@ -70,14 +137,104 @@ func DumpSMSFolder(f *nbu.Reader, off int64, destdir string) {
 
 	log.Printf("writing %d SMS to %s", len(msgs), dir)
 	for i, msg := range msgs {
-		base := fmt.Sprintf("%06d.vmsg", i+1)
-		err := ioutil.WriteFile(filepath.Join(dir, base), []byte(msg), 0644)
+		base := fmt.Sprintf("%06d.msg", i+1)
+		err := ioutil.WriteFile(filepath.Join(dir, base), formatSMS(msg), 0644)
 		if err != nil {
 			log.Printf("could not write %s: %s", base, err)
 		}
 	}
 }
 
+// formatSMS formats a message with mail-like headers, as
+// nbfextract does.
+func formatSMS(m nbf.SMS) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "Date: %s\n", m.When.Format("02 Jan 2006 15:04:05 -0700"))
+	if m.Type == 0 {
+		fmt.Fprintf(buf, "From: %s\n", m.Peer)
+	} else {
+		for _, p := range m.Peers {
+			fmt.Fprintf(buf, "To: %s\n", p)
+		}
+	}
+	if !m.Read {
+		fmt.Fprintf(buf, "Status: unread\n")
+	}
+	fmt.Fprintf(buf, "\n%s\n\n", m.Text)
+	return buf.Bytes()
+}
+
+// ReadGroups adds the names of groups of each contact to groups.
+func ReadGroups(f *nbu.Reader, off int64, groups map[uint32][]string) {
+	_, grps, err := f.ReadGroupFolderAt(off)
+	if err != nil {
+		log.Printf("could not parse group folder at offset 0x%x: %s", off, err)
+	}
+	for _, g := range grps {
+		for _, id := range g.Members {
+			groups[id] = append(groups[id], g.Name)
+		}
+	}
+}
+
+func DumpContactFolder(f *nbu.Reader, off int64, groups map[uint32][]string, destdir string) {
+	title, contacts, err := f.ReadContactFolderAt(off)
+	if err != nil {
+		log.Printf("could not parse contact folder at offset 0x%x: %s", off, err)
+		if len(contacts) == 0 {
+			return
+		}
+	}
+	dir := filepath.Join(destdir, "contacts", title)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		log.Fatalf("could not create directory %s: %s", dir, err)
+	}
+
+	log.Printf("writing %d contacts to %s", len(contacts), dir)
+	for i, c := range contacts {
+		c.Categories = append(c.Categories[:len(c.Categories):len(c.Categories)], groups[c.ID]...)
+		base := fmt.Sprintf("%06d.vcf", i+1)
+		err := ioutil.WriteFile(filepath.Join(dir, base), []byte(vobject.FormatVCard3(c)), 0644)
+		if err != nil {
+			log.Printf("could not write %s: %s", base, err)
+		}
+	}
+}
+
+func DumpCalendar(f *nbu.Reader, sec nbu.Section, info nbu.FileInfo, destdir string) {
+	var entries []nbu.CalendarEntry
+	var memos []nbu.Memo
+	var err error
+	base := "calendar.ics"
+	if sec.Type == nbu.SecMemo {
+		base = "memos.ics"
+		memos, err = f.ReadMemosAt(sec.Offset, sec.Items)
+	} else {
+		entries, err = f.ReadCalendarAt(sec.Offset, sec.Items)
+	}
+	if err != nil {
+		log.Printf("could not parse %s at offset 0x%x: %s", base, sec.Offset, err)
+	}
+	if len(entries) == 0 && len(memos) == 0 {
+		return
+	}
+	err = os.MkdirAll(destdir, 0755)
+	if err != nil {
+		log.Fatalf("could not create directory %s: %s", destdir, err)
+	}
+	path := filepath.Join(destdir, base)
+	log.Printf("writing %d entries to %s", len(entries)+len(memos), path)
+	host := info.IMEI
+	if host == "" {
+		host = "nbuextract"
+	}
+	ics := vobject.FormatICalendar(entries, memos, info.BackupTime, host)
+	if err := ioutil.WriteFile(path, []byte(ics), 0644); err != nil {
+		log.Printf("could not write %s: %s", path, err)
+	}
+}
+
 func DumpMMSFolder(f *nbu.Reader, off int64, destdir string) {
 	title, msgs, err := f.ReadMMSFolderAt(off)
 	if err != nil {
@@ -97,10 +254,38 @@ func DumpMMSFolder(f *nbu.Reader, off int64, destdir string) {
 		if err != nil {
 			log.Printf("could not write %s: %s", base, err)
 		}
-		// try parsing.
-		buf := bytes.NewBuffer(msg)
-		m, err := mms.ReadMMS(buf)
-		log.Printf("err=%s", err)
-		log.Printf("%+v", m)
+		m, err := mms.ReadMMS(bytes.NewBuffer(msg))
+		if err != nil {
+			log.Printf("could not decode %s: %s", base, err)
+			continue
+		}
+		writeEML(&m, filepath.Join(dir, fmt.Sprintf("%06d.eml", i+1)))
+		writeHTML(&m, filepath.Join(dir, fmt.Sprintf("%06d.html", i+1)))
+	}
+}
+
+// writeEML writes a MMS as an e-mail message.
+func writeEML(m *mms.MMS, path string) {
+	out, err := os.Create(path)
+	if err != nil {
+		log.Printf("could not create %s: %s", path, err)
+		return
+	}
+	defer out.Close()
+	if err := m.ToMIME(out); err != nil {
+		log.Printf("could not write %s: %s", path, err)
+	}
+}
+
+// writeHTML writes the presentation of a MMS as a HTML page.
+func writeHTML(m *mms.MMS, path string) {
+	out, err := os.Create(path)
+	if err != nil {
+		log.Printf("could not create %s: %s", path, err)
+		return
+	}
+	defer out.Close()
+	if err := m.WriteHTML(out); err != nil {
+		log.Printf("could not write %s: %s", path, err)
 	}
 }
@@ -0,0 +1,153 @@
+package vobject
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FormatICalendar formats calendar entries and memos as an
+// iCalendar document (RFC 5545). Entries without UID get one
+// generated from host, and stamp is the DTSTAMP of entries without
+// modification time.
+func FormatICalendar(entries []CalendarEntry, memos []Memo, stamp time.Time, host string) string {
+	iw := &icsWriter{buf: new(bytes.Buffer), stamp: stamp, host: host}
+	iw.line("BEGIN", "VCALENDAR")
+	iw.line("VERSION", "2.0")
+	iw.line("PRODID", "-//go-misc//nokia//EN")
+	for _, e := range entries {
+		iw.writeEntry(e)
+	}
+	for _, m := range memos {
+		iw.writeMemo(m)
+	}
+	iw.line("END", "VCALENDAR")
+	return iw.buf.String()
+}
+
+type icsWriter struct {
+	buf   *bytes.Buffer
+	stamp time.Time // default DTSTAMP.
+	host  string    // right-hand side of generated UIDs.
+	n     int
+}
+
+func (iw *icsWriter) line(name, value string) {
+	foldLine(iw.buf, name+":"+value)
+}
+
+func (iw *icsWriter) text(name, value string) {
+	if value != "" {
+		iw.line(name, text(value))
+	}
+}
+
+func (iw *icsWriter) time(name string, t time.Time, date bool) {
+	switch {
+	case t.IsZero():
+	case date:
+		iw.line(name+";VALUE=DATE", t.Format("20060102"))
+	case t.Location() == time.UTC:
+		iw.line(name, t.Format("20060102T150405Z"))
+	default:
+		// floating time, as on the phone.
+		iw.line(name, t.Format("20060102T150405"))
+	}
+}
+
+// begin starts a component with its mandatory properties.
+// Generated UIDs are prefixed with the component name, so that
+// they do not collide across files.
+func (iw *icsWriter) begin(comp, uid string, modified time.Time) {
+	iw.n++
+	if uid == "" {
+		uid = fmt.Sprintf("%s-%d", strings.ToLower(comp), iw.n)
+	}
+	iw.line("BEGIN", comp)
+	if iw.host != "" {
+		uid += "@" + iw.host
+	}
+	iw.text("UID", uid)
+	stamp := iw.stamp
+	if !modified.IsZero() {
+		stamp = modified
+	}
+	iw.line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+}
+
+// writeEntry writes a calendar entry as a VEVENT or VTODO.
+func (iw *icsWriter) writeEntry(e CalendarEntry) {
+	comp := "VEVENT"
+	if e.Kind == Todo {
+		comp = "VTODO"
+	}
+	iw.begin(comp, e.UID, e.Modified)
+	iw.text("SUMMARY", e.Summary)
+	iw.text("DESCRIPTION", e.Description)
+	iw.text("LOCATION", e.Location)
+	if len(e.Categories) > 0 {
+		cats := make([]string, len(e.Categories))
+		for i, c := range e.Categories {
+			cats[i] = text(c)
+		}
+		iw.line("CATEGORIES", strings.Join(cats, ","))
+	}
+	allDay := e.AllDay || e.Kind == Anniversary
+	iw.time("DTSTART", e.Start, allDay)
+	switch {
+	case e.Kind == Todo:
+		iw.time("DUE", e.Due, false)
+		if !e.Completed.IsZero() {
+			iw.line("STATUS", "COMPLETED")
+			iw.line("COMPLETED", e.Completed.UTC().Format("20060102T150405Z"))
+		}
+		if e.Priority > 0 {
+			iw.line("PRIORITY", fmt.Sprint(e.Priority))
+		}
+	case allDay && !e.Start.IsZero():
+		// anniversaries and reminders last one day.
+		if e.End.After(e.Start) && !e.End.Before(e.Start.AddDate(0, 0, 1)) {
+			iw.time("DTEND", e.End, true)
+		} else {
+			iw.time("DTEND", e.Start.AddDate(0, 0, 1), true)
+		}
+	case e.End.After(e.Start):
+		iw.time("DTEND", e.End, false)
+	}
+	rec := e.Recurrence
+	if rec == nil && e.Kind == Anniversary {
+		rec = &Recurrence{Freq: "YEARLY", Interval: 1}
+	}
+	if rec != nil {
+		iw.line("RRULE", rec.String())
+	}
+	for _, ex := range e.Exceptions {
+		iw.time("EXDATE", ex, allDay)
+	}
+	if !e.Alarm.IsZero() {
+		iw.line("BEGIN", "VALARM")
+		iw.line("ACTION", "DISPLAY")
+		// DESCRIPTION is required for DISPLAY alarms.
+		desc := e.Summary
+		if desc == "" {
+			desc = "Reminder"
+		}
+		iw.text("DESCRIPTION", desc)
+		iw.line("TRIGGER;VALUE=DATE-TIME", e.Alarm.UTC().Format("20060102T150405Z"))
+		iw.line("END", "VALARM")
+	}
+	iw.line("END", comp)
+}
+
+// writeMemo writes a memo as a VJOURNAL.
+func (iw *icsWriter) writeMemo(m Memo) {
+	iw.begin("VJOURNAL", "", m.Modified)
+	summary := m.Text
+	if i := strings.IndexByte(summary, '\n'); i >= 0 {
+		summary = summary[:i]
+	}
+	iw.text("SUMMARY", summary)
+	iw.text("DESCRIPTION", m.Text)
+	iw.line("END", "VJOURNAL")
+}
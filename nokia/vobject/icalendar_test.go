@@ -0,0 +1,73 @@
+package vobject
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatICalendar(t *testing.T) {
+	stamp := time.Date(2013, 3, 1, 10, 0, 0, 0, time.UTC)
+	entries := []CalendarEntry{{
+		Summary:    "Lunch, with Jean",
+		Categories: []string{"MEETING"},
+		Start:      time.Date(2013, 3, 4, 12, 0, 0, 0, time.UTC),
+		End:        time.Date(2013, 3, 4, 13, 0, 0, 0, time.UTC),
+		Alarm:      time.Date(2013, 3, 4, 11, 45, 0, 0, time.UTC),
+	}, {
+		Kind:  Anniversary,
+		UID:   "birthday",
+		Start: time.Date(1980, 5, 17, 0, 0, 0, 0, time.UTC),
+		Alarm: time.Date(2013, 5, 17, 9, 0, 0, 0, time.UTC),
+	}}
+	memos := []Memo{{Text: "Buy milk\nand eggs"}}
+	expected := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"PRODID:-//go-misc//nokia//EN\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:vevent-1@example\r\n" +
+		"DTSTAMP:20130301T100000Z\r\n" +
+		"SUMMARY:Lunch\\, with Jean\r\n" +
+		"CATEGORIES:MEETING\r\n" +
+		"DTSTART:20130304T120000Z\r\n" +
+		"DTEND:20130304T130000Z\r\n" +
+		"BEGIN:VALARM\r\n" +
+		"ACTION:DISPLAY\r\n" +
+		"DESCRIPTION:Lunch\\, with Jean\r\n" +
+		"TRIGGER;VALUE=DATE-TIME:20130304T114500Z\r\n" +
+		"END:VALARM\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:birthday@example\r\n" +
+		"DTSTAMP:20130301T100000Z\r\n" +
+		"DTSTART;VALUE=DATE:19800517\r\n" +
+		"DTEND;VALUE=DATE:19800518\r\n" +
+		"RRULE:FREQ=YEARLY\r\n" +
+		"BEGIN:VALARM\r\n" +
+		"ACTION:DISPLAY\r\n" +
+		"DESCRIPTION:Reminder\r\n" +
+		"TRIGGER;VALUE=DATE-TIME:20130517T090000Z\r\n" +
+		"END:VALARM\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VJOURNAL\r\n" +
+		"UID:vjournal-3@example\r\n" +
+		"DTSTAMP:20130301T100000Z\r\n" +
+		"SUMMARY:Buy milk\r\n" +
+		"DESCRIPTION:Buy milk\\nand eggs\r\n" +
+		"END:VJOURNAL\r\n" +
+		"END:VCALENDAR\r\n"
+	if s := FormatICalendar(entries, memos, stamp, "example"); s != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", s, expected)
+	}
+
+	// long lines are folded.
+	s := FormatICalendar(nil, []Memo{{Text: strings.Repeat("x", 100)}}, stamp, "")
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line too long: %q", line)
+		}
+	}
+	if !strings.Contains(s, "UID:vjournal-1\r\n") {
+		t.Errorf("got UID without host: %s", s)
+	}
+}
@@ -0,0 +1,42 @@
+package vobject
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Bookmark is a web browser bookmark.
+type Bookmark struct {
+	Title string
+	URL   string
+}
+
+func ParseVBookmark(s string) (b Bookmark, err error) {
+	props, err := parseProperties(s)
+	if err != nil {
+		return b, err
+	}
+	if len(props) == 0 || props[0].Name != "BEGIN" || !strings.EqualFold(props[0].Value, "VBKM") {
+		return b, fmt.Errorf("not a vBookmark")
+	}
+	for _, p := range props[1:] {
+		switch p.Name {
+		case "TITLE":
+			b.Title = p.Value
+		case "URL":
+			b.URL = p.Value
+		case "END":
+			if b.URL == "" {
+				return b, fmt.Errorf("missing URL")
+			}
+			return b, nil
+		}
+	}
+	return b, fmt.Errorf("missing END:VBKM")
+}
+
+// FormatVBookmark formats a bookmark as a vBookmark document.
+func FormatVBookmark(b Bookmark) string {
+	return "BEGIN:VBKM\r\nVERSION:1.0\r\nTITLE:" + b.Title +
+		"\r\nURL:" + b.URL + "\r\nEND:VBKM\r\n"
+}
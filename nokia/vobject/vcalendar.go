@@ -0,0 +1,417 @@
+package vobject
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The kind of a calendar entry.
+const (
+	Appointment = iota // a meeting or a call.
+	Reminder           // a note attached to a day.
+	Anniversary        // a birthday or yearly occasion.
+	Todo
+)
+
+// A CalendarEntry is an event or a to-do item.
+type CalendarEntry struct {
+	Kind        int
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Categories  []string
+
+	// Times without a time zone are returned in time.Local.
+	Start, End time.Time
+	AllDay     bool // Start and End are dates.
+	Modified   time.Time
+
+	Alarm      time.Time // zero if no alarm.
+	Recurrence *Recurrence
+	Exceptions []time.Time
+
+	// For to-do items.
+	Due       time.Time
+	Completed time.Time // zero if not completed.
+	Priority  int
+}
+
+// A Recurrence describes how an entry repeats.
+type Recurrence struct {
+	Freq       string // DAILY, WEEKLY, MONTHLY or YEARLY.
+	Interval   int
+	Count      int       // number of occurrences, zero if unbounded.
+	Until      time.Time // zero if unbounded.
+	ByDay      []string  // MO, TU... with an optional ordinal as in 1MO, -1FR.
+	ByMonthDay []int     // negative values count from the end of month.
+	ByMonth    []int
+}
+
+// A Memo is a note of the memo application.
+type Memo struct {
+	Text     string
+	Modified time.Time
+}
+
+var errNoVCalendar = errors.New("not a vCalendar")
+
+// ParseVCalendar parses the events and to-do items of a
+// vCalendar 1.0 document.
+func ParseVCalendar(s string) (entries []CalendarEntry, err error) {
+	props, err := parseProperties(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(props) == 0 || props[0].Name != "BEGIN" || !strings.EqualFold(props[0].Value, "VCALENDAR") {
+		return nil, errNoVCalendar
+	}
+	var e *CalendarEntry
+	for _, p := range props[1:] {
+		switch {
+		case p.Name == "BEGIN":
+			e = &CalendarEntry{}
+			if strings.EqualFold(p.Value, "VTODO") {
+				e.Kind = Todo
+			}
+			continue
+		case p.Name == "END" && strings.EqualFold(p.Value, "VCALENDAR"):
+			return entries, nil
+		case p.Name == "END":
+			if e != nil {
+				entries = append(entries, *e)
+			}
+			e = nil
+			continue
+		case e == nil:
+			continue
+		}
+		if err := e.set(p); err != nil {
+			return entries, err
+		}
+	}
+	return entries, fmt.Errorf("missing END:VCALENDAR")
+}
+
+func (e *CalendarEntry) set(p property) (err error) {
+	value := SplitValue(p.Value)[0]
+	switch p.Name {
+	case "UID":
+		e.UID = value
+	case "SUMMARY":
+		e.Summary = value
+	case "DESCRIPTION":
+		e.Description = value
+	case "LOCATION":
+		e.Location = value
+	case "CATEGORIES":
+		e.Categories = splitCategories(p.Value)
+		if e.Kind != Todo && len(e.Categories) > 0 {
+			switch strings.ToUpper(e.Categories[0]) {
+			case "SPECIAL OCCASION", "ANNIVERSARY":
+				e.Kind = Anniversary
+			case "REMINDER", "MISCELLANEOUS":
+				e.Kind = Reminder
+			}
+		}
+	case "X-EPOCAGENDAENTRYTYPE":
+		switch strings.ToUpper(value) {
+		case "ANNIVERSARY":
+			e.Kind = Anniversary
+		case "EVENT", "REMINDER":
+			e.Kind = Reminder
+		case "TODO":
+			e.Kind = Todo
+		default:
+			e.Kind = Appointment
+		}
+	case "DTSTART":
+		e.Start, e.AllDay, err = parseVTime(value)
+	case "DTEND":
+		e.End, _, err = parseVTime(value)
+	case "LAST-MODIFIED":
+		e.Modified, _, err = parseVTime(value)
+	case "DUE":
+		e.Due, _, err = parseVTime(value)
+	case "COMPLETED":
+		e.Completed, _, err = parseVTime(value)
+	case "PRIORITY":
+		e.Priority, err = strconv.Atoi(value)
+	case "AALARM", "DALARM":
+		// the run time is the first component.
+		if value != "" && e.Alarm.IsZero() {
+			e.Alarm, _, err = parseVTime(value)
+		}
+	case "RRULE":
+		e.Recurrence, err = parseRRule(value)
+	case "EXDATE":
+		for _, d := range strings.Split(value, ",") {
+			t, _, err := parseVTime(d)
+			if err != nil {
+				return err
+			}
+			e.Exceptions = append(e.Exceptions, t)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", p.Name, err)
+	}
+	return nil
+}
+
+// parseVTime parses a date or date-time. Times not in UTC are
+// interpreted in the local time zone.
+func parseVTime(s string) (t time.Time, date bool, err error) {
+	switch {
+	case len(s) == 8:
+		t, err = time.ParseInLocation("20060102", s, time.Local)
+		return t, true, err
+	case strings.HasSuffix(s, "Z"):
+		t, err = time.Parse("20060102T150405Z", s)
+	default:
+		t, err = time.ParseInLocation("20060102T150405", s, time.Local)
+	}
+	return t, false, err
+}
+
+var weekdays = map[string]bool{
+	"MO": true, "TU": true, "WE": true, "TH": true,
+	"FR": true, "SA": true, "SU": true,
+}
+
+// parseRRule parses a vCalendar 1.0 recurrence rule, such as
+// "W1 MO WE #10" or "MD1 15 20121231T000000".
+func parseRRule(s string) (*Recurrence, error) {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty rule")
+	}
+	rec := new(Recurrence)
+	freq := strings.TrimRight(words[0], "0123456789")
+	switch freq {
+	case "D":
+		rec.Freq = "DAILY"
+	case "W":
+		rec.Freq = "WEEKLY"
+	case "MP", "MD":
+		rec.Freq = "MONTHLY"
+	case "YM", "YD":
+		rec.Freq = "YEARLY"
+	default:
+		return nil, fmt.Errorf("unknown frequency in %q", s)
+	}
+	var err error
+	rec.Interval, err = strconv.Atoi(words[0][len(freq):])
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval in %q", s)
+	}
+	// the default duration is 2 occurrences.
+	rec.Count = 2
+	ordinal := ""
+	for _, w := range words[1:] {
+		switch {
+		case strings.HasPrefix(w, "#"):
+			rec.Count, err = strconv.Atoi(w[1:])
+		case len(w) >= 8 && w[0] >= '0' && w[0] <= '9':
+			rec.Count = 0
+			rec.Until, _, err = parseVTime(w)
+		case weekdays[w]:
+			rec.ByDay = append(rec.ByDay, ordinal+w)
+		case freq == "MP":
+			// occurrence such as 1+ or 2-.
+			n, sign := strings.TrimRight(w, "+-"), w[len(w)-1:]
+			if _, err = strconv.Atoi(n); err == nil {
+				if sign == "-" {
+					n = "-" + n
+				}
+				ordinal = n
+			}
+		case freq == "MD" && w == "LD":
+			rec.ByMonthDay = append(rec.ByMonthDay, -1)
+		case freq == "MD" || freq == "YM":
+			n, neg := strings.TrimSuffix(w, "-"), strings.HasSuffix(w, "-")
+			var d int
+			d, err = strconv.Atoi(strings.TrimSuffix(n, "+"))
+			if neg {
+				d = -d
+			}
+			if freq == "MD" {
+				rec.ByMonthDay = append(rec.ByMonthDay, d)
+			} else {
+				rec.ByMonth = append(rec.ByMonth, d)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid word %q in %q", w, s)
+		}
+	}
+	return rec, nil
+}
+
+// String formats the recurrence as a RFC 5545 RRULE value.
+func (rec *Recurrence) String() string {
+	parts := []string{"FREQ=" + rec.Freq}
+	if rec.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(rec.Interval))
+	}
+	switch {
+	case rec.Count > 0:
+		parts = append(parts, "COUNT="+strconv.Itoa(rec.Count))
+	case !rec.Until.IsZero():
+		parts = append(parts, "UNTIL="+rec.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(rec.ByDay) > 0 {
+		parts = append(parts, "BYDAY="+strings.Join(rec.ByDay, ","))
+	}
+	if len(rec.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+joinInts(rec.ByMonthDay))
+	}
+	if len(rec.ByMonth) > 0 {
+		parts = append(parts, "BYMONTH="+joinInts(rec.ByMonth))
+	}
+	return strings.Join(parts, ";")
+}
+
+func joinInts(v []int) string {
+	s := make([]string, len(v))
+	for i, n := range v {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
+
+// ParseVNote parses a vNote document, or returns the text as is.
+func ParseVNote(s string) (m Memo) {
+	props, err := parseProperties(s)
+	if err != nil || len(props) == 0 || props[0].Name != "BEGIN" || !strings.EqualFold(props[0].Value, "VNOTE") {
+		return Memo{Text: s}
+	}
+	for _, p := range props[1:] {
+		switch p.Name {
+		case "BODY":
+			m.Text = SplitValue(p.Value)[0]
+		case "LAST-MODIFIED":
+			if t, _, err := parseVTime(p.Value); err == nil {
+				m.Modified = t
+			}
+		}
+	}
+	return m
+}
+
+var entryTypes = [...]string{
+	Appointment: "APPOINTMENT",
+	Reminder:    "EVENT",
+	Anniversary: "ANNIVERSARY",
+	Todo:        "TODO",
+}
+
+// FormatVCalendar formats an entry as a vCalendar 1.0 document.
+func FormatVCalendar(e CalendarEntry) string {
+	comp := "VEVENT"
+	if e.Kind == Todo {
+		comp = "VTODO"
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteString("BEGIN:VCALENDAR\r\nVERSION:1.0\r\nBEGIN:" + comp + "\r\n")
+	writeProp(buf, "UID", JoinValue(e.UID))
+	writeProp(buf, "SUMMARY", JoinValue(e.Summary))
+	writeProp(buf, "DESCRIPTION", JoinValue(e.Description))
+	writeProp(buf, "LOCATION", JoinValue(e.Location))
+	writeProp(buf, "CATEGORIES", strings.Join(e.Categories, ","))
+	if e.Kind >= 0 && e.Kind < len(entryTypes) {
+		writeProp(buf, "X-EPOCAGENDAENTRYTYPE", entryTypes[e.Kind])
+	}
+	writeProp(buf, "DTSTART", formatVTime(e.Start, e.AllDay))
+	writeProp(buf, "DTEND", formatVTime(e.End, e.AllDay))
+	writeProp(buf, "DUE", formatVTime(e.Due, false))
+	writeProp(buf, "COMPLETED", formatVTime(e.Completed, false))
+	if e.Priority > 0 {
+		writeProp(buf, "PRIORITY", strconv.Itoa(e.Priority))
+	}
+	writeProp(buf, "LAST-MODIFIED", formatVTime(e.Modified, false))
+	if !e.Alarm.IsZero() {
+		writeProp(buf, "AALARM", formatVTime(e.Alarm, false)+";;;")
+	}
+	if e.Recurrence != nil {
+		writeProp(buf, "RRULE", e.Recurrence.vcal())
+	}
+	var exdates []string
+	for _, t := range e.Exceptions {
+		exdates = append(exdates, formatVTime(t, e.AllDay))
+	}
+	writeProp(buf, "EXDATE", strings.Join(exdates, ","))
+	buf.WriteString("END:" + comp + "\r\nEND:VCALENDAR\r\n")
+	return buf.String()
+}
+
+// vcal formats the recurrence as a vCalendar 1.0 rule (see parseRRule).
+func (rec *Recurrence) vcal() string {
+	interval := rec.Interval
+	if interval <= 0 {
+		interval = 1
+	}
+	var words []string
+	switch rec.Freq {
+	case "DAILY":
+		words = append(words, "D"+strconv.Itoa(interval))
+	case "WEEKLY":
+		words = append(words, "W"+strconv.Itoa(interval))
+		words = append(words, rec.ByDay...)
+	case "MONTHLY":
+		if len(rec.ByDay) > 0 {
+			words = append(words, "MP"+strconv.Itoa(interval))
+			for _, d := range rec.ByDay {
+				// 1MO is written 1+ MO, -1FR is 1- FR.
+				ord, day := d[:len(d)-2], d[len(d)-2:]
+				switch {
+				case strings.HasPrefix(ord, "-"):
+					words = append(words, ord[1:]+"-")
+				case ord != "":
+					words = append(words, strings.TrimPrefix(ord, "+")+"+")
+				}
+				words = append(words, day)
+			}
+		} else {
+			words = append(words, "MD"+strconv.Itoa(interval))
+			for _, d := range rec.ByMonthDay {
+				if d < 0 {
+					words = append(words, strconv.Itoa(-d)+"-")
+				} else {
+					words = append(words, strconv.Itoa(d))
+				}
+			}
+		}
+	case "YEARLY":
+		if len(rec.ByMonth) > 0 {
+			words = append(words, "YM"+strconv.Itoa(interval))
+			for _, m := range rec.ByMonth {
+				words = append(words, strconv.Itoa(m))
+			}
+		} else {
+			words = append(words, "YD"+strconv.Itoa(interval))
+		}
+	default:
+		return ""
+	}
+	if !rec.Until.IsZero() {
+		words = append(words, formatVTime(rec.Until, false))
+	} else {
+		words = append(words, "#"+strconv.Itoa(rec.Count))
+	}
+	return strings.Join(words, " ")
+}
+
+// FormatVNote formats a memo as a vNote document.
+func FormatVNote(m Memo) string {
+	buf := new(bytes.Buffer)
+	buf.WriteString("BEGIN:VNOTE\r\nVERSION:1.1\r\n")
+	writeProp(buf, "BODY", JoinValue(m.Text))
+	writeProp(buf, "LAST-MODIFIED", formatVTime(m.Modified, false))
+	buf.WriteString("END:VNOTE\r\n")
+	return buf.String()
+}
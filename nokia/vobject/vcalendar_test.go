@@ -0,0 +1,78 @@
+package vobject
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseVCalendar(t *testing.T) {
+	const cal = "BEGIN:VCALENDAR\r\nVERSION:1.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:42\r\n" +
+		"SUMMARY:Dentist\r\n" +
+		"LOCATION:Rue de Rivoli\r\n" +
+		"CATEGORIES:MEETING\r\n" +
+		"DTSTART:20120305T083000Z\r\n" +
+		"DTEND:20120305T093000Z\r\n" +
+		"AALARM:20120305T081500Z;;;\r\n" +
+		"RRULE:W2 MO TH #5\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"SUMMARY:Buy bread\r\n" +
+		"DUE:20120306T170000Z\r\n" +
+		"PRIORITY:2\r\n" +
+		"END:VTODO\r\n" +
+		"END:VCALENDAR\r\n"
+	entries, err := ParseVCalendar(cal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, expected 2", len(entries))
+	}
+	ev, todo := entries[0], entries[1]
+	if ev.Kind != Appointment || ev.Summary != "Dentist" || ev.Location != "Rue de Rivoli" {
+		t.Errorf("got event %+v", ev)
+	}
+	start := time.Date(2012, 3, 5, 8, 30, 0, 0, time.UTC)
+	if !ev.Start.Equal(start) || !ev.End.Equal(start.Add(time.Hour)) ||
+		!ev.Alarm.Equal(start.Add(-15*time.Minute)) {
+		t.Errorf("got times %s %s %s", ev.Start, ev.End, ev.Alarm)
+	}
+	if s := ev.Recurrence.String(); s != "FREQ=WEEKLY;INTERVAL=2;COUNT=5;BYDAY=MO,TH" {
+		t.Errorf("got recurrence %s", s)
+	}
+	if todo.Kind != Todo || todo.Summary != "Buy bread" || todo.Priority != 2 || todo.Due.IsZero() {
+		t.Errorf("got to-do %+v", todo)
+	}
+}
+
+func TestParseVCalendarEmptyCategories(t *testing.T) {
+	for _, cats := range []string{"", ","} {
+		cal := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nCATEGORIES:" + cats +
+			"\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+		entries, err := ParseVCalendar(cal)
+		if err != nil || len(entries) != 1 || entries[0].Kind != Appointment {
+			t.Errorf("CATEGORIES:%s: got %+v, %v", cats, entries, err)
+		}
+	}
+}
+
+func TestParseRRule(t *testing.T) {
+	for _, test := range []struct{ in, out string }{
+		{"D1 #0", "FREQ=DAILY"},
+		{"MP1 1- FR #0", "FREQ=MONTHLY;BYDAY=-1FR"},
+		{"MD1 15 LD 20121231T000000Z", "FREQ=MONTHLY;UNTIL=20121231T000000Z;BYMONTHDAY=15,-1"},
+		{"YM1 6 #3", "FREQ=YEARLY;COUNT=3;BYMONTH=6"},
+		{"YD1", "FREQ=YEARLY;COUNT=2"},
+	} {
+		rec, err := parseRRule(test.in)
+		if err != nil {
+			t.Errorf("%s: %s", test.in, err)
+			continue
+		}
+		if s := rec.String(); s != test.out {
+			t.Errorf("%s: got %s, expected %s", test.in, s, test.out)
+		}
+	}
+}
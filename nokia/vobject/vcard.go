@@ -0,0 +1,249 @@
+package vobject
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A Contact is a phonebook entry.
+type Contact struct {
+	ID       uint32 // referenced by groups.
+	FullName string
+	Name     Name
+	Nickname string
+	Birthday string // as written by the phone, usually YYYYMMDD.
+
+	Tel     []TypedValue
+	Email   []TypedValue
+	Address []Address
+	URL     string
+
+	Org   string
+	Title string
+	Note  string
+
+	Categories []string
+	Photo      []byte
+	PhotoType  string // e.g. JPEG
+}
+
+// Name is the structured name of a contact.
+type Name struct {
+	Family, Given, Middle string
+	Prefix, Suffix        string
+}
+
+// A TypedValue is a phone number or email address with its
+// types (CELL, HOME, WORK, PREF...).
+type TypedValue struct {
+	Type  []string
+	Value string
+}
+
+// An Address is a postal address.
+type Address struct {
+	Type       []string
+	POBox      string
+	Extended   string
+	Street     string
+	Locality   string
+	Region     string
+	PostalCode string
+	Country    string
+}
+
+var errNoVCard = errors.New("not a vCard")
+
+// ParseVCard parses a vCard 2.1 document. Unknown properties
+// are ignored.
+func ParseVCard(s string) (c Contact, err error) {
+	props, err := parseProperties(s)
+	if err != nil {
+		return c, err
+	}
+	if len(props) == 0 || props[0].Name != "BEGIN" || !strings.EqualFold(props[0].Value, "VCARD") {
+		return c, errNoVCard
+	}
+	for _, p := range props[1:] {
+		if p.Name == "END" {
+			return c, nil
+		}
+		if p.Name == "PHOTO" {
+			if p.Encoding == "BASE64" || p.Encoding == "B" {
+				c.Photo, err = base64.StdEncoding.DecodeString(strings.Map(dropSpace, p.Value))
+				if err != nil {
+					return c, fmt.Errorf("invalid photo: %s", err)
+				}
+			}
+			if len(p.Types) > 0 {
+				c.PhotoType = p.Types[0]
+			}
+			continue
+		}
+		types, fields := p.Types, SplitValue(p.Value)
+		switch p.Name {
+		case "FN":
+			c.FullName = fields[0]
+		case "N":
+			fields = append(fields, make([]string, 5)...)
+			c.Name = Name{Family: fields[0], Given: fields[1], Middle: fields[2],
+				Prefix: fields[3], Suffix: fields[4]}
+		case "NICKNAME", "X-EPOCSECONDNAME":
+			c.Nickname = fields[0]
+		case "BDAY":
+			c.Birthday = fields[0]
+		case "TEL":
+			c.Tel = append(c.Tel, TypedValue{Type: types, Value: fields[0]})
+		case "EMAIL":
+			c.Email = append(c.Email, TypedValue{Type: types, Value: fields[0]})
+		case "ADR":
+			fields = append(fields, make([]string, 7)...)
+			c.Address = append(c.Address, Address{Type: types,
+				POBox: fields[0], Extended: fields[1], Street: fields[2],
+				Locality: fields[3], Region: fields[4], PostalCode: fields[5],
+				Country: fields[6]})
+		case "URL":
+			c.URL = fields[0]
+		case "ORG":
+			c.Org = strings.Join(fields, ", ")
+		case "TITLE":
+			c.Title = fields[0]
+		case "NOTE":
+			c.Note = fields[0]
+		case "CATEGORIES":
+			c.Categories = splitCategories(p.Value)
+		}
+	}
+	return c, fmt.Errorf("missing END:VCARD")
+}
+
+func splitCategories(s string) (cats []string) {
+	for _, cat := range strings.Split(s, ",") {
+		if cat = strings.TrimSpace(cat); cat != "" {
+			cats = append(cats, cat)
+		}
+	}
+	return cats
+}
+
+// FormatVCard formats a contact as a vCard 2.1 document.
+func FormatVCard(c Contact) string {
+	buf := new(bytes.Buffer)
+	buf.WriteString("BEGIN:VCARD\r\nVERSION:2.1\r\n")
+	n := c.Name
+	buf.WriteString("N:" + JoinValue(n.Family, n.Given, n.Middle, n.Prefix, n.Suffix) + "\r\n")
+	writeProp(buf, "FN", JoinValue(c.FullName))
+	writeProp(buf, "NICKNAME", JoinValue(c.Nickname))
+	writeProp(buf, "BDAY", JoinValue(c.Birthday))
+	for _, tel := range c.Tel {
+		writeProp(buf, typedName("TEL", tel.Type), JoinValue(tel.Value))
+	}
+	for _, email := range c.Email {
+		writeProp(buf, typedName("EMAIL", email.Type), JoinValue(email.Value))
+	}
+	for _, a := range c.Address {
+		writeProp(buf, typedName("ADR", a.Type), JoinValue(a.POBox, a.Extended,
+			a.Street, a.Locality, a.Region, a.PostalCode, a.Country))
+	}
+	writeProp(buf, "URL", JoinValue(c.URL))
+	writeProp(buf, "ORG", JoinValue(c.Org))
+	writeProp(buf, "TITLE", JoinValue(c.Title))
+	writeProp(buf, "NOTE", JoinValue(c.Note))
+	writeProp(buf, "CATEGORIES", strings.Join(c.Categories, ","))
+	if len(c.Photo) > 0 {
+		name := "PHOTO"
+		if c.PhotoType != "" {
+			name += ";TYPE=" + c.PhotoType
+		}
+		buf.WriteString(name + ";ENCODING=BASE64:\r\n")
+		data := base64.StdEncoding.EncodeToString(c.Photo)
+		for len(data) > 0 {
+			n := 72
+			if n > len(data) {
+				n = len(data)
+			}
+			buf.WriteString(" " + data[:n] + "\r\n")
+			data = data[n:]
+		}
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("END:VCARD\r\n")
+	return buf.String()
+}
+
+// text escapes fields as vCard 3.0 or iCalendar text values, where
+// commas are also escaped, and joins them with semicolons.
+func text(fields ...string) string {
+	return strings.Replace(JoinValue(fields...), ",", `\,`, -1)
+}
+
+// FormatVCard3 formats a contact as a vCard 3.0 document
+// (RFC 2426). The photo is embedded in base64.
+func FormatVCard3(c Contact) string {
+	buf := new(bytes.Buffer)
+	prop := func(name, value string) {
+		if value != "" {
+			foldLine(buf, name+":"+value)
+		}
+	}
+	buf.WriteString("BEGIN:VCARD\r\nVERSION:3.0\r\n")
+	n := c.Name
+	fn := c.FullName
+	if fn == "" {
+		// FN is mandatory in vCard 3.0.
+		fn = strings.TrimSpace(n.Given + " " + n.Family)
+	}
+	foldLine(buf, "FN:"+text(fn))
+	foldLine(buf, "N:"+text(n.Family, n.Given, n.Middle, n.Prefix, n.Suffix))
+	prop("NICKNAME", text(c.Nickname))
+	prop("BDAY", c.Birthday)
+	for _, tel := range c.Tel {
+		prop(typeParam("TEL", tel.Type), text(tel.Value))
+	}
+	for _, email := range c.Email {
+		prop(typeParam("EMAIL", email.Type), text(email.Value))
+	}
+	for _, a := range c.Address {
+		prop(typeParam("ADR", a.Type), text(a.POBox, a.Extended,
+			a.Street, a.Locality, a.Region, a.PostalCode, a.Country))
+	}
+	prop("URL", c.URL)
+	prop("ORG", text(c.Org))
+	prop("TITLE", text(c.Title))
+	prop("NOTE", text(c.Note))
+	cats := make([]string, len(c.Categories))
+	for i, cat := range c.Categories {
+		cats[i] = text(cat)
+	}
+	prop("CATEGORIES", strings.Join(cats, ","))
+	if len(c.Photo) > 0 {
+		name := "PHOTO;ENCODING=b"
+		if c.PhotoType != "" {
+			name += ";TYPE=" + strings.ToUpper(c.PhotoType)
+		}
+		prop(name, base64.StdEncoding.EncodeToString(c.Photo))
+	}
+	buf.WriteString("END:VCARD\r\n")
+	return buf.String()
+}
+
+// typeParam returns a property name with a vCard 3.0 TYPE
+// parameter, such as TEL;TYPE=CELL,PREF.
+func typeParam(name string, types []string) string {
+	if len(types) == 0 {
+		return name
+	}
+	return name + ";TYPE=" + strings.Join(types, ",")
+}
+
+// typedName returns a property name with types as parameters,
+// such as TEL;CELL;PREF.
+func typedName(name string, types []string) string {
+	for _, t := range types {
+		name += ";" + t
+	}
+	return name
+}
@@ -0,0 +1,31 @@
+package vobject
+
+import (
+	"testing"
+)
+
+func TestFormatVCard3(t *testing.T) {
+	c := Contact{
+		Name:       Name{Family: "Doe", Given: "John"},
+		Tel:        []TypedValue{{Type: []string{"CELL", "PREF"}, Value: "+33612345678"}},
+		Org:        "Doe, Inc; Paris",
+		Note:       "line 1\nline 2",
+		Categories: []string{"Friends", "A,B"},
+		Photo:      make([]byte, 60),
+		PhotoType:  "JPEG",
+	}
+	expected := "BEGIN:VCARD\r\n" +
+		"VERSION:3.0\r\n" +
+		"FN:John Doe\r\n" +
+		"N:Doe;John;;;\r\n" +
+		"TEL;TYPE=CELL,PREF:+33612345678\r\n" +
+		"ORG:Doe\\, Inc\\; Paris\r\n" +
+		"NOTE:line 1\\nline 2\r\n" +
+		"CATEGORIES:Friends,A\\,B\r\n" +
+		"PHOTO;ENCODING=b;TYPE=JPEG:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\r\n" +
+		" AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\r\n" +
+		"END:VCARD\r\n"
+	if s := FormatVCard3(c); s != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", s, expected)
+	}
+}
@@ -0,0 +1,172 @@
+// Package vobject parses and formats the vCard, vCalendar, vNote
+// and vBookmark documents used by Nokia phones.
+package vobject
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// vCard 2.1, vCalendar 1.0, vNote and vBookmark documents
+// share their syntax: a sequence of properties.
+
+// A property is a line of a vCard or vCalendar.
+type property struct {
+	Name     string // upper case, without group.
+	Types    []string
+	Encoding string // QUOTED-PRINTABLE, BASE64 or empty.
+	Value    string // decoded from quoted-printable if needed.
+}
+
+// parseProperties splits a vCard or vCalendar into properties.
+func parseProperties(s string) ([]property, error) {
+	var props []property
+	for _, line := range unfoldLines(s) {
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			return props, fmt.Errorf("invalid line %q", line)
+		}
+		params := strings.Split(line[:colon], ";")
+		p := property{Name: strings.ToUpper(params[0]), Value: line[colon+1:]}
+		if dot := strings.LastIndexByte(p.Name, '.'); dot >= 0 {
+			p.Name = p.Name[dot+1:] // grouped property.
+		}
+		for _, param := range params[1:] {
+			key, value := "TYPE", param
+			if eq := strings.IndexByte(param, '='); eq >= 0 {
+				key, value = strings.ToUpper(param[:eq]), param[eq+1:]
+			}
+			value = strings.ToUpper(value)
+			switch {
+			case key == "ENCODING",
+				key == "TYPE" && (value == "QUOTED-PRINTABLE" || value == "BASE64"):
+				p.Encoding = value
+			case key == "TYPE":
+				p.Types = append(p.Types, strings.Split(value, ",")...)
+			}
+		}
+		if p.Encoding == "QUOTED-PRINTABLE" {
+			b, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(p.Value)))
+			if err != nil {
+				return props, fmt.Errorf("invalid %s value: %s", p.Name, err)
+			}
+			p.Value = string(b)
+		}
+		props = append(props, p)
+	}
+	return props, nil
+}
+
+// unfoldLines splits a vCard into logical lines: lines starting
+// with a space or tab continue the previous one, as well as lines
+// following a quoted-printable soft line break.
+func unfoldLines(s string) []string {
+	var lines []string
+	qpSoftBreak := false
+	for _, l := range strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n") {
+		switch {
+		case qpSoftBreak:
+			lines[len(lines)-1] += "\n" + l
+		case len(lines) > 0 && (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")):
+			lines[len(lines)-1] += l[1:]
+		case l == "":
+			continue
+		default:
+			lines = append(lines, l)
+		}
+		last := lines[len(lines)-1]
+		qpSoftBreak = strings.HasSuffix(last, "=") &&
+			strings.Contains(strings.ToUpper(last[:strings.IndexByte(last+":", ':')]), "QUOTED-PRINTABLE")
+	}
+	return lines
+}
+
+// SplitValue splits a value at unescaped semicolons and
+// unescapes it. The result has at least one element.
+func SplitValue(s string) []string {
+	var fields []string
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n', 'N':
+				buf.WriteByte('\n')
+			default:
+				buf.WriteByte(s[i])
+			}
+		case ch == ';':
+			fields = append(fields, buf.String())
+			buf.Reset()
+		default:
+			buf.WriteByte(ch)
+		}
+	}
+	return append(fields, buf.String())
+}
+
+var valueEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, "\r\n", `\n`, "\n", `\n`)
+
+// JoinValue escapes fields and joins them with semicolons
+// (see SplitValue).
+func JoinValue(fields ...string) string {
+	escaped := make([]string, len(fields))
+	for i, f := range fields {
+		escaped[i] = valueEscaper.Replace(f)
+	}
+	return strings.Join(escaped, ";")
+}
+
+// writeProp writes a property line if value is not empty.
+func writeProp(buf *bytes.Buffer, name, value string) {
+	if value != "" {
+		buf.WriteString(name + ":" + value + "\r\n")
+	}
+}
+
+// foldLine writes a content line, folded in lines of at most
+// 75 octets without splitting UTF-8 sequences (RFC 2425,
+// section 5.8.1).
+func foldLine(buf *bytes.Buffer, line string) {
+	max := 75
+	for len(line) > max {
+		i := max
+		for i > 0 && !utf8.RuneStart(line[i]) {
+			i--
+		}
+		buf.WriteString(line[:i] + "\r\n ")
+		line = line[i:]
+		// continuation lines start with a space.
+		max = 74
+	}
+	buf.WriteString(line + "\r\n")
+}
+
+// formatVTime formats a date or date-time as parsed by parseVTime.
+// Times in time.Local are written without time zone.
+func formatVTime(t time.Time, date bool) string {
+	switch {
+	case t.IsZero():
+		return ""
+	case date:
+		return t.Format("20060102")
+	case t.Location() == time.Local:
+		return t.Format("20060102T150405")
+	default:
+		return t.UTC().Format("20060102T150405Z")
+	}
+}
+
+func dropSpace(r rune) rune {
+	switch r {
+	case ' ', '\t', '\r', '\n':
+		return -1
+	}
+	return r
+}
@@ -0,0 +1,26 @@
+package vobject
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJoinValue(t *testing.T) {
+	fields := []string{`a;b`, `c\d`, "e\nf,g"}
+	orig := append([]string(nil), fields...)
+	const expected = `a\;b;c\\d;e\nf,g`
+	for i := 0; i < 2; i++ {
+		if s := JoinValue(fields...); s != expected {
+			t.Errorf("got %q, expected %q", s, expected)
+		}
+	}
+	if !reflect.DeepEqual(fields, orig) {
+		t.Errorf("JoinValue modified its arguments: %q", fields)
+	}
+	if s := text(fields...); s != `a\;b;c\\d;e\nf\,g` {
+		t.Errorf("got text %q", s)
+	}
+	if got := SplitValue(expected); !reflect.DeepEqual(got, orig) {
+		t.Errorf("SplitValue(%q) = %q", expected, got)
+	}
+}
@@ -0,0 +1,400 @@
+package weechat
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Strings sent by the relay (prefixes, messages, titles) contain
+// color and attribute codes, described in the relay protocol
+// documentation:
+//
+//	\x19 STD            text color from a WeeChat option
+//	\x19 @EXT           text color (extended)
+//	\x19 F (A) STD|EXT  text color, with attributes A
+//	\x19 B STD|EXT      background color
+//	\x19 * (A) STD|EXT [,~] STD|EXT
+//	                    text and background colors
+//	\x19 b X            bar code (ignored)
+//	\x19 \x1C           reset colors, keeping attributes
+//	\x1A A              set attribute
+//	\x1B A              remove attribute
+//	\x1C                reset colors and attributes
+//
+// where STD is a 2-digit color number, EXT is a 5-digit color
+// number and attributes A are among '*' (bold), '!' (reverse),
+// '/' (italic), '_' (underline) and '|' (keep current attributes).
+
+// A Color is a color of rich text: the default color (the zero
+// value), one of the 256 terminal colors, or a color defined by
+// a WeeChat option such as weechat.color.chat_nick, which is
+// identified by its number in the relay protocol.
+type Color int
+
+// TermColor returns the terminal color n (from 0 to 255).
+func TermColor(n int) Color { return Color(n + 1) }
+
+// OptionColor returns the color of WeeChat option number n.
+func OptionColor(n int) Color { return Color(-n - 1) }
+
+// Term returns the terminal color number of c, if c is a terminal color.
+func (c Color) Term() (n int, ok bool) { return int(c) - 1, c > 0 }
+
+// Option returns the WeeChat option number of c, if c is an option color.
+func (c Color) Option() (n int, ok bool) { return int(-c) - 1, c < 0 }
+
+// stdColors maps WeeChat standard colors (black, darkgray, red...)
+// to terminal colors.
+var stdColors = [...]int{
+	-1, // default
+	0, 8, 1, 9, 2, 10, 3, 11, 4, 12, 5, 13, 6, 14, 7, 15,
+}
+
+// Attr is a set of text attributes.
+type Attr uint8
+
+const (
+	AttrBold Attr = 1 << iota
+	AttrReverse
+	AttrItalic
+	AttrUnderline
+)
+
+func attrOf(c byte) Attr {
+	switch c {
+	case '*':
+		return AttrBold
+	case '!':
+		return AttrReverse
+	case '/':
+		return AttrItalic
+	case '_':
+		return AttrUnderline
+	}
+	return 0
+}
+
+// A Style describes how a piece of text is displayed.
+type Style struct {
+	Fg, Bg Color
+	Attrs  Attr
+}
+
+// A Span is a piece of text with a uniform style.
+type Span struct {
+	Style
+	Text string
+}
+
+// RichText is a string split into styled spans.
+type RichText []Span
+
+// ParseColors decodes the color and attribute codes of s.
+// Invalid or truncated codes are dropped.
+func ParseColors(s string) RichText {
+	var t RichText
+	var st Style
+	start := 0
+	var text []byte
+	flush := func() {
+		if len(text) == 0 {
+			return
+		}
+		if n := len(t); n > 0 && t[n-1].Style == st {
+			t[n-1].Text += string(text)
+		} else {
+			t = append(t, Span{Style: st, Text: string(text)})
+		}
+		text = text[:0]
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c != '\x19' && c != '\x1A' && c != '\x1B' && c != '\x1C' {
+			i++
+			continue
+		}
+		text = append(text, s[start:i]...)
+		flush()
+		i++
+		switch c {
+		case '\x1A', '\x1B':
+			if i < len(s) {
+				if c == '\x1A' {
+					st.Attrs |= attrOf(s[i])
+				} else {
+					st.Attrs &^= attrOf(s[i])
+				}
+				i++
+			}
+		case '\x1C':
+			st = Style{}
+		case '\x19':
+			i += parseColorCode(s[i:], &st)
+		}
+		start = i
+	}
+	text = append(text, s[start:]...)
+	flush()
+	return t
+}
+
+// parseColorCode applies the code following a \x19 byte to st
+// and returns its length.
+func parseColorCode(s string, st *Style) int {
+	if len(s) == 0 {
+		return 0
+	}
+	switch s[0] {
+	case '\x1C':
+		st.Fg, st.Bg = 0, 0
+		return 1
+	case 'F':
+		attrs, n := parseAttrs(s[1:], st.Attrs)
+		c, m := parseColor(s[1+n:], false)
+		if m == 0 {
+			return 1 + n + truncatedColor(s[1+n:])
+		}
+		st.Fg, st.Attrs = c, attrs
+		return 1 + n + m
+	case 'B':
+		c, m := parseColor(s[1:], false)
+		if m == 0 {
+			return 1 + truncatedColor(s[1:])
+		}
+		st.Bg = c
+		return 1 + m
+	case '*':
+		attrs, n := parseAttrs(s[1:], st.Attrs)
+		c, m := parseColor(s[1+n:], false)
+		if m == 0 {
+			return 1 + n + truncatedColor(s[1+n:])
+		}
+		st.Fg, st.Attrs = c, attrs
+		n += 1 + m
+		if n < len(s) && (s[n] == ',' || s[n] == '~') {
+			bg, m := parseColor(s[n+1:], false)
+			if m > 0 {
+				st.Bg = bg
+				n += 1 + m
+			} else if m = truncatedColor(s[n+1:]); m > 0 {
+				n += 1 + m
+			}
+		}
+		return n
+	case 'b':
+		// bar codes: one more byte.
+		if len(s) >= 2 {
+			return 2
+		}
+		return 1
+	case 'E':
+		// emphasis (unused by the relay)
+		return 1
+	}
+	c, m := parseColor(s, true)
+	if m == 0 {
+		return truncatedColor(s)
+	}
+	st.Fg = c
+	return m
+}
+
+// parseAttrs reads attribute characters. Unless the '|' character
+// is present, attributes replace the current ones.
+func parseAttrs(s string, cur Attr) (Attr, int) {
+	var attrs Attr
+	keep := false
+	n := 0
+	for ; n < len(s); n++ {
+		if s[n] == '|' {
+			keep = true
+		} else if a := attrOf(s[n]); a != 0 {
+			attrs |= a
+		} else {
+			break
+		}
+	}
+	if keep {
+		attrs |= cur
+	}
+	return attrs, n
+}
+
+// parseColor reads a STD or EXT color and returns its length, or 0
+// if s does not start with a color. Standard colors are option
+// colors if option is true.
+func parseColor(s string, option bool) (Color, int) {
+	if len(s) >= 6 && s[0] == '@' && isDigits(s[1:6]) {
+		n, _ := strconv.Atoi(s[1:6])
+		if n > 255 {
+			return 0, 6
+		}
+		return TermColor(n), 6
+	}
+	if len(s) >= 2 && isDigits(s[:2]) {
+		n, _ := strconv.Atoi(s[:2])
+		switch {
+		case option:
+			return OptionColor(n), 2
+		case n < len(stdColors) && stdColors[n] >= 0:
+			return TermColor(stdColors[n]), 2
+		}
+		return 0, 2
+	}
+	return 0, 0
+}
+
+// truncatedColor returns the length of s if it is the beginning
+// of a color cut by the end of the text, and zero otherwise.
+func truncatedColor(s string) int {
+	switch {
+	case len(s) == 1 && isDigits(s):
+		return 1
+	case len(s) > 0 && len(s) < 6 && s[0] == '@' && isDigits(s[1:]):
+		return len(s)
+	}
+	return 0
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the text without styles.
+func (t RichText) String() string {
+	var buf strings.Builder
+	for _, sp := range t {
+		buf.WriteString(sp.Text)
+	}
+	return buf.String()
+}
+
+// HTML renders the text as HTML, using <span> elements with inline
+// styles for terminal colors and attributes. Option colors use CSS
+// classes "weechat-color-N".
+func (t RichText) HTML() string {
+	var buf bytes.Buffer
+	t.WriteHTML(&buf, html.EscapeString)
+	return buf.String()
+}
+
+// WriteHTML renders the text as HTML like HTML, where escape
+// converts the text of each span to HTML.
+func (t RichText) WriteHTML(w io.Writer, escape func(string) string) {
+	for _, sp := range t {
+		if sp.Style == (Style{}) {
+			io.WriteString(w, escape(sp.Text))
+			continue
+		}
+		fg, bg := sp.Fg, sp.Bg
+		var class, style []string
+		if sp.Attrs&AttrReverse != 0 {
+			fg, bg = bg, fg
+			class = append(class, "weechat-reverse")
+		}
+		if n, ok := fg.Option(); ok {
+			class = append(class, fmt.Sprintf("weechat-color-%d", n))
+		} else if n, ok := fg.Term(); ok {
+			style = append(style, "color:"+termRGB(n))
+		}
+		if n, ok := bg.Term(); ok {
+			style = append(style, "background-color:"+termRGB(n))
+		}
+		if sp.Attrs&AttrBold != 0 {
+			style = append(style, "font-weight:bold")
+		}
+		if sp.Attrs&AttrItalic != 0 {
+			style = append(style, "font-style:italic")
+		}
+		if sp.Attrs&AttrUnderline != 0 {
+			style = append(style, "text-decoration:underline")
+		}
+		io.WriteString(w, "<span")
+		if len(class) > 0 {
+			fmt.Fprintf(w, ` class="%s"`, strings.Join(class, " "))
+		}
+		if len(style) > 0 {
+			fmt.Fprintf(w, ` style="%s"`, strings.Join(style, ";"))
+		}
+		io.WriteString(w, ">")
+		io.WriteString(w, escape(sp.Text))
+		io.WriteString(w, "</span>")
+	}
+}
+
+var basicRGB = [16]string{
+	"#000000", "#800000", "#008000", "#808000",
+	"#000080", "#800080", "#008080", "#c0c0c0",
+	"#808080", "#ff0000", "#00ff00", "#ffff00",
+	"#0000ff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// termRGB returns the CSS color of terminal color n, following
+// the xterm palette.
+func termRGB(n int) string {
+	switch {
+	case n < 16:
+		return basicRGB[n]
+	case n < 232:
+		n -= 16
+		level := func(x int) int {
+			if x == 0 {
+				return 0
+			}
+			return 55 + 40*x
+		}
+		return fmt.Sprintf("#%02x%02x%02x", level(n/36), level(n/6%6), level(n%6))
+	default:
+		g := 8 + 10*(n-232)
+		return fmt.Sprintf("#%02x%02x%02x", g, g, g)
+	}
+}
+
+// ANSI renders the text with ANSI escape sequences for terminals
+// supporting 256 colors. Option colors are not rendered.
+func (t RichText) ANSI() string {
+	var buf strings.Builder
+	styled := false
+	for _, sp := range t {
+		var codes []string
+		if sp.Attrs&AttrBold != 0 {
+			codes = append(codes, "1")
+		}
+		if sp.Attrs&AttrItalic != 0 {
+			codes = append(codes, "3")
+		}
+		if sp.Attrs&AttrUnderline != 0 {
+			codes = append(codes, "4")
+		}
+		if sp.Attrs&AttrReverse != 0 {
+			codes = append(codes, "7")
+		}
+		if n, ok := sp.Fg.Term(); ok {
+			codes = append(codes, "38;5;"+strconv.Itoa(n))
+		}
+		if n, ok := sp.Bg.Term(); ok {
+			codes = append(codes, "48;5;"+strconv.Itoa(n))
+		}
+		if styled {
+			buf.WriteString("\x1b[0m")
+		}
+		styled = len(codes) > 0
+		if styled {
+			buf.WriteString("\x1b[" + strings.Join(codes, ";") + "m")
+		}
+		buf.WriteString(sp.Text)
+	}
+	if styled {
+		buf.WriteString("\x1b[0m")
+	}
+	return buf.String()
+}
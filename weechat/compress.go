@@ -0,0 +1,94 @@
+package weechat
+
+import (
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Compression algorithms understood by the relay. The byte
+// following the length of each message identifies the algorithm.
+// The package decodes zlib; zstd (WeeChat >= 3.5) is negotiated
+// once a decoder is registered with RegisterDecompressor.
+const (
+	CompressOff  = "off"
+	CompressZlib = "zlib"
+	CompressZstd = "zstd"
+)
+
+// A Decompressor returns a reader decompressing data read from r.
+type Decompressor func(r io.Reader) (io.ReadCloser, error)
+
+type decompressor struct {
+	name      string
+	newReader Decompressor
+}
+
+var (
+	decompLock    sync.RWMutex
+	decompressors = map[byte]decompressor{
+		1: {CompressZlib, zlib.NewReader},
+	}
+)
+
+// RegisterDecompressor makes a compression algorithm available
+// to connections, where flag is the value of the compression
+// byte in message headers. The package only provides zlib, but
+// zstd (flag 2) can be enabled using a third-party decoder:
+//
+//	weechat.RegisterDecompressor(weechat.CompressZstd, 2,
+//	    func(r io.Reader) (io.ReadCloser, error) {
+//	        d, err := zstd.NewReader(r)
+//	        return d.IOReadCloser(), err
+//	    })
+func RegisterDecompressor(name string, flag byte, dec Decompressor) {
+	decompLock.Lock()
+	defer decompLock.Unlock()
+	decompressors[flag] = decompressor{name: name, newReader: dec}
+}
+
+func getDecompressor(flag byte) (decompressor, bool) {
+	decompLock.RLock()
+	defer decompLock.RUnlock()
+	d, ok := decompressors[flag]
+	return d, ok
+}
+
+func isRegistered(name string) bool {
+	decompLock.RLock()
+	defer decompLock.RUnlock()
+	for _, d := range decompressors {
+		if d.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// compressionOptions returns the values of the compression option
+// for handshake and init commands.
+func (cfg *DialConfig) compressionOptions() (handshake, init string, err error) {
+	var algos []string
+	for _, c := range cfg.Compression {
+		if c != CompressOff && !isRegistered(c) {
+			return "", "", fmt.Errorf("weechat: unsupported compression %q", c)
+		}
+		algos = append(algos, c)
+	}
+	if len(algos) == 0 {
+		algos = []string{CompressOff}
+	}
+	if cfg.Handshake {
+		// init does not accept compression after a handshake.
+		return strings.Join(algos, ":"), "", nil
+	}
+	// Without handshake, only zlib can be requested.
+	for _, c := range algos {
+		if c == CompressZlib || c == CompressOff {
+			return "", c, nil
+		}
+	}
+	return "", "", fmt.Errorf("weechat: compression %s requires handshake", algos[0])
+}
@@ -0,0 +1,461 @@
+package weechat
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An Encoder serializes Go values into relay messages, following
+// the rules of Decode in reverse. A message is built by calling
+// Reset with the message identifier, then Encode or EncodeHData
+// for each object, and Message to obtain the framed bytes.
+//
+// Go values map to relay objects as follows: bool and uint8 to chr,
+// int and int32 (and smaller integers) to int, int64 to lon, string
+// to str, []byte to buf, uint64 and uintptr to ptr, time.Time to tim,
+// other slices to arr, maps to htb, HData to hda, Info to inf and
+// Infolist to inl.
+type Encoder struct {
+	// Compress enables zlib compression of messages.
+	Compress bool
+	// Level is the zlib compression level, from zlib.BestSpeed to
+	// zlib.BestCompression. Zero means zlib.DefaultCompression.
+	Level int
+
+	buf []byte
+}
+
+// Reset discards the current message and starts a new message
+// with the given identifier.
+func (e *Encoder) Reset(id string) {
+	e.buf = e.buf[:0]
+	e.str(id)
+}
+
+// Message returns the current message with its header, compressed
+// if needed. The result is not modified by later calls to Reset.
+func (e *Encoder) Message() []byte {
+	body, flag := e.buf, byte(0)
+	if e.Compress {
+		var z bytes.Buffer
+		level := e.Level
+		if level == 0 {
+			level = zlib.DefaultCompression
+		}
+		w, err := zlib.NewWriterLevel(&z, level)
+		if err != nil {
+			// invalid level.
+			w = zlib.NewWriter(&z)
+		}
+		w.Write(body)
+		w.Close()
+		body, flag = z.Bytes(), 1
+	}
+	out := make([]byte, 5, 5+len(body))
+	binary.BigEndian.PutUint32(out[:4], uint32(len(out)+len(body)))
+	out[4] = flag
+	return append(out, body...)
+}
+
+// Encode appends v as an object to the current message.
+func (e *Encoder) Encode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	typ, err := typeOf(rv)
+	if err != nil {
+		return err
+	}
+	e.typ(typ)
+	return e.encodeValue(typ, rv)
+}
+
+// EncodeHData appends a hdata object to the current message.
+// The path is a h-path like "buffer/lines/line/line_data" and
+// v is a slice of structs: pointers and variables are taken from
+// tagged fields, as in Decode.
+func (e *Encoder) EncodeHData(path string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("weechat: cannot encode %T as hdata", v)
+	}
+	hpath := strings.Split(path, "/")
+	ptrs := make([][]int, len(hpath))
+	var keys, ktypes []string
+	var fields [][]int
+	for _, fld := range structFields(rv.Type().Elem()) {
+		tag := fld.Tag.Get("weechat")
+		switch {
+		case tag == "":
+			continue
+		case strings.HasPrefix(tag, "ptr:"):
+			if !isPointerKind(fld.Type.Kind()) {
+				return fmt.Errorf("weechat: field %s: cannot encode %s as a pointer", fld.Name, fld.Type)
+			}
+			for i, h := range hpath {
+				if h == tag[4:] {
+					ptrs[i] = fld.Index
+				}
+			}
+			continue
+		}
+		typ, err := goType(fld.Type)
+		if err != nil {
+			return fmt.Errorf("weechat: field %s: %s", fld.Name, err)
+		}
+		keys = append(keys, tag+":"+typ)
+		ktypes = append(ktypes, typ)
+		fields = append(fields, fld.Index)
+	}
+
+	e.typ(typeHdata)
+	e.str(path)
+	e.str(strings.Join(keys, ","))
+	e.int(int32(rv.Len()))
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i)
+		for _, idx := range ptrs {
+			var p uint64
+			if idx != nil {
+				var err error
+				if p, err = pointerValue(item.FieldByIndex(idx)); err != nil {
+					return err
+				}
+			}
+			e.ptr(p)
+		}
+		for k, idx := range fields {
+			if err := e.encodeValue(ktypes[k], item.FieldByIndex(idx)); err != nil {
+				return fmt.Errorf("%s: %s", keys[k], err)
+			}
+		}
+	}
+	return nil
+}
+
+// isPointerKind reports whether pointers can be stored in values
+// of kind k: integers, or strings such as "0x12ab".
+func isPointerKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.String:
+		return true
+	}
+	return false
+}
+
+// pointerValue returns the pointer stored in v, as set by setPointer.
+func pointerValue(v reflect.Value) (uint64, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int()), nil
+	case reflect.String:
+		s := v.String()
+		if s == "" {
+			return 0, nil
+		}
+		p, err := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("weechat: invalid pointer %q", s)
+		}
+		return p, nil
+	}
+	return v.Uint(), nil
+}
+
+func (e *Encoder) typ(t string) { e.buf = append(e.buf, t...) }
+
+func (e *Encoder) int(n int32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(n))
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *Encoder) shortString(s string) {
+	e.buf = append(e.buf, byte(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *Encoder) str(s string) {
+	e.int(int32(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *Encoder) ptr(p uint64) { e.shortString(strconv.FormatUint(p, 16)) }
+
+// goType returns the relay type of values of Go type t.
+// Empty interfaces have no static type.
+func goType(t reflect.Type) (string, error) {
+	switch t {
+	case timeType:
+		return typeTime, nil
+	case hdataType, reflect.PtrTo(hdataType):
+		return typeHdata, nil
+	case infoType:
+		return typeInfo, nil
+	case infolistType:
+		return typeInfos, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.Uint8:
+		return typeChar, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint16, reflect.Uint32:
+		return typeInt, nil
+	case reflect.Int64:
+		return typeLong, nil
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return typePtr, nil
+	case reflect.String:
+		return typeString, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return typeBytes, nil
+		}
+		return typeArray, nil
+	case reflect.Map:
+		return typeMap, nil
+	}
+	return "", fmt.Errorf("weechat: cannot encode %s", t)
+}
+
+// typeOf returns the relay type of v, looking at the dynamic
+// type of interfaces.
+func typeOf(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return "", fmt.Errorf("weechat: cannot encode nil value")
+	}
+	return goType(v.Type())
+}
+
+// elemType returns the relay type of elements of v (a slice or
+// the keys or values of a map), which must all have the same type.
+func elemType(t reflect.Type, elems []reflect.Value) (string, error) {
+	if t.Kind() != reflect.Interface {
+		return goType(t)
+	}
+	if len(elems) == 0 {
+		return typeString, nil
+	}
+	typ, err := typeOf(elems[0])
+	if err != nil {
+		return "", err
+	}
+	for _, x := range elems[1:] {
+		if t, err := typeOf(x); err != nil || t != typ {
+			return "", fmt.Errorf("weechat: cannot encode mixed %s and %s values", typ, t)
+		}
+	}
+	return typ, nil
+}
+
+func errCannotEncode(typ string, v reflect.Value) error {
+	return fmt.Errorf("weechat: cannot encode %s as %s", v.Type(), typ)
+}
+
+// encodeValue appends the value of v as an object of type typ,
+// without the type prefix.
+func (e *Encoder) encodeValue(typ string, v reflect.Value) error {
+	for v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return fmt.Errorf("weechat: cannot encode nil value as %s", typ)
+	}
+	var n int64
+	isInt := true
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			n = 1
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n = int64(v.Uint())
+	default:
+		isInt = false
+	}
+
+	switch typ {
+	case typeChar:
+		if !isInt {
+			return errCannotEncode(typ, v)
+		}
+		e.buf = append(e.buf, byte(n))
+	case typeInt:
+		if !isInt {
+			return errCannotEncode(typ, v)
+		}
+		e.int(int32(n))
+	case typeLong:
+		if !isInt {
+			return errCannotEncode(typ, v)
+		}
+		e.shortString(strconv.FormatInt(n, 10))
+	case typePtr:
+		if !isInt {
+			return errCannotEncode(typ, v)
+		}
+		e.ptr(uint64(n))
+	case typeString, typeBytes:
+		switch {
+		case v.Kind() == reflect.String:
+			e.str(v.String())
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			if v.IsNil() {
+				e.int(-1)
+			} else {
+				e.str(string(v.Bytes()))
+			}
+		default:
+			return errCannotEncode(typ, v)
+		}
+	case typeTime:
+		if v.Type() != timeType {
+			return errCannotEncode(typ, v)
+		}
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			e.shortString("0")
+		} else {
+			e.shortString(strconv.FormatInt(t.Unix(), 10))
+		}
+	case typeArray:
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return errCannotEncode(typ, v)
+		}
+		elems := make([]reflect.Value, v.Len())
+		for i := range elems {
+			elems[i] = v.Index(i)
+		}
+		elem, err := elemType(v.Type().Elem(), elems)
+		if err != nil {
+			return err
+		}
+		e.typ(elem)
+		e.int(int32(len(elems)))
+		for _, x := range elems {
+			if err := e.encodeValue(elem, x); err != nil {
+				return err
+			}
+		}
+	case typeMap:
+		if v.Kind() != reflect.Map {
+			return errCannotEncode(typ, v)
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		vals := make([]reflect.Value, len(keys))
+		for i, k := range keys {
+			vals[i] = v.MapIndex(k)
+		}
+		tkey, err := elemType(v.Type().Key(), keys)
+		if err != nil {
+			return err
+		}
+		tval, err := elemType(v.Type().Elem(), vals)
+		if err != nil {
+			return err
+		}
+		e.typ(tkey)
+		e.typ(tval)
+		e.int(int32(len(keys)))
+		for i := range keys {
+			if err := e.encodeValue(tkey, keys[i]); err != nil {
+				return err
+			}
+			if err := e.encodeValue(tval, vals[i]); err != nil {
+				return err
+			}
+		}
+	case typeHdata:
+		switch {
+		case v.Type() == hdataType:
+			return e.hdata(v.Interface().(HData))
+		case v.Type() == reflect.PtrTo(hdataType) && !v.IsNil():
+			return e.hdata(*v.Interface().(*HData))
+		}
+		return errCannotEncode(typ, v)
+	case typeInfo:
+		if v.Type() != infoType {
+			return errCannotEncode(typ, v)
+		}
+		info := v.Interface().(Info)
+		e.str(info.Name)
+		e.str(info.Value)
+	case typeInfos:
+		if v.Type() != infolistType {
+			return errCannotEncode(typ, v)
+		}
+		return e.infolist(v.Interface().(Infolist))
+	default:
+		return fmt.Errorf("weechat: unknown type %q", typ)
+	}
+	return nil
+}
+
+func (e *Encoder) hdata(h HData) error {
+	if len(h.Keys) != len(h.Types) {
+		return fmt.Errorf("weechat: hdata has %d keys and %d types", len(h.Keys), len(h.Types))
+	}
+	keys := make([]string, len(h.Keys))
+	for i, k := range h.Keys {
+		keys[i] = k + ":" + h.Types[i]
+	}
+	e.str(strings.Join(h.Path, "/"))
+	e.str(strings.Join(keys, ","))
+	e.int(int32(len(h.Items)))
+	for _, item := range h.Items {
+		if len(item.Pointers) != len(h.Path) {
+			return fmt.Errorf("weechat: hdata item has %d pointers for path %s",
+				len(item.Pointers), strings.Join(h.Path, "/"))
+		}
+		for _, p := range item.Pointers {
+			e.ptr(p)
+		}
+		for i, k := range h.Keys {
+			err := e.encodeValue(h.Types[i], reflect.ValueOf(item.Values[k]))
+			if err != nil {
+				return fmt.Errorf("%s: %s", k, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) infolist(list Infolist) error {
+	e.str(list.Name)
+	e.int(int32(len(list.Items)))
+	for _, item := range list.Items {
+		names := make([]string, 0, len(item))
+		for k := range item {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		e.int(int32(len(names)))
+		for _, k := range names {
+			v := reflect.ValueOf(item[k])
+			typ, err := typeOf(v)
+			if err != nil {
+				return fmt.Errorf("%s: %s", k, err)
+			}
+			e.str(k)
+			e.typ(typ)
+			if err := e.encodeValue(typ, v); err != nil {
+				return fmt.Errorf("%s: %s", k, err)
+			}
+		}
+	}
+	return nil
+}
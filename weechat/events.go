@@ -0,0 +1,171 @@
+package weechat
+
+import (
+	"strings"
+)
+
+// An Event is a message pushed by the relay to a client
+// after a Sync command.
+type Event interface {
+	event()
+}
+
+// LineAdded is pushed when a line is displayed in a buffer.
+type LineAdded struct {
+	Line LineData
+}
+
+// BufferOpened is pushed when a new buffer is created.
+type BufferOpened struct {
+	Buffer Buffer
+}
+
+// BufferClosed is pushed when a buffer is about to be closed.
+type BufferClosed struct {
+	Buffer Buffer
+}
+
+// BufferRenamed is pushed when a buffer changes its name.
+type BufferRenamed struct {
+	Buffer Buffer
+}
+
+// Nicklist carries the complete nicklist of one or several
+// buffers.
+type Nicklist struct {
+	Nicks []Nick
+}
+
+// NicklistDiff carries a list of changes to the nicklist of
+// one or several buffers.
+type NicklistDiff struct {
+	Diffs []NickDiff
+}
+
+func (LineAdded) event()     {}
+func (BufferOpened) event()  {}
+func (BufferClosed) event()  {}
+func (BufferRenamed) event() {}
+func (Nicklist) event()      {}
+func (NicklistDiff) event()  {}
+
+// Sync subscribes to updates of the given buffers (by full name
+// or pointer), or all buffers if none is given. Events are delivered
+// on the returned channel, which is the same for all calls and
+// is closed when the connection terminates.
+func (conn *Conn) Sync(buffers ...string) (<-chan Event, error) {
+	conn.evlock.Lock()
+	if conn.closed {
+		conn.evlock.Unlock()
+		return nil, errClosed
+	}
+	if conn.events == nil {
+		conn.events = make(chan Event)
+		conn.evout = make(chan Event)
+		go pumpEvents(conn.events, conn.evout)
+	}
+	out := conn.evout
+	conn.evlock.Unlock()
+
+	err := conn.sendSync(cmdSync, buffers)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Desync stops updates for the given buffers, or all buffers
+// if none is given. The event channel stays open.
+func (conn *Conn) Desync(buffers ...string) error {
+	return conn.sendSync(cmdDesync, buffers)
+}
+
+func (conn *Conn) sendSync(cmd command, buffers []string) error {
+	arg := "*"
+	if len(buffers) > 0 {
+		arg = strings.Join(buffers, ",")
+	}
+	return conn.send("", cmd, arg)
+}
+
+// dispatch decodes an event message and forwards it to
+// subscribers, if any.
+func (conn *Conn) dispatch(id string, msg message) {
+	conn.evlock.Lock()
+	defer conn.evlock.Unlock()
+	if conn.events == nil {
+		debugf("ignoring event %s before sync", id)
+		return
+	}
+	var err error
+	switch id {
+	case "_buffer_line_added":
+		var lines []LineData
+		err = msg.HData(&lines)
+		for _, l := range lines {
+			conn.events <- LineAdded{Line: l}
+		}
+	case "_buffer_opened", "_buffer_closing", "_buffer_renamed":
+		var bufs []Buffer
+		err = msg.HData(&bufs)
+		for _, b := range bufs {
+			switch id {
+			case "_buffer_opened":
+				conn.events <- BufferOpened{Buffer: b}
+			case "_buffer_closing":
+				conn.events <- BufferClosed{Buffer: b}
+			case "_buffer_renamed":
+				conn.events <- BufferRenamed{Buffer: b}
+			}
+		}
+	case "_nicklist":
+		var nicks []Nick
+		if err = msg.HData(&nicks); err == nil {
+			conn.events <- Nicklist{Nicks: nicks}
+		}
+	case "_nicklist_diff":
+		var diffs []NickDiff
+		if err = msg.HData(&diffs); err == nil {
+			conn.events <- NicklistDiff{Diffs: diffs}
+		}
+	default:
+		debugf("ignoring event %s", id)
+	}
+	if err != nil {
+		debugf("invalid event %s: %s", id, err)
+	}
+}
+
+func (conn *Conn) closeEvents() {
+	conn.evlock.Lock()
+	defer conn.evlock.Unlock()
+	conn.closed = true
+	if conn.events != nil {
+		close(conn.events)
+	}
+}
+
+// pumpEvents forwards events from in to out, queueing them
+// so that a slow reader does not stall the connection.
+func pumpEvents(in <-chan Event, out chan<- Event) {
+	var queue []Event
+	for in != nil || len(queue) > 0 {
+		var send chan<- Event
+		var next Event
+		if len(queue) > 0 {
+			send, next = out, queue[0]
+		}
+		select {
+		case ev, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			queue = append(queue, ev)
+		case send <- next:
+			queue[0] = nil
+			queue = queue[1:]
+		}
+	}
+	close(out)
+}
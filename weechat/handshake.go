@@ -0,0 +1,244 @@
+package weechat
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A DialConfig describes how to connect and authenticate to a relay.
+type DialConfig struct {
+	// Password is the relay password (option relay.network.password).
+	Password string
+	// TOTP is the time-based one-time password, if the relay
+	// requires one (option relay.network.totp_secret).
+	TOTP string
+
+	// Handshake enables the handshake command (relay protocol 2.x,
+	// WeeChat >= 2.9), which negotiates a salted password hash instead
+	// of sending the password in clear text.
+	Handshake bool
+	// HashAlgos lists the accepted password hash algorithms, by order
+	// of preference. The default is all supported algorithms.
+	HashAlgos []string
+
+	// TLS, if not nil, is the configuration of the TLS client.
+	TLS *tls.Config
+	// PinnedCerts, if not empty, enables TLS and restricts the
+	// accepted server certificates to the ones whose SHA-256 digest
+	// is listed. Certificate chains are then not verified.
+	PinnedCerts [][sha256.Size]byte
+
+	// Compression lists the accepted compression algorithms by order
+	// of preference, for example CompressZstd, CompressZlib,
+	// CompressOff. The default is no compression. zstd requires a
+	// handshake and a decompressor, see RegisterDecompressor. The
+	// compression level is a relay setting (relay.network.compression).
+	Compression []string
+
+	// Timeout bounds the duration of connection and authentication.
+	// The default is DefaultTimeout: a relay which silently ignores
+	// init would otherwise block the client forever.
+	Timeout time.Duration
+}
+
+// DefaultTimeout is the default DialConfig.Timeout.
+const DefaultTimeout = 30 * time.Second
+
+// Password hash algorithms supported by the relay handshake.
+const (
+	HashPlain        = "plain"
+	HashSHA256       = "sha256"
+	HashSHA512       = "sha512"
+	HashPBKDF2SHA256 = "pbkdf2+sha256"
+	HashPBKDF2SHA512 = "pbkdf2+sha512"
+)
+
+var defaultHashAlgos = []string{
+	HashPBKDF2SHA512, HashPBKDF2SHA256,
+	HashSHA512, HashSHA256,
+	HashPlain,
+}
+
+var (
+	errAuthFailed   = errors.New("weechat: authentication failed")
+	errBadNonce     = errors.New("weechat: invalid nonce in handshake")
+	errCertMismatch = errors.New("weechat: server certificate does not match pinned certificates")
+)
+
+func (cfg *DialConfig) tlsConfig(addr string) *tls.Config {
+	var tc *tls.Config
+	if cfg.TLS != nil {
+		tc = cfg.TLS.Clone()
+	} else {
+		tc = new(tls.Config)
+	}
+	if tc.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err == nil {
+			tc.ServerName = host
+		}
+	}
+	if len(cfg.PinnedCerts) > 0 {
+		pins := cfg.PinnedCerts
+		tc.InsecureSkipVerify = true
+		tc.VerifyPeerCertificate = func(certs [][]byte, _ [][]*x509.Certificate) error {
+			if len(certs) == 0 {
+				return errCertMismatch
+			}
+			sum := sha256.Sum256(certs[0])
+			for _, pin := range pins {
+				if sum == pin {
+					return nil
+				}
+			}
+			return errCertMismatch
+		}
+	}
+	return tc
+}
+
+// login negotiates authentication with the relay and checks that
+// the relay accepted it.
+func (conn *Conn) login(cfg DialConfig) error {
+	hsCompress, initCompress, err := cfg.compressionOptions()
+	if err != nil {
+		return err
+	}
+	var opts []string
+	if initCompress != "" {
+		opts = append(opts, "compression="+initCompress)
+	}
+	if !cfg.Handshake {
+		if cfg.Password != "" {
+			opts = append(opts, "password="+escapeComma(cfg.Password))
+		}
+	} else {
+		algos := cfg.HashAlgos
+		if len(algos) == 0 {
+			algos = defaultHashAlgos
+		}
+		var params map[string]string
+		err := conn.request(&params, cmdHandshake,
+			"password_hash_algo="+strings.Join(algos, ":")+",compression="+hsCompress)
+		if err != nil {
+			return err
+		}
+		var nonce [16]byte
+		_, err = rand.Read(nonce[:])
+		if err != nil {
+			return err
+		}
+		auth, err := passwordOption(cfg.Password, params, nonce[:])
+		if err != nil {
+			return err
+		}
+		opts = append(opts, auth)
+	}
+	if cfg.TOTP != "" {
+		opts = append(opts, "totp="+cfg.TOTP)
+	}
+	if len(opts) == 0 {
+		err = conn.send("", cmdInit)
+	} else {
+		err = conn.send("", cmdInit, strings.Join(opts, ","))
+	}
+	if err != nil {
+		return err
+	}
+	// The relay does not answer init but closes the connection
+	// when authentication fails.
+	_, err = conn.roundTrip(cmdInfo, "version")
+	if err == errClosed {
+		return errAuthFailed
+	}
+	return err
+}
+
+// passwordOption computes the init option carrying the password
+// for the parameters returned by the handshake and the given
+// client nonce.
+func passwordOption(password string, params map[string]string, clientNonce []byte) (string, error) {
+	algo := params["password_hash_algo"]
+	if algo == HashPlain {
+		return "password=" + escapeComma(password), nil
+	}
+	serverNonce, err := hex.DecodeString(params["nonce"])
+	if err != nil || len(serverNonce) == 0 {
+		return "", errBadNonce
+	}
+	salt := append(serverNonce, clientNonce...)
+	hexSalt := hex.EncodeToString(salt)
+
+	var h func() hash.Hash
+	switch algo {
+	case HashSHA256, HashPBKDF2SHA256:
+		h = sha256.New
+	case HashSHA512, HashPBKDF2SHA512:
+		h = sha512.New
+	default:
+		return "", fmt.Errorf("weechat: unsupported password hash algorithm %q", algo)
+	}
+	switch algo {
+	case HashSHA256, HashSHA512:
+		d := h()
+		d.Write(salt)
+		d.Write([]byte(password))
+		sum := hex.EncodeToString(d.Sum(nil))
+		return "password_hash=" + algo + ":" + hexSalt + ":" + sum, nil
+	default:
+		iter, err := strconv.Atoi(params["password_hash_iterations"])
+		if err != nil || iter <= 0 {
+			return "", fmt.Errorf("weechat: invalid iteration count %q", params["password_hash_iterations"])
+		}
+		key := pbkdf2([]byte(password), salt, iter, h().Size(), h)
+		sum := hex.EncodeToString(key)
+		return fmt.Sprintf("password_hash=%s:%s:%d:%s", algo, hexSalt, iter, sum), nil
+	}
+}
+
+// escapeComma escapes commas in an init option value.
+func escapeComma(s string) string {
+	return strings.Replace(s, ",", `\,`, -1)
+}
+
+// pbkdf2 implements the key derivation function of RFC 2898.
+func pbkdf2(password, salt []byte, iter, keyLen int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	size := prf.Size()
+	nblocks := (keyLen + size - 1) / size
+	var key bytes.Buffer
+	var idx [4]byte
+	u := make([]byte, 0, size)
+	t := make([]byte, size)
+	for block := 1; block <= nblocks; block++ {
+		idx[0], idx[1], idx[2], idx[3] = byte(block>>24), byte(block>>16), byte(block>>8), byte(block)
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(idx[:])
+		u = prf.Sum(u[:0])
+		copy(t, u)
+		for n := 1; n < iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+		key.Write(t)
+	}
+	return key.Bytes()[:keyLen]
+}
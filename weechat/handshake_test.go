@@ -0,0 +1,297 @@
+package weechat
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// Test vectors for PBKDF2-HMAC-SHA256.
+	for _, test := range []struct {
+		iter int
+		key  string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	} {
+		key := pbkdf2([]byte("password"), []byte("salt"), test.iter, 32, sha256.New)
+		if s := hex.EncodeToString(key); s != test.key {
+			t.Errorf("iter=%d: got %s, expected %s", test.iter, s, test.key)
+		}
+	}
+}
+
+func TestPasswordOption(t *testing.T) {
+	// Expected hashes computed with Python's hashlib.
+	const salt = "000102030405060708090a0b0c0d0e0fa0a1a2a3a4a5a6a7a8a9aaabacadaeaf"
+	clientNonce, _ := hex.DecodeString(salt[32:])
+	for _, test := range []struct {
+		algo     string
+		expected string
+	}{
+		{HashPlain, "password=sec\\,ret"},
+		{HashSHA256, "password_hash=sha256:" + salt +
+			":cb2df5ad2efbc51ec84147b44bd5e94f0264df14c8074f468da1d0fba0d29fe1"},
+		{HashSHA512, "password_hash=sha512:" + salt +
+			":4f13c7ff5752fe14e6c31ab9b7c68d288da204cb837e49806400039df7c60f5a" +
+			"599c572a21a1ce017d941ddfe88dd7c2ae6c89ca44008d471eb1a8c8d80f0631"},
+		{HashPBKDF2SHA256, "password_hash=pbkdf2+sha256:" + salt +
+			":1000:fb4eac735b33132b3622dbc0438b1101b1cb8b98bfc870a1e393426bb00dda3b"},
+		{HashPBKDF2SHA512, "password_hash=pbkdf2+sha512:" + salt +
+			":1000:45ff808700120671412f91f4d66bef8da6aae67ef880e120ea310e801b16c0ca" +
+			"ad635447e4000247071ba32ab18931e863db57315f58802a86228f43ee420d2e"},
+	} {
+		password := "secret"
+		if test.algo == HashPlain {
+			password = "sec,ret"
+		}
+		params := map[string]string{
+			"password_hash_algo":       test.algo,
+			"password_hash_iterations": "1000",
+			"nonce":                    salt[:32],
+		}
+		opt, err := passwordOption(password, params, clientNonce)
+		if err != nil || opt != test.expected {
+			t.Errorf("%s: got %q (%v), expected %q", test.algo, opt, err, test.expected)
+		}
+	}
+}
+
+// fakeRelay answers handshake, init and info commands on l,
+// accepting the given password and hash algorithm.
+func fakeRelay(t *testing.T, l net.Listener, password, algo string) {
+	c, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	r := bufio.NewReader(c)
+	nonce := "0123456789abcdef0123456789abcdef"
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSuffix(line, "\n")
+		var id string
+		if strings.HasPrefix(line, "(") {
+			idx := strings.Index(line, ") ")
+			id, line = line[1:idx], line[idx+2:]
+		}
+		words := strings.SplitN(line, " ", 2)
+		switch words[0] {
+		case "handshake":
+			var m []byte
+			m = appendStr(m, id)
+			m = append(m, "htbstrstr"...)
+			m = append(m, 0, 0, 0, 3)
+			m = appendStr(m, "password_hash_algo")
+			m = appendStr(m, algo)
+			m = appendStr(m, "password_hash_iterations")
+			m = appendStr(m, "1000")
+			m = appendStr(m, "nonce")
+			m = appendStr(m, nonce)
+			writeMsg(c, m)
+		case "init":
+			if !checkInit(words[1], password, algo, nonce) {
+				t.Logf("rejecting init %q", words[1])
+				return
+			}
+		case "info":
+			var m []byte
+			m = appendStr(m, id)
+			m = append(m, "inf"...)
+			m = appendStr(m, "version")
+			m = appendStr(m, "4.0.0")
+			writeMsg(c, m)
+		}
+	}
+}
+
+func checkInit(opts, password, algo, nonce string) bool {
+	opts = strings.Replace(opts, `\,`, "\x00", -1)
+	for _, opt := range strings.Split(opts, ",") {
+		opt = strings.Replace(opt, "\x00", ",", -1)
+		switch {
+		case strings.HasPrefix(opt, "password="):
+			return opt[len("password="):] == password
+		case strings.HasPrefix(opt, "password_hash="):
+			parts := strings.Split(opt[len("password_hash="):], ":")
+			if parts[0] != algo || !strings.HasPrefix(parts[1], nonce) {
+				return false
+			}
+			salt, _ := hex.DecodeString(parts[1])
+			var h func() hash.Hash
+			switch algo {
+			case HashSHA256, HashPBKDF2SHA256:
+				h = sha256.New
+			default:
+				h = sha512.New
+			}
+			var sum []byte
+			if strings.HasPrefix(algo, "pbkdf2+") {
+				if len(parts) != 4 || parts[2] != "1000" {
+					return false
+				}
+				sum = pbkdf2([]byte(password), salt, 1000, h().Size(), h)
+			} else {
+				d := h()
+				d.Write(salt)
+				d.Write([]byte(password))
+				sum = d.Sum(nil)
+			}
+			return hex.EncodeToString(sum) == parts[len(parts)-1]
+		}
+	}
+	return password == ""
+}
+
+func appendStr(b []byte, s string) []byte {
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], uint32(len(s)))
+	return append(append(b, l[:]...), s...)
+}
+
+func writeMsg(c net.Conn, m []byte) {
+	var h [5]byte
+	binary.BigEndian.PutUint32(h[:4], uint32(len(m)+5))
+	c.Write(append(h[:], m...))
+}
+
+func TestDialAuth(t *testing.T) {
+	for _, test := range []struct {
+		algo      string
+		handshake bool
+		relayPass string
+		password  string
+		ok        bool
+	}{
+		{"", false, "", "", true},
+		{"", false, "pass,word", "pass,word", true},
+		{"", false, "secret", "", false},
+		{HashPlain, true, "secret", "secret", true},
+		{HashSHA256, true, "secret", "secret", true},
+		{HashSHA512, true, "secret", "secret", true},
+		{HashPBKDF2SHA256, true, "secret", "secret", true},
+		{HashPBKDF2SHA512, true, "secret", "secret", true},
+		{HashPBKDF2SHA512, true, "secret", "wrong", false},
+	} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go fakeRelay(t, l, test.relayPass, test.algo)
+		cfg := DialConfig{
+			Password:  test.password,
+			Handshake: test.handshake,
+			Timeout:   5 * time.Second,
+		}
+		conn, err := DialWithConfig(l.Addr().String(), cfg)
+		if test.ok && err != nil {
+			t.Errorf("algo %q: %s", test.algo, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("algo %q: expected authentication failure", test.algo)
+		}
+		conn.Close()
+		l.Close()
+	}
+}
+
+func TestDialTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "relay"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"relay.example.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for i := 0; i < 3; i++ {
+		go fakeRelay(t, l, "", "")
+	}
+
+	// Pinned certificate.
+	cfg := DialConfig{
+		PinnedCerts: [][sha256.Size]byte{sha256.Sum256(der)},
+		Timeout:     5 * time.Second,
+	}
+	conn, err := DialWithConfig(l.Addr().String(), cfg)
+	if err != nil {
+		t.Fatalf("pinned certificate: %s", err)
+	}
+	conn.Close()
+
+	// Unknown authority.
+	cfg = DialConfig{TLS: &tls.Config{ServerName: "relay.example.com"}, Timeout: 5 * time.Second}
+	conn, err = DialWithConfig(l.Addr().String(), cfg)
+	if err == nil {
+		conn.Close()
+		t.Fatalf("expected certificate error")
+	}
+
+	// Custom CA.
+	pool := x509.NewCertPool()
+	c, _ := x509.ParseCertificate(der)
+	pool.AddCert(c)
+	cfg.TLS.RootCAs = pool
+	conn, err = DialWithConfig(l.Addr().String(), cfg)
+	if err != nil {
+		t.Fatalf("custom CA: %s", err)
+	}
+	conn.Close()
+}
+
+func TestDialTimeout(t *testing.T) {
+	// A relay which never answers.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			defer c.Close()
+			bufio.NewReader(c).WriteTo(ioutil.Discard)
+		}
+	}()
+	start := time.Now()
+	_, err = DialWithConfig(l.Addr().String(), DialConfig{Timeout: 100 * time.Millisecond})
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("dial returned after %s", d)
+	}
+}
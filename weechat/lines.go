@@ -0,0 +1,116 @@
+package weechat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A Cursor is a position in the lines of a buffer, used to page
+// through its history.
+type Cursor struct {
+	Buffer uint64 // pointer to the buffer
+	// Line is a pointer to a line (LineData.Line). If it is zero,
+	// the cursor is at the end of the buffer in the direction
+	// of paging: after the last line for LinesBefore, before
+	// the first line for LinesAfter.
+	Line uint64
+	// Done is set on returned cursors when no more lines
+	// are available in the direction of paging.
+	Done bool
+}
+
+// LinesBefore returns at most n lines preceding the cursor, in
+// chronological order, and a cursor to the first returned line.
+// The filter is a list of keys as in BufferData.
+func (conn *Conn) LinesBefore(c Cursor, n int, filter string) ([]LineData, Cursor, error) {
+	return conn.page(c, n, filter, -1)
+}
+
+// LinesAfter returns at most n lines following the cursor, in
+// chronological order, and a cursor to the last returned line.
+func (conn *Conn) LinesAfter(c Cursor, n int, filter string) ([]LineData, Cursor, error) {
+	return conn.page(c, n, filter, 1)
+}
+
+func (conn *Conn) page(c Cursor, n int, filter string, dir int) ([]LineData, Cursor, error) {
+	if n <= 0 {
+		return nil, c, fmt.Errorf("weechat: invalid page size %d", n)
+	}
+	var path string
+	switch {
+	case c.Line == 0 && dir < 0:
+		path = fmt.Sprintf("buffer:0x%x/lines/last_line(%d)/data", c.Buffer, -n)
+	case c.Line == 0:
+		path = fmt.Sprintf("buffer:0x%x/lines/first_line(%d)/data", c.Buffer, n)
+	default:
+		// the line at the cursor is the first item.
+		path = fmt.Sprintf("line:0x%x(%d)/data", c.Line, dir*(n+1))
+	}
+	var lines []LineData
+	if err := conn.Hdata(&lines, path, filter); err != nil {
+		return nil, c, err
+	}
+	if c.Line != 0 && len(lines) > 0 {
+		lines = lines[1:]
+	}
+	next := Cursor{Buffer: c.Buffer, Line: c.Line, Done: len(lines) < n}
+	if len(lines) > 0 {
+		next.Line = uint64(lines[len(lines)-1].Line)
+	}
+	if dir < 0 {
+		// lines are returned from the cursor backwards.
+		for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+			lines[i], lines[j] = lines[j], lines[i]
+		}
+	}
+	return lines, next, nil
+}
+
+// LinesBetween returns at most n lines preceding the cursor
+// and dated in the range [from, to), in chronological order,
+// and a cursor to continue paging backwards. A zero from or to
+// leaves the range open. Lines are fetched by pages of n lines,
+// so the last page may be empty.
+func (conn *Conn) LinesBetween(c Cursor, from, to time.Time, n int, filter string) ([]LineData, Cursor, error) {
+	if filter != "" && !hasKey(filter, "date") {
+		filter += ",date"
+	}
+	var out []LineData // in reverse order
+	for len(out) < n && !c.Done {
+		page, next, err := conn.LinesBefore(c, n, filter)
+		if err != nil {
+			return nil, c, err
+		}
+		c = next
+		for i := len(page) - 1; i >= 0; i-- {
+			l := page[i]
+			if !from.IsZero() && l.Date.Before(from) {
+				c.Done = true
+				break
+			}
+			if !to.IsZero() && !l.Date.Before(to) {
+				continue
+			}
+			out = append(out, l)
+			if len(out) == n {
+				c.Line = uint64(l.Line)
+				c.Done = i == 0 && next.Done
+				break
+			}
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, c, nil
+}
+
+func hasKey(filter, key string) bool {
+	for _, k := range strings.Split(filter, ",") {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package weechat_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/weechat"
+	"github.com/remyoudompheng/go-misc/weechat/relaytest"
+)
+
+func TestPaging(t *testing.T) {
+	relay := relaytest.NewServer()
+	defer relay.Close()
+	b := relay.AddBuffer("irc.libera.#go")
+	start := time.Unix(1600000000, 0)
+	for i := 0; i < 10; i++ {
+		relay.AddLine(b, relaytest.Line{
+			Date:    start.Add(time.Duration(i) * time.Minute),
+			Message: fmt.Sprint(i),
+		})
+	}
+
+	conn, err := weechat.Dial(relay.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	messages := func(lines []weechat.LineData) string {
+		s := ""
+		for _, l := range lines {
+			s += l.Message
+		}
+		return s
+	}
+
+	// Backwards from the end.
+	c := weechat.Cursor{Buffer: b.Ptr}
+	var pages []string
+	for !c.Done {
+		lines, next, err := conn.LinesBefore(c, 4, "message")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, messages(lines))
+		c = next
+	}
+	if fmt.Sprint(pages) != "[6789 2345 01]" {
+		t.Errorf("got pages %v", pages)
+	}
+
+	// Forwards from the beginning.
+	c = weechat.Cursor{Buffer: b.Ptr}
+	pages = nil
+	for !c.Done {
+		lines, next, err := conn.LinesAfter(c, 4, "message")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, messages(lines))
+		c = next
+	}
+	if fmt.Sprint(pages) != "[0123 4567 89]" {
+		t.Errorf("got pages %v", pages)
+	}
+
+	// Date range [2, 8), by pages of 3.
+	c = weechat.Cursor{Buffer: b.Ptr}
+	pages = nil
+	for !c.Done {
+		lines, next, err := conn.LinesBetween(c, start.Add(2*time.Minute), start.Add(8*time.Minute), 3, "message")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, messages(lines))
+		c = next
+	}
+	// The end of the range is only detected on the last page.
+	if fmt.Sprint(pages) != "[567 234 ]" {
+		t.Errorf("got pages %v", pages)
+	}
+}
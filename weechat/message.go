@@ -3,8 +3,11 @@ package weechat
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -31,134 +34,349 @@ var types = []string{
 	typeInfo, typeInfos,
 }
 
+// HData is the generic representation of a hdata object,
+// used when no Go type is available to decode it.
+type HData struct {
+	Path  []string // h-path, e.g. "buffer", "lines", "line", "line_data"
+	Keys  []string // names of variables
+	Types []string // types of variables
+	Items []HDataItem
+}
+
+// A HDataItem is an element of a hdata object.
+type HDataItem struct {
+	Pointers []uint64 // one pointer per element of the h-path
+	Values   map[string]interface{}
+}
+
+// Info is a name/value pair, as returned by the info command.
+type Info struct {
+	Name  string
+	Value string
+}
+
+// Infolist is the generic representation of an infolist.
+type Infolist struct {
+	Name  string
+	Items []map[string]interface{}
+}
+
+var (
+	errTruncated = errors.New("weechat: truncated message")
+	errBadLength = errors.New("weechat: invalid length in message")
+
+	hdataType    = reflect.TypeOf(HData{})
+	infoType     = reflect.TypeOf(Info{})
+	infolistType = reflect.TypeOf(Infolist{})
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
 type message []byte
 
-func (m *message) Int() int32 {
-	u := binary.BigEndian.Uint32((*m)[:4])
-	*m = (*m)[4:]
-	return int32(u)
+func (m *message) next(n int) ([]byte, error) {
+	if n < 0 || n > len(*m) {
+		return nil, errTruncated
+	}
+	s := (*m)[:n]
+	*m = (*m)[n:]
+	return s, nil
 }
 
-func (m *message) Byte() byte {
-	b := (*m)[0]
-	*m = (*m)[1:]
-	return b
+func (m *message) Int() (int32, error) {
+	s, err := m.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(s)), nil
 }
 
-func (m *message) Pointer() uint64 {
-	l := m.Byte()
-	p, err := strconv.ParseUint(string((*m)[:l]), 16, 64)
+func (m *message) Byte() (byte, error) {
+	s, err := m.next(1)
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
-	*m = (*m)[l:]
-	return p
+	return s[0], nil
 }
 
-func (m *message) Buffer() []byte {
-	length := m.Int()
-	if length == -1 {
-		return nil
+// shortString reads a string prefixed by a 1-byte length.
+func (m *message) shortString() (string, error) {
+	l, err := m.Byte()
+	if err != nil {
+		return "", err
+	}
+	s, err := m.next(int(l))
+	return string(s), err
+}
+
+func (m *message) Long() (int64, error) {
+	s, err := m.shortString()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("weechat: invalid long integer %q", s)
+	}
+	return n, nil
+}
+
+func (m *message) Pointer() (uint64, error) {
+	s, err := m.shortString()
+	if err != nil || s == "" {
+		return 0, err
+	}
+	p, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("weechat: invalid pointer %q", s)
 	}
-	data := (*m)[:length]
-	*m = (*m)[length:]
-	return data
+	return p, nil
 }
 
-func (m *message) Time() time.Time {
+func (m *message) Buffer() ([]byte, error) {
+	length, err := m.Int()
+	if err != nil || length == -1 {
+		return nil, err
+	}
+	return m.next(int(length))
+}
+
+func (m *message) Time() (time.Time, error) {
 	// a 1-byte length + base 10 integer (Unix)
-	length := int(m.Byte())
-	t, err := strconv.ParseInt(string((*m)[:length]), 10, 64)
+	s, err := m.shortString()
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
-		panic(err)
+		return time.Time{}, fmt.Errorf("weechat: invalid time %q", s)
 	}
-	*m = (*m)[length:]
 	if t == 0 {
-		return time.Time{}
+		return time.Time{}, nil
 	}
-	return time.Unix(t, 0)
+	return time.Unix(t, 0), nil
 }
 
-func (m *message) GetType() string {
-	var buf [3]byte
-	copy(buf[:], (*m)[:3])
-	*m = (*m)[3:]
+func (m *message) GetType() (string, error) {
+	s, err := m.next(3)
+	if err != nil {
+		return "", err
+	}
 	for _, t := range types {
-		if buf[0] == t[0] && buf[1] == t[1] && buf[2] == t[2] {
-			return t
+		if cmpbytestring(s, t) {
+			return t, nil
 		}
 	}
-	panic("invalid type " + string(buf[:]))
+	return "", fmt.Errorf("weechat: invalid type %q", s)
 }
 
-// v is a settable slice.
-func (m *message) hdata(v reflect.Value) (ppaths [][]uint64) {
-	if v.Kind() != reflect.Slice || !v.CanSet() {
-		panic("not a settable slice")
+// count reads a number of elements. Since each element takes
+// at least one byte, it cannot exceed the remaining length.
+func (m *message) count() (int, error) {
+	n, err := m.Int()
+	if err != nil {
+		return 0, err
 	}
-	hpath := bytes.Split(m.Buffer(), []byte{'/'}) // "buffer/nick_group"
-	keys := bytes.Split(m.Buffer(), []byte{','})  // "name:str,prefix:str"a
-	// make result slice
-	length := m.Int()
-	slice := reflect.MakeSlice(v.Type(), int(length), int(length))
-	v.Set(slice)
-	// map key names to field index.
-	keytofield := make([]int, len(keys))
-	ptrtofield := make([]int, len(hpath))
-	for i := range keys {
-		keytofield[i] = -1
+	if n < 0 || int(n) > len(*m) {
+		return 0, errBadLength
 	}
-	for i := range hpath {
-		ptrtofield[i] = -1
+	return int(n), nil
+}
+
+// hdata decodes a hdata object into v, which can be a slice
+// of structs or maps, or a HData.
+func (m *message) hdata(v reflect.Value) error {
+	hpathb, err := m.Buffer()
+	if err != nil {
+		return err
+	}
+	keysb, err := m.Buffer()
+	if err != nil {
+		return err
 	}
+	hpath := bytes.Split(hpathb, []byte{'/'}) // "buffer/nick_group"
+	var keys, ktypes []string                 // "name:str,prefix:str"
+	if len(keysb) > 0 {
+		for _, k := range strings.Split(string(keysb), ",") {
+			idx := strings.LastIndex(k, ":")
+			if idx < 0 {
+				return fmt.Errorf("weechat: invalid hdata key %q", k)
+			}
+			keys = append(keys, k[:idx])
+			ktypes = append(ktypes, k[idx+1:])
+		}
+	}
+	length, err := m.count()
+	if err != nil {
+		return err
+	}
+
+	var generic *HData
+	switch {
+	case !v.IsValid():
+	case v.Kind() == reflect.Interface && v.NumMethod() == 0:
+		generic = new(HData)
+		v.Set(reflect.ValueOf(generic))
+	case v.Type() == hdataType:
+		generic = v.Addr().Interface().(*HData)
+	case v.Kind() == reflect.Slice:
+		return m.hdataSlice(v, hpath, keys, ktypes, length)
+	default:
+		return fmt.Errorf("weechat: cannot decode hdata into %s", v.Type())
+	}
+	if generic != nil {
+		generic.Path = make([]string, len(hpath))
+		for i, h := range hpath {
+			generic.Path[i] = string(h)
+		}
+		generic.Keys, generic.Types = keys, ktypes
+		generic.Items = make([]HDataItem, length)
+	}
+	for i := 0; i < length; i++ {
+		var item HDataItem
+		item.Pointers = make([]uint64, len(hpath))
+		for p := range hpath {
+			item.Pointers[p], err = m.Pointer()
+			if err != nil {
+				return err
+			}
+		}
+		item.Values = make(map[string]interface{}, len(keys))
+		for k, key := range keys {
+			var val interface{}
+			err := m.decodeValue(ktypes[k], reflect.ValueOf(&val).Elem())
+			if err != nil {
+				return err
+			}
+			item.Values[key] = val
+		}
+		if generic != nil {
+			generic.Items[i] = item
+		}
+	}
+	return nil
+}
+
+// hdataSlice decodes hdata items into a slice of structs, using
+// tags to match keys, or into a slice of maps, where pointers are
+// stored as "ptr:name" keys.
+func (m *message) hdataSlice(v reflect.Value, hpath [][]byte, keys, ktypes []string, length int) error {
+	slice := reflect.MakeSlice(v.Type(), length, length)
+	v.Set(slice)
 	t := v.Type().Elem()
+	if t.Kind() == reflect.Map {
+		if t.Key().Kind() != reflect.String {
+			return fmt.Errorf("weechat: cannot decode hdata into %s", v.Type())
+		}
+		for i := 0; i < length; i++ {
+			obj := reflect.MakeMap(t)
+			v.Index(i).Set(obj)
+			for _, h := range hpath {
+				ptr, err := m.Pointer()
+				if err != nil {
+					return err
+				}
+				val := reflect.New(t.Elem()).Elem()
+				if err := setPointer(val, ptr); err != nil {
+					return err
+				}
+				obj.SetMapIndex(reflect.ValueOf("ptr:"+string(h)).Convert(t.Key()), val)
+			}
+			for k, key := range keys {
+				val := reflect.New(t.Elem()).Elem()
+				if err := m.decodeValue(ktypes[k], val); err != nil {
+					return err
+				}
+				obj.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), val)
+			}
+		}
+		return nil
+	}
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("weechat: cannot decode hdata into %s", v.Type())
+	}
+	// map key names to field index.
+	keytofield := make([][]int, len(keys))
+	ptrtofield := make([][]int, len(hpath))
 loopfields:
-	for f, fcount := 0, t.NumField(); f < fcount; f++ {
-		fld := t.Field(f)
-		if fld.Tag[:4] == "ptr:" {
+	for _, fld := range structFields(t) {
+		tag := fld.Tag.Get("weechat")
+		if tag == "" {
+			continue
+		}
+		if strings.HasPrefix(tag, "ptr:") {
+			name := tag[4:]
 			for h, helem := range hpath {
-				if cmpbytestring(helem, string(fld.Tag[4:])) {
-					ptrtofield[h] = f
+				if cmpbytestring(helem, name) {
+					ptrtofield[h] = fld.Index
+					continue loopfields
+				}
+			}
+			// pointers may also be sent as keys.
+			for k, key := range keys {
+				if key == name && ktypes[k] == typePtr {
+					keytofield[k] = fld.Index
 					continue loopfields
 				}
 			}
 		} else {
 			for k, key := range keys {
-				if cmpbytestring(key[:len(key)-4], string(fld.Tag)) {
-					keytofield[k] = f
+				if key == tag {
+					keytofield[k] = fld.Index
 					continue loopfields
 				}
 			}
 		}
 	}
-	for i := int32(0); i < length; i++ {
-		obj := v.Index(int(i))
+	for i := 0; i < length; i++ {
+		obj := v.Index(i)
 		// len(hpath) pointers
 		for p, pname := range hpath {
-			ptr := m.Pointer()
-			if fld := ptrtofield[p]; fld >= 0 {
-				obj.Field(fld).SetUint(ptr)
-			} else {
+			ptr, err := m.Pointer()
+			if err != nil {
+				return err
+			}
+			if fld := ptrtofield[p]; fld != nil {
+				if err := setPointer(obj.FieldByIndex(fld), ptr); err != nil {
+					return err
+				}
+			} else if i == 0 {
 				debugf("path %s ignored in %s", pname, hpath)
 			}
 		}
 		// len(keys) objects with the given types.
 		for k, fld := range keytofield {
-			km := message(keys[k])
-			km = km[len(km)-3:]
-			keytype := km.GetType()
 			var dst reflect.Value
-			if fld >= 0 {
-				dst = obj.Field(fld)
+			if fld != nil {
+				dst = obj.FieldByIndex(fld)
 			} else if i == 0 {
 				debugf("key %s ignored in %s", keys[k], hpath)
 			}
-			m.decodeValue(keytype, dst)
+			if err := m.decodeValue(ktypes[k], dst); err != nil {
+				return fmt.Errorf("%s: %s", keys[k], err)
+			}
 		}
 	}
 	return nil
 }
 
+// structFields lists the fields of struct type t, including
+// fields of embedded structs.
+func structFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for f, fcount := 0, t.NumField(); f < fcount; f++ {
+		fld := t.Field(f)
+		if fld.Anonymous && fld.Type.Kind() == reflect.Struct {
+			for _, sub := range structFields(fld.Type) {
+				sub.Index = append([]int{f}, sub.Index...)
+				fields = append(fields, sub)
+			}
+			continue
+		}
+		fields = append(fields, fld)
+	}
+	return fields
+}
+
 func cmpbytestring(a []byte, b string) bool {
 	if len(a) != len(b) {
 		return false
@@ -171,61 +389,327 @@ func cmpbytestring(a []byte, b string) bool {
 	return true
 }
 
-func (m *message) decodeValue(typ string, v reflect.Value) {
+// isEmptyInterface reports whether v can hold any decoded value.
+func isEmptyInterface(v reflect.Value) bool {
+	return v.Kind() == reflect.Interface && v.NumMethod() == 0
+}
+
+func errCannotDecode(typ string, v reflect.Value) error {
+	return fmt.Errorf("weechat: cannot decode %s into %s", typ, v.Type())
+}
+
+// decodeValue decodes an object of type typ into v. If v is not
+// valid, the object is skipped. If v is an empty interface, it receives
+// a generic value: byte, int32, int64, string, []byte, uint64 (pointers),
+// time.Time, []interface{}, map[string]interface{}, *HData, Info or
+// Infolist.
+func (m *message) decodeValue(typ string, v reflect.Value) error {
 	switch typ {
 	case typeChar:
-		b := m.Byte()
-		if v.IsValid() {
-			v.SetUint(uint64(b))
+		b, err := m.Byte()
+		if err != nil || !v.IsValid() {
+			return err
 		}
+		return setInt(v, typ, int64(b), b)
 	case typeInt:
-		n := m.Int()
-		if v.IsValid() {
-			v.SetInt(int64(n))
+		n, err := m.Int()
+		if err != nil || !v.IsValid() {
+			return err
+		}
+		return setInt(v, typ, int64(n), n)
+	case typeLong:
+		n, err := m.Long()
+		if err != nil || !v.IsValid() {
+			return err
 		}
-	case typeString:
-		s := string(m.Buffer())
-		if v.IsValid() {
-			v.SetString(s)
+		return setInt(v, typ, n, n)
+	case typeString, typeBytes:
+		s, err := m.Buffer()
+		if err != nil || !v.IsValid() {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(s))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), s...))
+		case isEmptyInterface(v) && typ == typeString:
+			v.Set(reflect.ValueOf(string(s)))
+		case isEmptyInterface(v):
+			v.Set(reflect.ValueOf(append([]byte(nil), s...)))
+		default:
+			return errCannotDecode(typ, v)
 		}
 	case typePtr:
-		p := m.Pointer()
-		if v.IsValid() {
-			v.SetUint(uint64(p))
+		p, err := m.Pointer()
+		if err != nil || !v.IsValid() {
+			return err
 		}
+		return setPointer(v, p)
 	case typeTime:
-		t := m.Time()
-		if v.IsValid() {
-			v.Set(reflect.ValueOf(t))
+		t, err := m.Time()
+		if err != nil || !v.IsValid() {
+			return err
+		}
+		if v.Type() != timeType && !isEmptyInterface(v) {
+			return errCannotDecode(typ, v)
 		}
+		v.Set(reflect.ValueOf(t))
 	case typeArray:
-		elem := m.GetType()
-		length := int(m.Int())
-		var elemv reflect.Value
-		if v.IsValid() {
-			newv := reflect.MakeSlice(v.Type(), length, length)
-			v.Set(newv)
+		elem, err := m.GetType()
+		if err != nil {
+			return err
+		}
+		length, err := m.count()
+		if err != nil {
+			return err
+		}
+		var generic []interface{}
+		switch {
+		case !v.IsValid():
+		case isEmptyInterface(v):
+			generic = make([]interface{}, length)
+		case v.Kind() == reflect.Slice:
+			v.Set(reflect.MakeSlice(v.Type(), length, length))
+		default:
+			return errCannotDecode(typ, v)
 		}
 		for i := 0; i < length; i++ {
-			if v.IsValid() {
+			var elemv reflect.Value
+			if generic != nil {
+				elemv = reflect.ValueOf(&generic[i]).Elem()
+			} else if v.IsValid() {
 				elemv = v.Index(i)
 			}
-			m.decodeValue(elem, elemv)
+			if err := m.decodeValue(elem, elemv); err != nil {
+				return err
+			}
+		}
+		if generic != nil {
+			v.Set(reflect.ValueOf(generic))
 		}
 	case typeMap:
-		tkey, tval := m.GetType(), m.GetType()
-		length := int(m.Int())
-		var valk reflect.Value
-		for i := 0; i < length; i++ {
-			m.decodeValue(tkey, valk)
-			m.decodeValue(tval, valk)
+		return m.hashtable(v)
+	case typeHdata:
+		return m.hdata(v)
+	case typeInfo:
+		name, err := m.Buffer()
+		if err != nil {
+			return err
+		}
+		value, err := m.Buffer()
+		if err != nil || !v.IsValid() {
+			return err
 		}
+		info := Info{Name: string(name), Value: string(value)}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(info.Value)
+		case v.Type() == infoType || isEmptyInterface(v):
+			v.Set(reflect.ValueOf(info))
+		default:
+			return errCannotDecode(typ, v)
+		}
+	case typeInfos:
+		return m.infolist(v)
 	default:
-		panic("unknown type " + typ)
+		return fmt.Errorf("weechat: unknown type %q", typ)
 	}
+	return nil
+}
+
+// setInt stores an integer object into v, where generic is the
+// value stored into empty interfaces.
+func setInt(v reflect.Value, typ string, n int64, generic interface{}) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(uint64(n))
+	case reflect.Bool:
+		v.SetBool(n != 0)
+	case reflect.Interface:
+		if !isEmptyInterface(v) {
+			return errCannotDecode(typ, v)
+		}
+		v.Set(reflect.ValueOf(generic))
+	default:
+		return errCannotDecode(typ, v)
+	}
+	return nil
 }
 
-func (m *message) HData(v interface{}) (ppaths [][]uint64) {
-	// v is a pointer to slice.
+// setPointer stores a pointer into v: integers receive its value
+// and strings its hexadecimal representation, such as 0x12ab.
+func setPointer(v reflect.Value, p uint64) error {
+	if v.Kind() == reflect.String {
+		v.SetString(fmt.Sprintf("0x%x", p))
+		return nil
+	}
+	return setInt(v, typePtr, int64(p), p)
+}
+
+// hashtable decodes a hashtable into v, which must be a map
+// or an empty interface, which receives a map[string]interface{}
+// (keys are formatted using fmt.Sprint).
+func (m *message) hashtable(v reflect.Value) error {
+	tkey, err := m.GetType()
+	if err != nil {
+		return err
+	}
+	tval, err := m.GetType()
+	if err != nil {
+		return err
+	}
+	length, err := m.count()
+	if err != nil {
+		return err
+	}
+	var key, val reflect.Value
+	var generic map[string]interface{}
+	switch {
+	case !v.IsValid():
+	case isEmptyInterface(v):
+		generic = make(map[string]interface{}, length)
+		var k, x interface{}
+		key, val = reflect.ValueOf(&k).Elem(), reflect.ValueOf(&x).Elem()
+	case v.Kind() == reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		key = reflect.New(v.Type().Key()).Elem()
+		val = reflect.New(v.Type().Elem()).Elem()
+	default:
+		return errCannotDecode(typeMap, v)
+	}
+	for i := 0; i < length; i++ {
+		if err := m.decodeValue(tkey, key); err != nil {
+			return err
+		}
+		if err := m.decodeValue(tval, val); err != nil {
+			return err
+		}
+		switch {
+		case generic != nil:
+			generic[fmt.Sprint(key.Interface())] = val.Interface()
+		case v.IsValid():
+			v.SetMapIndex(key, val)
+		}
+	}
+	if generic != nil {
+		v.Set(reflect.ValueOf(generic))
+	}
+	return nil
+}
+
+// infolist decodes an infolist into v, which can be a slice
+// of structs (variables are matched with field tags) or maps,
+// an Infolist or an empty interface.
+func (m *message) infolist(v reflect.Value) error {
+	name, err := m.Buffer()
+	if err != nil {
+		return err
+	}
+	length, err := m.count()
+	if err != nil {
+		return err
+	}
+	var generic *Infolist
+	switch {
+	case !v.IsValid():
+	case isEmptyInterface(v) || v.Type() == infolistType:
+		generic = &Infolist{Name: string(name)}
+		generic.Items = make([]map[string]interface{}, length)
+	case v.Kind() == reflect.Slice:
+		elem := v.Type().Elem()
+		switch {
+		case elem.Kind() == reflect.Map && elem.Key().Kind() != reflect.String,
+			elem.Kind() != reflect.Struct && elem.Kind() != reflect.Map:
+			return errCannotDecode(typeInfos, v)
+		}
+		v.Set(reflect.MakeSlice(v.Type(), length, length))
+	default:
+		return errCannotDecode(typeInfos, v)
+	}
+	for i := 0; i < length; i++ {
+		var item reflect.Value
+		var fields map[string][]int
+		switch {
+		case generic != nil:
+			generic.Items[i] = make(map[string]interface{})
+			item = reflect.ValueOf(generic.Items[i])
+		case v.IsValid():
+			item = v.Index(i)
+			if item.Kind() == reflect.Map {
+				item.Set(reflect.MakeMap(item.Type()))
+			} else {
+				fields = make(map[string][]int)
+				for _, fld := range structFields(item.Type()) {
+					if tag := fld.Tag.Get("weechat"); tag != "" {
+						fields[tag] = fld.Index
+					}
+				}
+			}
+		}
+		nvars, err := m.count()
+		if err != nil {
+			return err
+		}
+		for j := 0; j < nvars; j++ {
+			vname, err := m.Buffer()
+			if err != nil {
+				return err
+			}
+			typ, err := m.GetType()
+			if err != nil {
+				return err
+			}
+			switch {
+			case !item.IsValid():
+				err = m.decodeValue(typ, reflect.Value{})
+			case item.Kind() == reflect.Map:
+				val := reflect.New(item.Type().Elem()).Elem()
+				err = m.decodeValue(typ, val)
+				item.SetMapIndex(reflect.ValueOf(string(vname)).Convert(item.Type().Key()), val)
+			default:
+				var dst reflect.Value
+				if idx, ok := fields[string(vname)]; ok {
+					dst = item.FieldByIndex(idx)
+				}
+				err = m.decodeValue(typ, dst)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %s", vname, err)
+			}
+		}
+	}
+	if generic != nil {
+		v.Set(reflect.ValueOf(*generic))
+	}
+	return nil
+}
+
+// Decode decodes the next object of the message into v, which
+// must be a pointer.
+func (m *message) Decode(v interface{}) error {
+	typ, err := m.GetType()
+	if err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("weechat: Decode needs a non-nil pointer, got %T", v)
+	}
+	return m.decodeValue(typ, rv.Elem())
+}
+
+// HData decodes a hdata object into v, which must be a pointer
+// to a slice or to a HData.
+func (m *message) HData(v interface{}) error {
+	typ, err := m.GetType()
+	if err != nil {
+		return err
+	}
+	if typ != typeHdata {
+		return fmt.Errorf("weechat: expected hdata, got %s", typ)
+	}
 	return m.hdata(reflect.ValueOf(v).Elem())
 }
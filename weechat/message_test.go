@@ -0,0 +1,353 @@
+package weechat
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+func appendShort(b []byte, s string) []byte {
+	return append(append(b, byte(len(s))), s...)
+}
+
+func appendInt(b []byte, n int32) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func TestDecodeGeneric(t *testing.T) {
+	var m []byte
+	// htb str => lon
+	m = append(m, "htbstrlon"...)
+	m = appendInt(m, 2)
+	m = appendStr(m, "a")
+	m = appendShort(m, "-1234567890123")
+	m = appendStr(m, "b")
+	m = appendShort(m, "42")
+	// buf (NULL)
+	m = append(m, "buf"...)
+	m = appendInt(m, -1)
+	// inf
+	m = append(m, "inf"...)
+	m = appendStr(m, "version")
+	m = appendStr(m, "4.0.0")
+	// arr of int
+	m = append(m, "arrint"...)
+	m = appendInt(m, 2)
+	m = appendInt(m, 7)
+	m = appendInt(m, -7)
+	// hda with a nested hashtable
+	m = append(m, "hda"...)
+	m = appendStr(m, "buffer")
+	m = appendStr(m, "number:int,local_variables:htb")
+	m = appendInt(m, 1)
+	m = appendShort(m, "12ab")
+	m = appendInt(m, 3)
+	m = append(m, "strstr"...)
+	m = appendInt(m, 1)
+	m = appendStr(m, "type")
+	m = appendStr(m, "channel")
+
+	msg := message(m)
+	var objs []interface{}
+	for len(msg) > 0 {
+		var obj interface{}
+		if err := msg.Decode(&obj); err != nil {
+			t.Fatalf("object %d: %s", len(objs), err)
+		}
+		objs = append(objs, obj)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"a": int64(-1234567890123), "b": int64(42)},
+		[]byte(nil),
+		Info{Name: "version", Value: "4.0.0"},
+		[]interface{}{int32(7), int32(-7)},
+		&HData{
+			Path:  []string{"buffer"},
+			Keys:  []string{"number", "local_variables"},
+			Types: []string{typeInt, typeMap},
+			Items: []HDataItem{{
+				Pointers: []uint64{0x12ab},
+				Values: map[string]interface{}{
+					"number":          int32(3),
+					"local_variables": map[string]interface{}{"type": "channel"},
+				},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(objs, expected) {
+		t.Errorf("got %#v, expected %#v", objs, expected)
+	}
+}
+
+func TestDecodeInfolist(t *testing.T) {
+	var m []byte
+	m = append(m, "inl"...)
+	m = appendStr(m, "buffer")
+	m = appendInt(m, 2)
+	for i, name := range []string{"core.weechat", "irc.server.libera"} {
+		m = appendInt(m, 3)
+		m = appendStr(m, "full_name")
+		m = append(m, "str"...)
+		m = appendStr(m, name)
+		m = appendStr(m, "number")
+		m = append(m, "int"...)
+		m = appendInt(m, int32(i+1))
+		m = appendStr(m, "first_line_not_read")
+		m = append(m, "tim"...)
+		m = appendShort(m, "1321993456")
+	}
+
+	var bufs []struct {
+		Name   string    `weechat:"full_name"`
+		Number int       `weechat:"number"`
+		Date   time.Time `weechat:"first_line_not_read"`
+	}
+	msg := message(m)
+	if err := msg.Decode(&bufs); err != nil {
+		t.Fatal(err)
+	}
+	if len(bufs) != 2 || bufs[1].Name != "irc.server.libera" || bufs[1].Number != 2 ||
+		bufs[0].Date.Unix() != 1321993456 {
+		t.Errorf("got %+v", bufs)
+	}
+
+	var list Infolist
+	msg = message(m)
+	if err := msg.Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Name != "buffer" || len(list.Items) != 2 || list.Items[0]["full_name"] != "core.weechat" {
+		t.Errorf("got %+v", list)
+	}
+}
+
+func TestDecodeMapTargets(t *testing.T) {
+	var hda []byte
+	hda = append(hda, "hda"...)
+	hda = appendStr(hda, "buffer")
+	hda = appendStr(hda, "full_name:str")
+	hda = appendInt(hda, 1)
+	hda = appendShort(hda, "12ab")
+	hda = appendStr(hda, "core.weechat")
+
+	var strs []map[string]string
+	msg := message(hda)
+	if err := msg.Decode(&strs); err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]string{{"ptr:buffer": "0x12ab", "full_name": "core.weechat"}}
+	if !reflect.DeepEqual(strs, expected) {
+		t.Errorf("got %#v, expected %#v", strs, expected)
+	}
+
+	var inl []byte
+	inl = append(inl, "inl"...)
+	inl = appendStr(inl, "buffer")
+	inl = appendInt(inl, 1)
+	inl = appendInt(inl, 1)
+	inl = appendStr(inl, "number")
+	inl = append(inl, "int"...)
+	inl = appendInt(inl, 1)
+
+	// unsupported targets are errors.
+	for _, test := range []struct {
+		data []byte
+		v    interface{}
+	}{
+		{hda, new([]map[string][]byte)},
+		{hda, new([]map[string]time.Time)},
+		{hda, new([]map[int]string)},
+		{inl, new([]map[int]int)},
+		{inl, new([]map[string]time.Time)},
+	} {
+		msg := message(test.data)
+		if err := msg.Decode(test.v); err == nil {
+			t.Errorf("no error decoding %s into %T", test.data[:3], test.v)
+		}
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	var m []byte
+	m = append(m, "hda"...)
+	m = appendStr(m, "buffer")
+	m = appendStr(m, "name:str,number:int")
+	m = appendInt(m, 1)
+	m = appendShort(m, "12ab")
+	m = appendStr(m, "core.weechat")
+	m = appendInt(m, 1)
+	for i := 0; i < len(m); i++ {
+		msg := message(m[:i])
+		var bufs []Buffer
+		if err := msg.Decode(&bufs); err == nil {
+			t.Errorf("no error for message truncated to %d bytes", i)
+		}
+	}
+	msg := message(m)
+	var bufs []Buffer
+	if err := msg.Decode(&bufs); err != nil {
+		t.Fatal(err)
+	}
+	if len(bufs) != 1 || bufs[0].Name != "core.weechat" || bufs[0].Number != 1 || bufs[0].Self != 0x12ab {
+		t.Errorf("got %+v", bufs)
+	}
+
+	// Large counts must not allocate.
+	m = append(m[:0], "arrint"...)
+	m = appendInt(m, 1<<30)
+	msg = message(m)
+	var obj interface{}
+	if err := msg.Decode(&obj); err != errBadLength {
+		t.Errorf("got error %v, expected %v", err, errBadLength)
+	}
+}
+
+// decodeMessage parses a framed message into its identifier
+// and generic objects.
+func decodeMessage(frame []byte) (id string, objs []interface{}, err error) {
+	conn := &Conn{r: bufio.NewReader(bytes.NewReader(frame))}
+	body, err := conn.recv()
+	if err != nil {
+		return "", nil, err
+	}
+	msg := message(body)
+	idb, err := msg.Buffer()
+	if err != nil {
+		return "", nil, err
+	}
+	for len(msg) > 0 {
+		var obj interface{}
+		if err := msg.Decode(&obj); err != nil {
+			return "", nil, err
+		}
+		objs = append(objs, obj)
+	}
+	return string(idb), objs, nil
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	objs := []interface{}{
+		byte(1), int32(-42), int64(1) << 40, "hello", []byte{0, 1},
+		uint64(0xdeadbeef), time.Unix(1321993456, 0),
+		[]interface{}{"a", "b"},
+		map[string]interface{}{"x": int32(1), "y": int32(2)},
+		Info{Name: "version", Value: "4.0.0"},
+		Infolist{Name: "buffer", Items: []map[string]interface{}{
+			{"full_name": "core.weechat", "pointer": uint64(0x1234)},
+		}},
+		&HData{
+			Path:  []string{"buffer", "lines", "line", "line_data"},
+			Keys:  []string{"message", "tags_array"},
+			Types: []string{typeString, typeArray},
+			Items: []HDataItem{{
+				Pointers: []uint64{1, 2, 3, 4},
+				Values: map[string]interface{}{
+					"message":    "hi",
+					"tags_array": []interface{}{"irc_privmsg"},
+				},
+			}},
+		},
+	}
+	for _, e := range []Encoder{{}, {Compress: true}, {Compress: true, Level: 9}} {
+		e.Reset("42")
+		for _, obj := range objs {
+			if err := e.Encode(obj); err != nil {
+				t.Fatalf("%T: %s", obj, err)
+			}
+		}
+		id, got, err := decodeMessage(e.Message())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != "42" || !reflect.DeepEqual(got, objs) {
+			t.Errorf("got %q %#v, expected %#v", id, got, objs)
+		}
+	}
+
+	// Property: scalars and hashtables survive a round trip.
+	f := func(n int32, l int64, s string, p uint64, m map[string]string) bool {
+		var e Encoder
+		e.Reset("")
+		for _, v := range []interface{}{n, l, s, p, m} {
+			if err := e.Encode(v); err != nil {
+				return false
+			}
+		}
+		_, got, err := decodeMessage(e.Message())
+		if err != nil || len(got) != 5 {
+			return false
+		}
+		gotm := got[4].(map[string]interface{})
+		if len(gotm) != len(m) {
+			return false
+		}
+		for k, v := range m {
+			if gotm[k] != v {
+				return false
+			}
+		}
+		return got[0] == n && got[1] == l && got[2] == s && got[3] == p
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncodeHData(t *testing.T) {
+	bufs := []Buffer{
+		{Number: 1, FullName: "core.weechat", Self: 0x10, Next: 0x20},
+		{Number: 2, FullName: "irc.libera.#go", Self: 0x20, Prev: 0x10},
+	}
+	var e Encoder
+	e.Reset("")
+	if err := e.EncodeHData("buffer", bufs); err != nil {
+		t.Fatal(err)
+	}
+	var got []Buffer
+	msg := message(e.buf)
+	msg.Buffer()
+	if err := msg.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, bufs) {
+		t.Errorf("got %+v, expected %+v", got, bufs)
+	}
+}
+
+func TestEncodeHDataPointers(t *testing.T) {
+	type line struct {
+		Self    string `weechat:"ptr:line"`
+		Data    int64  `weechat:"ptr:line_data"`
+		Message string `weechat:"message"`
+	}
+	lines := []line{{Self: "0x10", Data: 0x20, Message: "hello"}}
+	var e Encoder
+	e.Reset("")
+	if err := e.EncodeHData("line/line_data", lines); err != nil {
+		t.Fatal(err)
+	}
+	var got []line
+	msg := message(e.buf)
+	msg.Buffer()
+	if err := msg.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, lines) {
+		t.Errorf("got %+v, expected %+v", got, lines)
+	}
+
+	e.Reset("")
+	if err := e.EncodeHData("line", []line{{Self: "nowhere"}}); err == nil {
+		t.Errorf("no error for invalid pointer string")
+	}
+	type badLine struct {
+		Self float64 `weechat:"ptr:line"`
+	}
+	e.Reset("")
+	if err := e.EncodeHData("line", []badLine{{}}); err == nil {
+		t.Errorf("no error for float pointer")
+	}
+}
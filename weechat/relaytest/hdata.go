@@ -0,0 +1,52 @@
+package relaytest
+
+import (
+	"strings"
+
+	"github.com/remyoudompheng/go-misc/weechat"
+)
+
+// An hdata is a list of items to be encoded as a hda object.
+type hdata struct {
+	path  string   // "buffer/lines/line/line_data"
+	keys  []string // "name:str"
+	items []hdataItem
+}
+
+type hdataItem struct {
+	ptrs []uint64
+	vals map[string]interface{}
+}
+
+// filter restricts the keys of h to the given names.
+func (h *hdata) filter(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	var keys []string
+	for _, k := range h.keys {
+		for _, name := range names {
+			if k[:len(k)-4] == name {
+				keys = append(keys, k)
+			}
+		}
+	}
+	h.keys = keys
+}
+
+// generic converts h to the generic form understood by
+// weechat.Encoder.
+func (h hdata) generic() *weechat.HData {
+	out := &weechat.HData{Path: strings.Split(h.path, "/")}
+	for _, k := range h.keys {
+		out.Keys = append(out.Keys, k[:len(k)-4])
+		out.Types = append(out.Types, k[len(k)-3:])
+	}
+	for _, item := range h.items {
+		out.Items = append(out.Items, weechat.HDataItem{
+			Pointers: item.ptrs,
+			Values:   item.vals,
+		})
+	}
+	return out
+}
@@ -0,0 +1,891 @@
+// Package relaytest implements a fake WeeChat relay speaking the
+// binary relay protocol, for testing clients without WeeChat.
+//
+// A Server holds a list of buffers with their lines and nicklists,
+// which tests can modify: changes are pushed to clients that
+// have sent a sync command.
+package relaytest
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/weechat"
+)
+
+// A Server is a fake relay listening on a local address.
+type Server struct {
+	Addr string // address of the listener, as "127.0.0.1:port"
+
+	// Password is the relay password. If empty, clients need
+	// not authenticate. It must be set before clients connect.
+	Password string
+	// Nick is the name used as a prefix for lines sent through
+	// the input command. It defaults to "me".
+	Nick string
+
+	l  net.Listener
+	wg sync.WaitGroup
+
+	mu      sync.Mutex
+	ptr     uint64
+	buffers []*Buffer
+	infos   map[string]string
+	inputs  []Input
+	clients map[*client]bool
+}
+
+// A Buffer is a WeeChat buffer.
+type Buffer struct {
+	Ptr       uint64
+	Number    int
+	FullName  string // for example "irc.libera.#go"
+	ShortName string
+	Title     string
+	LocalVars map[string]string
+
+	Lines []*Line
+	Nicks []*Nick
+
+	linesPtr uint64
+	rootPtr  uint64
+}
+
+// Name returns the name of the buffer, which is its full name
+// without the plugin name.
+func (b *Buffer) Name() string {
+	if idx := strings.Index(b.FullName, "."); idx >= 0 {
+		return b.FullName[idx+1:]
+	}
+	return b.FullName
+}
+
+// A Line is a line displayed in a buffer.
+type Line struct {
+	Ptr     uint64 // pointer to the line
+	DataPtr uint64 // pointer to the line data
+
+	Date      time.Time
+	Prefix    string
+	Message   string
+	Tags      []string
+	Displayed bool
+	Highlight bool
+}
+
+// A Nick is an item of a nicklist.
+type Nick struct {
+	Ptr         uint64
+	Group       bool
+	Visible     bool
+	Level       int // for groups, 1 for top-level groups
+	Name        string
+	Color       string
+	Prefix      string
+	PrefixColor string
+}
+
+// An Input is a text received through the input command.
+type Input struct {
+	Buffer string // buffer as given by the client
+	Text   string
+}
+
+type client struct {
+	srv      *Server
+	c        net.Conn
+	wlock    sync.Mutex
+	authed   bool
+	compress bool
+	nonce    []byte
+	algo     string
+
+	// protected by srv.mu
+	synced map[string]bool
+}
+
+// NewServer starts a fake relay on a local port. It holds a single
+// buffer named "core.weechat".
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("relaytest: failed to listen: %v", err))
+	}
+	s := &Server{
+		Addr:    l.Addr().String(),
+		Nick:    "me",
+		l:       l,
+		ptr:     0x1000,
+		infos:   map[string]string{"version": "4.0.0"},
+		clients: make(map[*client]bool),
+	}
+	s.AddBuffer("core.weechat")
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Close stops the server and closes client connections.
+func (s *Server) Close() {
+	s.l.Close()
+	s.mu.Lock()
+	for c := range s.clients {
+		c.c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		cl := &client{srv: s, c: c, synced: make(map[string]bool)}
+		s.mu.Lock()
+		s.clients[cl] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go cl.serve()
+	}
+}
+
+func (s *Server) newPtr() uint64 {
+	s.ptr += 0x10
+	return s.ptr
+}
+
+// AddBuffer creates a new buffer.
+func (s *Server) AddBuffer(fullName string) *Buffer {
+	s.mu.Lock()
+	b := &Buffer{
+		Ptr:       s.newPtr(),
+		Number:    len(s.buffers) + 1,
+		FullName:  fullName,
+		LocalVars: make(map[string]string),
+		linesPtr:  s.newPtr(),
+		rootPtr:   s.newPtr(),
+	}
+	b.ShortName = b.Name()
+	s.buffers = append(s.buffers, b)
+	h := s.buffersHdata([]*Buffer{b})
+	s.mu.Unlock()
+	s.push(b, "_buffer_opened", h)
+	return b
+}
+
+// Buffer returns the buffer with the given full name or pointer
+// (formatted as "0x1234"), or nil.
+func (s *Server) Buffer(name string) *Buffer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lookupBuffer(name)
+}
+
+func (s *Server) lookupBuffer(name string) *Buffer {
+	for _, b := range s.buffers {
+		if b.FullName == name || fmt.Sprintf("0x%x", b.Ptr) == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// RenameBuffer changes the full name of a buffer.
+func (s *Server) RenameBuffer(b *Buffer, fullName string) {
+	s.mu.Lock()
+	b.FullName = fullName
+	b.ShortName = b.Name()
+	h := s.buffersHdata([]*Buffer{b})
+	s.mu.Unlock()
+	s.push(b, "_buffer_renamed", h)
+}
+
+// CloseBuffer removes a buffer.
+func (s *Server) CloseBuffer(b *Buffer) {
+	s.mu.Lock()
+	h := s.buffersHdata([]*Buffer{b})
+	s.mu.Unlock()
+	s.push(b, "_buffer_closing", h)
+	s.mu.Lock()
+	for i, x := range s.buffers {
+		if x == b {
+			s.buffers = append(s.buffers[:i], s.buffers[i+1:]...)
+			break
+		}
+	}
+	for i, x := range s.buffers {
+		x.Number = i + 1
+	}
+	s.mu.Unlock()
+}
+
+// AddLine appends a line to a buffer. Pointers are allocated
+// and the date defaults to the current time.
+func (s *Server) AddLine(b *Buffer, l Line) *Line {
+	s.mu.Lock()
+	line := &l
+	line.Ptr, line.DataPtr = s.newPtr(), s.newPtr()
+	if line.Date.IsZero() {
+		line.Date = time.Now()
+	}
+	b.Lines = append(b.Lines, line)
+	h := lineDataHdata(b, []*Line{line})
+	s.mu.Unlock()
+	s.push(b, "_buffer_line_added", h)
+	return line
+}
+
+// AddNick appends an item to the nicklist of a buffer.
+func (s *Server) AddNick(b *Buffer, n Nick) *Nick {
+	s.mu.Lock()
+	nick := &n
+	nick.Ptr = s.newPtr()
+	b.Nicks = append(b.Nicks, nick)
+	h := nicklistDiff(b, '+', nick)
+	s.mu.Unlock()
+	s.push(b, "_nicklist_diff", h)
+	return nick
+}
+
+// RemoveNick removes the named item from the nicklist of a buffer.
+func (s *Server) RemoveNick(b *Buffer, name string) {
+	s.mu.Lock()
+	var nick *Nick
+	for i, n := range b.Nicks {
+		if n.Name == name {
+			nick = n
+			b.Nicks = append(b.Nicks[:i], b.Nicks[i+1:]...)
+			break
+		}
+	}
+	if nick == nil {
+		s.mu.Unlock()
+		return
+	}
+	h := nicklistDiff(b, '-', nick)
+	s.mu.Unlock()
+	s.push(b, "_nicklist_diff", h)
+}
+
+// SetInfo sets the value returned by the info command.
+func (s *Server) SetInfo(name, value string) {
+	s.mu.Lock()
+	s.infos[name] = value
+	s.mu.Unlock()
+}
+
+// Inputs returns the inputs received from clients.
+func (s *Server) Inputs() []Input {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Input(nil), s.inputs...)
+}
+
+// push sends an event about buffer b to synchronized clients.
+func (s *Server) push(b *Buffer, id string, h hdata) {
+	s.mu.Lock()
+	var targets []*client
+	for c := range s.clients {
+		if c.synced["*"] || c.synced[b.FullName] {
+			targets = append(targets, c)
+		}
+	}
+	s.mu.Unlock()
+	for _, c := range targets {
+		c.reply(id, h.generic())
+	}
+}
+
+var buffersKeys = []string{
+	"number:int", "name:str", "full_name:str", "short_name:str",
+	"title:str", "local_variables:htb",
+	"prev_buffer:ptr", "next_buffer:ptr",
+}
+
+func (s *Server) buffersHdata(bufs []*Buffer) hdata {
+	h := hdata{path: "buffer", keys: buffersKeys}
+	for _, b := range bufs {
+		h.items = append(h.items, hdataItem{
+			ptrs: []uint64{b.Ptr},
+			vals: s.bufferVars(b),
+		})
+	}
+	return h
+}
+
+func (s *Server) bufferVars(b *Buffer) map[string]interface{} {
+	var prev, next uint64
+	for i, x := range s.buffers {
+		if x == b {
+			if i > 0 {
+				prev = s.buffers[i-1].Ptr
+			}
+			if i+1 < len(s.buffers) {
+				next = s.buffers[i+1].Ptr
+			}
+		}
+	}
+	return map[string]interface{}{
+		"number":          b.Number,
+		"name":            b.Name(),
+		"full_name":       b.FullName,
+		"short_name":      b.ShortName,
+		"title":           b.Title,
+		"local_variables": b.LocalVars,
+		"prev_buffer":     prev,
+		"next_buffer":     next,
+	}
+}
+
+var lineDataKeys = []string{
+	"buffer:ptr", "date:tim", "date_printed:tim",
+	"displayed:chr", "highlight:chr", "tags_array:arr",
+	"prefix:str", "message:str",
+}
+
+func lineDataVars(b *Buffer, l *Line) map[string]interface{} {
+	return map[string]interface{}{
+		"buffer":       b.Ptr,
+		"date":         l.Date,
+		"date_printed": l.Date,
+		"displayed":    l.Displayed,
+		"highlight":    l.Highlight,
+		"tags_array":   l.Tags,
+		"prefix":       l.Prefix,
+		"message":      l.Message,
+	}
+}
+
+func lineDataHdata(b *Buffer, lines []*Line) hdata {
+	h := hdata{path: "line_data", keys: lineDataKeys}
+	for _, l := range lines {
+		h.items = append(h.items, hdataItem{
+			ptrs: []uint64{l.DataPtr},
+			vals: lineDataVars(b, l),
+		})
+	}
+	return h
+}
+
+var nicklistKeys = []string{
+	"group:chr", "visible:chr", "level:int",
+	"name:str", "color:str", "prefix:str", "prefix_color:str",
+}
+
+func nickVars(n *Nick) map[string]interface{} {
+	return map[string]interface{}{
+		"group":        n.Group,
+		"visible":      n.Visible,
+		"level":        n.Level,
+		"name":         n.Name,
+		"color":        n.Color,
+		"prefix":       n.Prefix,
+		"prefix_color": n.PrefixColor,
+	}
+}
+
+func rootGroup(b *Buffer) *Nick {
+	return &Nick{Ptr: b.rootPtr, Group: true, Name: "root"}
+}
+
+func nicklistHdata(bufs []*Buffer) hdata {
+	h := hdata{path: "buffer/nicklist_item", keys: nicklistKeys}
+	for _, b := range bufs {
+		for _, n := range append([]*Nick{rootGroup(b)}, b.Nicks...) {
+			h.items = append(h.items, hdataItem{
+				ptrs: []uint64{b.Ptr, n.Ptr},
+				vals: nickVars(n),
+			})
+		}
+	}
+	return h
+}
+
+func nicklistDiff(b *Buffer, op byte, n *Nick) hdata {
+	h := hdata{path: "buffer/nicklist_item", keys: append([]string{"_diff:chr"}, nicklistKeys...)}
+	for _, item := range []struct {
+		op   byte
+		nick *Nick
+	}{{'^', rootGroup(b)}, {op, n}} {
+		vals := nickVars(item.nick)
+		vals["_diff"] = item.op
+		h.items = append(h.items, hdataItem{
+			ptrs: []uint64{b.Ptr, item.nick.Ptr},
+			vals: vals,
+		})
+	}
+	return h
+}
+
+// Client connections.
+
+func (c *client) serve() {
+	defer c.srv.wg.Done()
+	defer func() {
+		c.srv.mu.Lock()
+		delete(c.srv.clients, c)
+		c.srv.mu.Unlock()
+		c.c.Close()
+	}()
+	r := bufio.NewReader(c.c)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		var id string
+		if strings.HasPrefix(line, "(") {
+			idx := strings.Index(line, ")")
+			if idx < 0 {
+				continue
+			}
+			id, line = line[1:idx], strings.TrimLeft(line[idx+1:], " ")
+		}
+		cmd, args := line, ""
+		if idx := strings.Index(line, " "); idx >= 0 {
+			cmd, args = line[:idx], line[idx+1:]
+		}
+		if !c.handle(id, cmd, args) {
+			return
+		}
+	}
+}
+
+// handle executes a command. It returns false if the connection
+// must be closed.
+func (c *client) handle(id, cmd, args string) bool {
+	s := c.srv
+	switch cmd {
+	case "handshake":
+		c.handshake(id, args)
+		return true
+	case "init":
+		return c.init(args)
+	case "quit":
+		return false
+	}
+	if !c.authed {
+		log.Printf("relaytest: ignoring %s before init", cmd)
+		return true
+	}
+	switch cmd {
+	case "hdata":
+		fields := strings.Fields(args)
+		if len(fields) == 0 {
+			return true
+		}
+		var keys []string
+		if len(fields) > 1 {
+			keys = strings.Split(fields[1], ",")
+		}
+		s.mu.Lock()
+		h, err := s.evalHdata(fields[0])
+		s.mu.Unlock()
+		if err != nil {
+			log.Printf("relaytest: hdata %s: %s", fields[0], err)
+		}
+		h.filter(keys)
+		c.reply(id, h.generic())
+	case "info":
+		s.mu.Lock()
+		value := s.infos[args]
+		s.mu.Unlock()
+		c.reply(id, weechat.Info{Name: args, Value: value})
+	case "infolist":
+		fields := strings.Fields(args)
+		name := ""
+		if len(fields) > 0 {
+			name = fields[0]
+		}
+		s.mu.Lock()
+		var items []map[string]interface{}
+		if name == "buffer" {
+			for _, b := range s.buffers {
+				vars := s.bufferVars(b)
+				vars["pointer"] = b.Ptr
+				delete(vars, "local_variables")
+				items = append(items, vars)
+			}
+		}
+		s.mu.Unlock()
+		c.reply(id, weechat.Infolist{Name: name, Items: items})
+	case "nicklist":
+		s.mu.Lock()
+		bufs := s.buffers
+		if args != "" {
+			bufs = nil
+			if b := s.lookupBuffer(args); b != nil {
+				bufs = []*Buffer{b}
+			}
+		}
+		h := nicklistHdata(bufs)
+		s.mu.Unlock()
+		c.reply(id, h.generic())
+	case "input":
+		idx := strings.Index(args, " ")
+		if idx < 0 {
+			return true
+		}
+		name, text := args[:idx], args[idx+1:]
+		s.mu.Lock()
+		s.inputs = append(s.inputs, Input{Buffer: name, Text: text})
+		b := s.lookupBuffer(name)
+		s.mu.Unlock()
+		if b != nil && !strings.HasPrefix(text, "/") {
+			s.AddLine(b, Line{
+				Prefix:    s.Nick,
+				Message:   text,
+				Tags:      []string{"self_msg", "nick_" + s.Nick},
+				Displayed: true,
+			})
+		}
+	case "sync", "desync":
+		fields := strings.Fields(args)
+		bufs := []string{"*"}
+		if len(fields) > 0 {
+			bufs = strings.Split(fields[0], ",")
+		}
+		s.mu.Lock()
+		for _, b := range bufs {
+			if cmd == "sync" {
+				c.synced[b] = true
+			} else if b == "*" {
+				c.synced = make(map[string]bool)
+			} else {
+				delete(c.synced, b)
+			}
+		}
+		s.mu.Unlock()
+	case "ping":
+		c.reply("_pong", args)
+	default:
+		log.Printf("relaytest: unknown command %q", cmd)
+	}
+	return true
+}
+
+// splitOptions splits comma-separated options, where commas
+// can be escaped by a backslash.
+func splitOptions(args string) map[string]string {
+	opts := make(map[string]string)
+	var cur []byte
+	flush := func() {
+		kv := string(cur)
+		if idx := strings.Index(kv, "="); idx >= 0 {
+			opts[kv[:idx]] = kv[idx+1:]
+		}
+		cur = cur[:0]
+	}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == '\\' && i+1 < len(args) && args[i+1] == ',':
+			cur = append(cur, ',')
+			i++
+		case args[i] == ',':
+			flush()
+		default:
+			cur = append(cur, args[i])
+		}
+	}
+	flush()
+	return opts
+}
+
+func (c *client) handshake(id, args string) {
+	opts := splitOptions(args)
+	c.algo = "plain"
+	for _, a := range strings.Split(opts["password_hash_algo"], ":") {
+		if hashFunc(a) != nil {
+			c.algo = a
+			break
+		}
+	}
+	compression := "off"
+	for _, a := range strings.Split(opts["compression"], ":") {
+		if a == "zlib" {
+			compression = a
+			break
+		}
+	}
+	c.nonce = make([]byte, 16)
+	rand.Read(c.nonce)
+	c.reply(id, map[string]string{
+		"password_hash_algo":       c.algo,
+		"password_hash_iterations": strconv.Itoa(iterations),
+		"totp":                     "off",
+		"nonce":                    hex.EncodeToString(c.nonce),
+		"compression":              compression,
+	})
+	c.compress = compression == "zlib"
+}
+
+func (c *client) init(args string) bool {
+	opts := splitOptions(args)
+	if opts["compression"] == "zlib" {
+		c.compress = true
+	}
+	password := c.srv.Password
+	switch {
+	case password == "":
+		c.authed = true
+	case opts["password_hash"] != "":
+		c.authed = c.checkHash(opts["password_hash"], password)
+	default:
+		c.authed = opts["password"] == password
+	}
+	return c.authed
+}
+
+// iterations is the PBKDF2 iteration count, the WeeChat default.
+const iterations = 100000
+
+// hashFunc returns the hash function of a password hash algorithm,
+// or nil if it is not supported.
+func hashFunc(algo string) func() hash.Hash {
+	switch algo {
+	case "sha256", "pbkdf2+sha256":
+		return sha256.New
+	case "sha512", "pbkdf2+sha512":
+		return sha512.New
+	}
+	return nil
+}
+
+// checkHash checks a password_hash option: algo:salt:hash,
+// or algo:salt:iterations:hash for PBKDF2.
+func (c *client) checkHash(value, password string) bool {
+	parts := strings.Split(value, ":")
+	pbkdf := strings.HasPrefix(c.algo, "pbkdf2+")
+	switch {
+	case parts[0] != c.algo || c.nonce == nil:
+		return false
+	case pbkdf && (len(parts) != 4 || parts[2] != strconv.Itoa(iterations)):
+		return false
+	case !pbkdf && len(parts) != 3:
+		return false
+	}
+	salt, err := hex.DecodeString(parts[1])
+	if err != nil || !strings.HasPrefix(string(salt), string(c.nonce)) {
+		return false
+	}
+	h := hashFunc(c.algo)
+	if h == nil {
+		return false
+	}
+	var sum []byte
+	if pbkdf {
+		sum = pbkdf2(h, []byte(password), salt, iterations)
+	} else {
+		d := h()
+		d.Write(salt)
+		d.Write([]byte(password))
+		sum = d.Sum(nil)
+	}
+	return hex.EncodeToString(sum) == parts[len(parts)-1]
+}
+
+// pbkdf2 derives a key of the size of the hash (RFC 8018,
+// section 5.2).
+func pbkdf2(h func() hash.Hash, password, salt []byte, iter int) []byte {
+	mac := hmac.New(h, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	key := append([]byte(nil), u...)
+	for n := 1; n < iter; n++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for i := range key {
+			key[i] ^= u[i]
+		}
+	}
+	return key
+}
+
+// reply sends a message with the given identifier.
+func (c *client) reply(id string, objs ...interface{}) {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	e := weechat.Encoder{Compress: c.compress}
+	e.Reset(id)
+	for _, obj := range objs {
+		if err := e.Encode(obj); err != nil {
+			log.Printf("relaytest: %s", err)
+			return
+		}
+	}
+	c.c.Write(e.Message())
+}
+
+// hdata paths.
+
+// evalHdata evaluates a hdata path such as
+// "buffer:gui_buffers(*)/lines/last_line(-10)/data".
+func (s *Server) evalHdata(path string) (hdata, error) {
+	elems := strings.Split(path, "/")
+	head := elems[0]
+	idx := strings.Index(head, ":")
+	if idx < 0 {
+		return hdata{}, fmt.Errorf("missing pointer in %q", head)
+	}
+	hname := head[:idx]
+	start, count, err := parseCount(head[idx+1:])
+	if err != nil {
+		return hdata{}, err
+	}
+
+	// An object is a chain of pointers and the last object.
+	type object struct {
+		ptrs []uint64
+		buf  *Buffer
+		line int // index in buf.Lines
+	}
+	var objs []object
+	var names []string
+	switch hname {
+	case "buffer":
+		i := -1
+		switch start {
+		case "gui_buffers":
+			i = 0
+		case "last_gui_buffer":
+			i = len(s.buffers) - 1
+		default:
+			for j, b := range s.buffers {
+				if fmt.Sprintf("0x%x", b.Ptr) == start {
+					i = j
+				}
+			}
+		}
+		if i < 0 || i >= len(s.buffers) {
+			return hdata{path: hname}, nil
+		}
+		for _, j := range walk(i, count, len(s.buffers)) {
+			b := s.buffers[j]
+			objs = append(objs, object{ptrs: []uint64{b.Ptr}, buf: b, line: -1})
+		}
+	case "line":
+		for _, b := range s.buffers {
+			for j, l := range b.Lines {
+				if fmt.Sprintf("0x%x", l.Ptr) != start {
+					continue
+				}
+				for _, k := range walk(j, count, len(b.Lines)) {
+					objs = append(objs, object{ptrs: []uint64{b.Lines[k].Ptr}, buf: b, line: k})
+				}
+			}
+		}
+	default:
+		return hdata{path: hname}, fmt.Errorf("unsupported hdata %q", hname)
+	}
+	names = append(names, hname)
+
+	for _, elem := range elems[1:] {
+		name, count, err := parseCount(elem)
+		if err != nil {
+			return hdata{}, err
+		}
+		var next []object
+		switch {
+		case name == "lines" && hname == "buffer":
+			hname = "lines"
+			for _, o := range objs {
+				next = append(next, object{ptrs: append(o.ptrs, o.buf.linesPtr), buf: o.buf, line: -1})
+			}
+		case (name == "first_line" || name == "last_line") && hname == "lines":
+			hname = "line"
+			for _, o := range objs {
+				n := len(o.buf.Lines)
+				if n == 0 {
+					continue
+				}
+				i := 0
+				if name == "last_line" {
+					i = n - 1
+				}
+				for _, k := range walk(i, count, n) {
+					next = append(next, object{ptrs: append(o.ptrs[:len(o.ptrs):len(o.ptrs)], o.buf.Lines[k].Ptr), buf: o.buf, line: k})
+				}
+			}
+		case name == "data" && hname == "line":
+			hname = "line_data"
+			for _, o := range objs {
+				l := o.buf.Lines[o.line]
+				next = append(next, object{ptrs: append(o.ptrs, l.DataPtr), buf: o.buf, line: o.line})
+			}
+		default:
+			return hdata{}, fmt.Errorf("unsupported path element %q after %s", elem, hname)
+		}
+		objs = next
+		names = append(names, hname)
+	}
+
+	h := hdata{path: strings.Join(names, "/")}
+	switch hname {
+	case "buffer":
+		h.keys = buffersKeys
+	case "line_data":
+		h.keys = lineDataKeys
+	}
+	for _, o := range objs {
+		item := hdataItem{ptrs: o.ptrs}
+		switch hname {
+		case "buffer":
+			item.vals = s.bufferVars(o.buf)
+		case "line_data":
+			item.vals = lineDataVars(o.buf, o.buf.Lines[o.line])
+		}
+		h.items = append(h.items, item)
+	}
+	return h, nil
+}
+
+// parseCount splits "name(count)" into name and count, where
+// "*" means all items (count 0). A missing count means 1.
+func parseCount(s string) (name string, count int, err error) {
+	idx := strings.Index(s, "(")
+	if idx < 0 || !strings.HasSuffix(s, ")") {
+		return s, 1, nil
+	}
+	name, c := s[:idx], s[idx+1:len(s)-1]
+	if c == "*" {
+		return name, 0, nil
+	}
+	count, err = strconv.Atoi(c)
+	return name, count, err
+}
+
+// walk returns the indices visited when moving count items from
+// index i in a list of n items: forward if count is positive,
+// backward if it is negative, and forward to the end if it is zero.
+func walk(i, count, n int) []int {
+	var idx []int
+	step := 1
+	if count < 0 {
+		step, count = -1, -count
+	}
+	for ; i >= 0 && i < n; i += step {
+		if count > 0 && len(idx) == count {
+			break
+		}
+		idx = append(idx, i)
+	}
+	return idx
+}
@@ -0,0 +1,122 @@
+package relaytest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/weechat"
+)
+
+func TestServer(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	b := s.AddBuffer("irc.libera.#go")
+	for _, msg := range []string{"hello", "world", "again"} {
+		s.AddLine(b, Line{Prefix: "bob", Message: msg, Displayed: true})
+	}
+	s.AddNick(b, Nick{Name: "bob", Visible: true})
+	s.SetInfo("version", "3.8")
+
+	conn, err := weechat.Dial(s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	bufs, err := conn.ListBuffers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bufs) != 2 || bufs[1].FullName != "irc.libera.#go" || bufs[1].Name != "libera.#go" ||
+		bufs[1].Number != 2 || bufs[1].Prev != bufs[0].Self {
+		t.Errorf("got buffers %+v", bufs)
+	}
+
+	lines, err := conn.BufferData(b.Ptr, -2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0].Message != "again" || lines[1].Message != "world" ||
+		lines[0].Buffer != uintptr(b.Ptr) {
+		t.Errorf("got lines %+v", lines)
+	}
+
+	if v, err := conn.Info("version"); err != nil || v != "3.8" {
+		t.Errorf("got version %q, %v", v, err)
+	}
+
+	nicks, err := conn.Nicklist(b.FullName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nicks) != 2 || nicks[1].Name != "bob" || nicks[1].Parent != "root" {
+		t.Errorf("got nicklist %+v", nicks)
+	}
+
+	events, err := conn.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Synchronize with the server.
+	if _, err := conn.Info("version"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Input(b.FullName, "hi bob"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		l, ok := ev.(weechat.LineAdded)
+		if !ok || l.Line.Message != "hi bob" || l.Line.Prefix != "me" {
+			t.Errorf("got event %#v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+	if in := s.Inputs(); len(in) != 1 || in[0] != (Input{Buffer: b.FullName, Text: "hi bob"}) {
+		t.Errorf("got inputs %+v", in)
+	}
+
+	s.CloseBuffer(b)
+	select {
+	case ev := <-events:
+		if c, ok := ev.(weechat.BufferClosed); !ok || c.Buffer.FullName != "irc.libera.#go" {
+			t.Errorf("got event %#v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Password = "secret"
+
+	for _, cfg := range []weechat.DialConfig{
+		{Password: "secret"},
+		{Password: "secret", Handshake: true, HashAlgos: []string{weechat.HashSHA512}},
+		{Password: "secret", Handshake: true, HashAlgos: []string{weechat.HashPBKDF2SHA256}},
+		// pbkdf2+sha512 is the preferred algorithm.
+		{Password: "secret", Handshake: true, Compression: []string{weechat.CompressZlib}},
+	} {
+		conn, err := weechat.DialWithConfig(s.Addr, cfg)
+		if err != nil {
+			t.Errorf("%+v: %s", cfg, err)
+			continue
+		}
+		if _, err := conn.ListBuffers(); err != nil {
+			t.Errorf("%+v: %s", cfg, err)
+		}
+		conn.Close()
+	}
+
+	for _, cfg := range []weechat.DialConfig{
+		{Password: "wrong", Timeout: 5 * time.Second},
+		{Password: "wrong", Handshake: true, Timeout: 5 * time.Second},
+	} {
+		if _, err := weechat.DialWithConfig(s.Addr, cfg); err == nil {
+			t.Errorf("%+v: no error for wrong password", cfg)
+		}
+	}
+}
@@ -13,52 +13,73 @@ func debugf(format string, args ...interface{}) {
 	}
 }
 
+// A Nick is an item of a nicklist: either a group (Group is 1)
+// or a nick.
 type Nick struct {
-	Group   byte   "group"
-	Visible byte   "visible"
-	Name    string "name"
-	Prefix  string "prefix"
+	Group       byte   `weechat:"group"`
+	Visible     byte   `weechat:"visible"`
+	Level       int    `weechat:"level"`
+	Name        string `weechat:"name"`
+	Color       string `weechat:"color"`
+	Prefix      string `weechat:"prefix"`
+	PrefixColor string `weechat:"prefix_color"`
 
-	Buffer uintptr "ptr:buffer"
-	Self   uintptr "ptr:nicklist_item"
+	// Parent is the name of the enclosing group, empty for
+	// the root group. It is filled by Conn.Nicklist.
+	Parent string
+
+	Buffer uintptr `weechat:"ptr:buffer"`
+	Self   uintptr `weechat:"ptr:nicklist_item"`
 }
 
 func (n Nick) String() string {
 	return n.Prefix + n.Name
 }
 
+// A NickDiff is an item of a nicklist update. Op is '^' for the
+// parent group of the following items, '+', '-' or '*' when the
+// item is added, removed or changed.
+type NickDiff struct {
+	Op byte `weechat:"_diff"`
+	Nick
+}
+
 type Buffer struct {
-	Name      string "name"
-	ShortName string "short_name"
-	FullName  string "full_name"
-	Title     string "title"
-
-	Self uintptr "ptr:buffer"
-	Prev uintptr "prev_buffer"
-	Next uintptr "next_buffer"
+	Number    int    `weechat:"number"`
+	Name      string `weechat:"name"`
+	ShortName string `weechat:"short_name"`
+	FullName  string `weechat:"full_name"`
+	Title     string `weechat:"title"`
+
+	Self uintptr `weechat:"ptr:buffer"`
+	Prev uintptr `weechat:"prev_buffer"`
+	Next uintptr `weechat:"next_buffer"`
 }
 
 type Line struct {
-	Self uintptr "ptr:line"
+	Self uintptr `weechat:"ptr:line"`
 }
 
 type LineData struct {
-	Date        time.Time "date"
-	DatePrinted time.Time "date_printed"
-	TimeString  string    "str_time"
-	Prefix      string    "prefix"
-	Message     string    "message"
-
-	RefreshNeeded byte "refresh_needed"
-	Displayed     byte "displayed"
-	Highlight     byte "highlight"
-
-	Buffer uintptr "ptr:buffer"
-	Lines  uintptr "ptr:lines"
-	Line   uintptr "ptr:line"
-	Self   uintptr "ptr:line_data"
+	Date        time.Time `weechat:"date"`
+	DatePrinted time.Time `weechat:"date_printed"`
+	TimeString  string    `weechat:"str_time"`
+	Prefix      string    `weechat:"prefix"`
+	Message     string    `weechat:"message"`
+	Tags        []string  `weechat:"tags_array"`
+
+	RefreshNeeded byte `weechat:"refresh_needed"`
+	Displayed     byte `weechat:"displayed"`
+	Highlight     byte `weechat:"highlight"`
+
+	Buffer uintptr `weechat:"ptr:buffer"`
+	Lines  uintptr `weechat:"ptr:lines"`
+	Line   uintptr `weechat:"ptr:line"`
+	Self   uintptr `weechat:"ptr:line_data"`
 }
 
+// Clean removes color codes from the prefix, message and time
+// of l. Use ParseColors to keep styles.
 func (l *LineData) Clean() {
 	l.Prefix = cleanColor(l.Prefix)
 	l.Message = cleanColor(l.Message)
@@ -66,24 +87,5 @@ func (l *LineData) Clean() {
 }
 
 func cleanColor(s string) string {
-	buf := make([]byte, 0, len(s))
-	for i := 0; i < len(s); i++ {
-		if s[i] == '\x19' {
-			// weechat color code.
-			switch s[i+1] {
-			case 'F', 'B':
-				// fore/back-ground color: F## or B##
-				i += 3
-			case '*':
-				// *##,##
-				i += 6
-			default:
-				// ##
-				i += 2
-			}
-		} else {
-			buf = append(buf, s[i])
-		}
-	}
-	return string(buf)
+	return ParseColors(s).String()
 }
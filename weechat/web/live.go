@@ -0,0 +1,157 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/remyoudompheng/go-misc/weechat"
+	ws "golang.org/x/net/websocket"
+)
+
+// An Event is sent to browsers as JSON over the websocket.
+type Event struct {
+	Type      string `json:"type"`           // "status", "error", "line", "opened", "closed", "renamed"
+	Buffer    string `json:"buffer"`         // buffer pointer, in hex
+	Name      string `json:"name,omitempty"` // buffer name
+	HTML      string `json:"html,omitempty"` // rendered line
+	Highlight bool   `json:"highlight,omitempty"`
+	Text      string `json:"text,omitempty"` // plain text of highlights, relay status or error
+	Connected bool   `json:"connected,omitempty"`
+}
+
+// An Input is sent by browsers to reply in a buffer.
+type Input struct {
+	Buffer string `json:"buffer"` // buffer pointer, in hex
+	Text   string `json:"text"`
+}
+
+// A hub broadcasts relay events to connected browsers,
+// sharing a single relay connection.
+type hub struct {
+	mu      sync.Mutex
+	clients map[chan Event]bool
+}
+
+func newHub() *hub {
+	return &hub{clients: make(map[chan Event]bool)}
+}
+
+// close disconnects all clients.
+func (h *hub) close() {
+	h.mu.Lock()
+	for c := range h.clients {
+		close(c)
+		delete(h.clients, c)
+	}
+	h.mu.Unlock()
+}
+
+func (h *hub) broadcast(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		select {
+		case c <- e:
+		default:
+			// too slow, drop the client.
+			close(c)
+			delete(h.clients, c)
+		}
+	}
+}
+
+func (h *hub) subscribe() chan Event {
+	c := make(chan Event, 64)
+	h.mu.Lock()
+	h.clients[c] = true
+	h.mu.Unlock()
+	return c
+}
+
+func (h *hub) unsubscribe(c chan Event) {
+	h.mu.Lock()
+	if h.clients[c] {
+		close(c)
+		delete(h.clients, c)
+	}
+	h.mu.Unlock()
+}
+
+func convertEvent(ev weechat.Event) (Event, bool) {
+	switch ev := ev.(type) {
+	case weechat.LineAdded:
+		line := ev.Line
+		buf := new(bytes.Buffer)
+		if err := linesTpl.Execute(buf, []weechat.LineData{line}); err != nil {
+			log.Printf("template error: %s", err)
+			return Event{}, false
+		}
+		e := Event{
+			Type:      "line",
+			Buffer:    fmt.Sprintf("%x", line.Buffer),
+			HTML:      buf.String(),
+			Highlight: line.Highlight != 0,
+		}
+		if e.Highlight {
+			e.Text = weechat.ParseColors(line.Prefix).String() + " " +
+				weechat.ParseColors(line.Message).String()
+		}
+		return e, true
+	case weechat.BufferOpened:
+		return bufferEvent("opened", ev.Buffer), true
+	case weechat.BufferClosed:
+		return bufferEvent("closed", ev.Buffer), true
+	case weechat.BufferRenamed:
+		return bufferEvent("renamed", ev.Buffer), true
+	}
+	return Event{}, false
+}
+
+func bufferEvent(typ string, b weechat.Buffer) Event {
+	return Event{Type: typ, Buffer: fmt.Sprintf("%x", b.Self), Name: b.Name}
+}
+
+func (s *Server) handleWebsocket(conn *ws.Conn) {
+	defer conn.Close()
+	r := s.relay(conn.Request())
+	if r == nil {
+		return
+	}
+	events := r.hub.subscribe()
+	defer r.hub.unsubscribe(events)
+	if err := ws.JSON.Send(conn, r.statusEvent()); err != nil {
+		return
+	}
+
+	// Read inputs from the browser.
+	go func() {
+		defer r.hub.unsubscribe(events)
+		for {
+			var in Input
+			if err := ws.JSON.Receive(conn, &in); err != nil {
+				return
+			}
+			ptr, err := strconv.ParseUint(in.Buffer, 16, 64)
+			if err != nil || in.Text == "" {
+				continue
+			}
+			wconn, err := r.Conn()
+			if err == nil {
+				err = wconn.Input(fmt.Sprintf("0x%x", ptr), in.Text)
+			}
+			if err != nil {
+				log.Printf("weechat input error: %s", err)
+				ws.JSON.Send(conn, Event{Type: "error", Text: err.Error()})
+			}
+		}
+	}()
+
+	for e := range events {
+		if err := ws.JSON.Send(conn, e); err != nil {
+			return
+		}
+	}
+}
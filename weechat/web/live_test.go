@@ -0,0 +1,125 @@
+package web
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/weechat/relaytest"
+	ws "golang.org/x/net/websocket"
+)
+
+func TestWebsocket(t *testing.T) {
+	minBackoff = 10 * time.Millisecond
+	relay := relaytest.NewServer()
+	defer relay.Close()
+
+	srv := NewServer(Relay{Name: "test", Addr: relay.Addr})
+	defer srv.Close()
+	hsrv := httptest.NewServer(srv)
+	defer hsrv.Close()
+
+	url := "ws" + strings.TrimPrefix(hsrv.URL, "http") + "/weechat/ws?relay=test"
+	if c, err := ws.Dial(url, "", "http://evil.example.com"); err == nil {
+		c.Close()
+		t.Errorf("websocket accepted from another origin")
+	}
+	conn, err := ws.Dial(url, "", hsrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	recv := func() Event {
+		var e Event
+		if err := ws.JSON.Receive(conn, &e); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	// Wait until the relay is connected.
+	var e Event
+	for !e.Connected {
+		if e = recv(); e.Type != "status" {
+			t.Fatalf("got %+v", e)
+		}
+	}
+	resp, err := http.Get(hsrv.URL + "/weechat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), ">weechat<") {
+		t.Errorf("buffer list is missing from page:\n%s", page)
+	}
+
+	b := relay.AddBuffer("irc.libera.#go")
+	e = recv()
+	if e.Type != "opened" || e.Name != "libera.#go" {
+		t.Errorf("got event %+v", e)
+	}
+
+	relay.AddLine(b, relaytest.Line{
+		Prefix: "bob", Message: "hello <me>",
+		Displayed: true, Highlight: true,
+	})
+	e = recv()
+	if e.Type != "line" || !e.Highlight || e.Text != "bob hello <me>" ||
+		!strings.Contains(e.HTML, "hello &lt;me&gt;") {
+		t.Errorf("got event %+v", e)
+	}
+
+	if err := ws.JSON.Send(conn, Input{Buffer: e.Buffer, Text: "hi bob"}); err != nil {
+		t.Fatal(err)
+	}
+	e = recv()
+	if e.Type != "line" || !strings.Contains(e.HTML, "hi bob") {
+		t.Errorf("got event %+v", e)
+	}
+
+	resp, err = http.Get(hsrv.URL + "/weechat/buflines?relay=test&buffer=" + e.Buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "hi bob") || resp.Header.Get("X-Weechat-Before") != "" {
+		t.Errorf("got lines %s, headers %v", page, resp.Header)
+	}
+
+	// The relay goes away.
+	relay.Close()
+	e = recv()
+	if e.Type != "status" || e.Connected {
+		t.Errorf("got event %+v", e)
+	}
+	resp, err = http.Get(hsrv.URL + "/weechat/buflines?relay=test&buffer=1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got status %s for disconnected relay", resp.Status)
+	}
+}
+
+func TestParseRelays(t *testing.T) {
+	relays := parseRelays("home=example.com:9000, localhost:9001")
+	if len(relays) != 2 || relays[0].Name != "home" || relays[0].Addr != "example.com:9000" ||
+		relays[1].Name != "localhost:9001" {
+		t.Errorf("got %+v", relays)
+	}
+	relays, err := LoadConfig(strings.NewReader(`[{"Name": "a", "Addr": "b:1", "Password": "p", "TLS": true}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(relays) != 1 || relays[0].Config.Password != "p" || relays[0].Config.TLS == nil {
+		t.Errorf("got %+v", relays)
+	}
+}
@@ -0,0 +1,268 @@
+package web
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/weechat"
+	ws "golang.org/x/net/websocket"
+)
+
+// A Relay describes a WeeChat relay to connect to.
+type Relay struct {
+	Name   string // name displayed in the interface
+	Addr   string // host:port
+	Config weechat.DialConfig
+}
+
+// LoadConfig reads a list of relays from JSON, for example:
+//
+//	[{"Name": "home", "Addr": "example.com:9000",
+//	  "Password": "secret", "TLS": true, "Compression": ["zlib"]}]
+func LoadConfig(r io.Reader) ([]Relay, error) {
+	var cfgs []struct {
+		Name, Addr  string
+		Password    string
+		TOTP        string
+		TLS         bool
+		Handshake   bool
+		Compression []string
+	}
+	if err := json.NewDecoder(r).Decode(&cfgs); err != nil {
+		return nil, fmt.Errorf("invalid relay configuration: %s", err)
+	}
+	var relays []Relay
+	for _, c := range cfgs {
+		r := Relay{Name: c.Name, Addr: c.Addr}
+		r.Config.Password = c.Password
+		r.Config.TOTP = c.TOTP
+		r.Config.Handshake = c.Handshake
+		r.Config.Compression = c.Compression
+		if c.TLS {
+			r.Config.TLS = new(tls.Config)
+		}
+		relays = append(relays, r)
+	}
+	return relays, nil
+}
+
+// parseRelays parses a comma-separated list of relay addresses,
+// optionally named as name=host:port.
+func parseRelays(s string) []Relay {
+	var relays []Relay
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		r := Relay{Name: item, Addr: item}
+		if idx := strings.Index(item, "="); idx >= 0 {
+			r.Name, r.Addr = item[:idx], item[idx+1:]
+		}
+		relays = append(relays, r)
+	}
+	return relays
+}
+
+// Delays between connection attempts to a relay.
+var (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+var (
+	errNotConnected = errors.New("not connected")
+	errBadOrigin    = errors.New("websocket origin does not match host")
+)
+
+// relay maintains a connection to a relay, reconnecting
+// when it is lost.
+type relay struct {
+	Relay
+	hub  *hub
+	quit chan struct{}
+	done chan struct{}
+
+	mu    sync.Mutex
+	conn  *weechat.Conn
+	err   error     // last error, if not connected
+	since time.Time // time of last status change
+}
+
+func newRelay(r Relay) *relay {
+	rl := &relay{
+		Relay: r,
+		hub:   newHub(),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+		err:   errNotConnected,
+		since: time.Now(),
+	}
+	go rl.run()
+	return rl
+}
+
+func (r *relay) run() {
+	defer close(r.done)
+	backoff := minBackoff
+	for {
+		conn, err := weechat.DialWithConfig(r.Addr, r.Config)
+		var events <-chan weechat.Event
+		if err == nil {
+			events, err = conn.Sync()
+			if err != nil {
+				conn.Close()
+			}
+		}
+		if err != nil {
+			log.Printf("weechat relay %s: %s (retrying in %s)", r.Name, err, backoff)
+			r.setStatus(nil, err)
+			select {
+			case <-time.After(backoff):
+			case <-r.quit:
+				return
+			}
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+
+		log.Printf("weechat relay %s: connected to %s", r.Name, r.Addr)
+		backoff = minBackoff
+		r.setStatus(conn, nil)
+	forward:
+		for {
+			select {
+			case ev, ok := <-events:
+				if !ok {
+					break forward
+				}
+				if e, ok := convertEvent(ev); ok {
+					r.hub.broadcast(e)
+				}
+			case <-r.quit:
+				conn.Close()
+				return
+			}
+		}
+		conn.Close()
+		log.Printf("weechat relay %s: connection lost", r.Name)
+		r.setStatus(nil, errors.New("connection lost"))
+	}
+}
+
+func (r *relay) setStatus(conn *weechat.Conn, err error) {
+	r.mu.Lock()
+	r.conn, r.err, r.since = conn, err, time.Now()
+	r.mu.Unlock()
+	r.hub.broadcast(r.statusEvent())
+}
+
+// Conn returns the current connection to the relay.
+func (r *relay) Conn() (*weechat.Conn, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil, fmt.Errorf("relay %s: %s", r.Name, r.err)
+	}
+	return r.conn, nil
+}
+
+// Status describes the health of the relay connection.
+func (r *relay) Status() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn != nil {
+		return "connected since " + r.since.Format("Jan 2 15:04")
+	}
+	return fmt.Sprintf("%s (since %s)", r.err, r.since.Format("Jan 2 15:04"))
+}
+
+// Connected reports whether the relay is connected.
+func (r *relay) Connected() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.conn != nil
+}
+
+func (r *relay) statusEvent() Event {
+	e := Event{Type: "status", Text: r.Status()}
+	e.Connected = r.Connected()
+	return e
+}
+
+func (r *relay) close() {
+	close(r.quit)
+	<-r.done
+	r.hub.close()
+}
+
+// A Server is a web interface to one or several WeeChat relays.
+// Relays are connected in the background: they are reconnected
+// automatically and their health is displayed on the web page.
+type Server struct {
+	mux    *http.ServeMux
+	relays []*relay
+}
+
+// NewServer returns a Server for the given relays, which
+// handles requests for paths under /weechat.
+func NewServer(relays ...Relay) *Server {
+	s := &Server{mux: http.NewServeMux()}
+	for _, r := range relays {
+		s.relays = append(s.relays, newRelay(r))
+	}
+	s.mux.HandleFunc("/weechat", s.handleHome)
+	s.mux.HandleFunc("/weechat/buflines", s.handleLines)
+	s.mux.Handle("/weechat/ws", ws.Server{
+		Handler:   s.handleWebsocket,
+		Handshake: checkOrigin,
+	})
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mux.ServeHTTP(w, req)
+}
+
+// checkOrigin rejects websockets opened by pages of other sites,
+// which could otherwise send input to WeeChat on behalf of the user.
+func checkOrigin(config *ws.Config, req *http.Request) (err error) {
+	config.Origin, err = ws.Origin(config, req)
+	if err == nil && (config.Origin == nil || config.Origin.Host != req.Host) {
+		err = errBadOrigin
+	}
+	return err
+}
+
+// Close disconnects the server from relays and closes
+// websocket connections.
+func (s *Server) Close() {
+	for _, r := range s.relays {
+		r.close()
+	}
+}
+
+// relay returns the relay selected by the "relay" parameter
+// of the request, or the first one.
+func (s *Server) relay(req *http.Request) *relay {
+	name := req.FormValue("relay")
+	for _, r := range s.relays {
+		if r.Name == name {
+			return r
+		}
+	}
+	if name == "" && len(s.relays) > 0 {
+		return s.relays[0]
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,34 +17,51 @@ import (
 	"unicode"
 
 	"github.com/remyoudompheng/go-misc/weechat"
-	ws "golang.org/x/net/websocket"
 )
 
-func Register(mux *http.ServeMux) {
-	if mux == nil {
-		mux = http.DefaultServeMux
-	}
-	mux.HandleFunc("/weechat", handleHome)
-	mux.HandleFunc("/weechat/buflines", handleLines)
-	mux.Handle("/weechat/ws", ws.Handler(handleWebsocket))
-}
-
 var (
-	weechatAddr string
-	weechatConn *weechat.Conn
-	initOnce    sync.Once
+	relayFlag  string
+	configFlag string
 )
 
 func init() {
-	flag.StringVar(&weechatAddr, "weechat.relay", "", "address of Weechat relay")
+	flag.StringVar(&relayFlag, "weechat.relay", "",
+		"addresses of Weechat relays, as name=host:port separated by commas")
+	flag.StringVar(&configFlag, "weechat.config", "", "JSON file describing Weechat relays")
 }
 
-func initWeechat() {
-	conn, err := weechat.Dial(weechatAddr)
-	if err != nil {
-		log.Fatal(err)
+// Register registers at /weechat a Server for the relays given
+// on the command line. The server is created on the first request,
+// after flags are parsed.
+func Register(mux *http.ServeMux) {
+	if mux == nil {
+		mux = http.DefaultServeMux
+	}
+	var once sync.Once
+	var srv *Server
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		once.Do(func() { srv = serverFromFlags() })
+		srv.ServeHTTP(w, req)
+	})
+	mux.Handle("/weechat", h)
+	mux.Handle("/weechat/", h)
+}
+
+func serverFromFlags() *Server {
+	relays := parseRelays(relayFlag)
+	if configFlag != "" {
+		f, err := os.Open(configFlag)
+		if err == nil {
+			var more []Relay
+			more, err = LoadConfig(f)
+			f.Close()
+			relays = append(relays, more...)
+		}
+		if err != nil {
+			log.Printf("weechat: %s", err)
+		}
 	}
-	weechatConn = conn
+	return NewServer(relays...)
 }
 
 const homeTplStr = `
@@ -57,18 +75,134 @@ const homeTplStr = `
     <script src="/libs/bootstrap/js/bootstrap.min.js"></script>
     <script type="text/javascript">
     $(document).ready(function() {
-      $("ul#buffers li").click(function() {
-            $.get("/weechat/buflines",
-            {"buffer": $(this).attr("addr")},
-            function(data) {
-                  $("#lines").html(data);
-            });
+      var relay = {{ $.Current.Name }};
+      var connected = {{ $.Current.Connected }};
+      var current = null;
+      var WS = window["WebSocket"] ? WebSocket : MozWebSocket;
+      var scheme = window.location.protocol == "https:" ? "wss://" : "ws://";
+      var conn = new WS(scheme + window.location.host + "/weechat/ws?relay=" +
+        encodeURIComponent(relay));
+
+      var before = null; // pointer of the oldest loaded line
+      var loading = false;
+
+      // loadLines fetches the latest lines of the current buffer,
+      // or older lines when scrolling up.
+      function loadLines(older) {
+        if (loading || (older && !before)) {
+          return;
+        }
+        loading = true;
+        var buf = current;
+        var params = {"relay": relay, "buffer": buf};
+        if (older) {
+          params.before = before;
+        }
+        $.get("/weechat/buflines", params, function(data, status, xhr) {
+          loading = false;
+          if (buf != current) {
+            return;
+          }
+          before = xhr.getResponseHeader("X-Weechat-Before");
+          var div = $("#lines")[0];
+          if (older) {
+            var height = div.scrollHeight;
+            $("#lines").prepend(data);
+            div.scrollTop += div.scrollHeight - height;
+          } else {
+            $("#lines").html(data);
+            div.scrollTop = div.scrollHeight;
+          }
+        }).fail(function() { loading = false; });
+      }
+
+      function selectBuffer(li) {
+        current = li.attr("addr");
+        before = null;
+        $("ul#buffers li").removeClass("active");
+        li.addClass("active").find(".badge").remove();
+        loadLines(false);
+      }
+
+      $("#lines").scroll(function() {
+        if (this.scrollTop < 50) {
+          loadLines(true);
+        }
+      });
+
+      $("ul#buffers").on("click", "li", function() {
+        selectBuffer($(this));
       });
+
+      conn.onmessage = function(msg) {
+        var ev = JSON.parse(msg.data);
+        var li = $("ul#buffers li[addr='" + ev.buffer + "']");
+        switch (ev.type) {
+        case "status":
+          $("#status").text(ev.text)
+            .toggleClass("label-success", !!ev.connected)
+            .toggleClass("label-danger", !ev.connected);
+          if (ev.connected && !connected) {
+            // reconnected: buffers have changed.
+            window.location.reload();
+          }
+          connected = !!ev.connected;
+          break;
+        case "error":
+          $("#status").text(ev.text);
+          break;
+        case "line":
+          if (ev.buffer == current) {
+            var div = $("#lines")[0];
+            var bottom = div.scrollTop + div.clientHeight >= div.scrollHeight - 20;
+            $("#lines").append(ev.html);
+            if (bottom) {
+              div.scrollTop = div.scrollHeight;
+            }
+          } else if (ev.highlight && li.find(".badge").length == 0) {
+            li.find("a").append(' <span class="badge">!</span>');
+          }
+          if (ev.highlight && window.Notification && Notification.permission == "granted") {
+            new Notification(li.text(), {"body": ev.text});
+          }
+          break;
+        case "opened":
+          $("<li/>").attr("addr", ev.buffer)
+            .append($("<a/>").attr("href", "javascript:void(0);").text(ev.name))
+            .appendTo("ul#buffers");
+          break;
+        case "closed":
+          li.remove();
+          if (ev.buffer == current) {
+            current = null;
+            $("#lines").empty();
+          }
+          break;
+        case "renamed":
+          li.find("a").text(ev.name);
+          break;
+        }
+      };
+
+      $("form#input").submit(function() {
+        var text = $("#input-text").val();
+        if (current && text) {
+          conn.send(JSON.stringify({"buffer": current, "text": text}));
+          $("#input-text").val("");
+        }
+        return false;
+      });
+
+      if (window.Notification && Notification.permission == "default") {
+        Notification.requestPermission();
+      }
     });
     </script>
     <style type="text/css">
     body { padding-top: 60px; }
+    div#lines { height: 70vh; overflow-y: auto; }
     div#lines div.irc-date { text-size: 70%; }
+    div#lines div.irc-highlight { background-color: #fcf8e3; }
     </style>
   </head>
   <body style="padding-top: 60px;">
@@ -88,8 +222,16 @@ const homeTplStr = `
     <div class="row">
       <div class="col-lg-3"><!-- left, vertical -->
       <div class="sidebar-nav well">
+        <ul class="nav nav-pills" id="relays">
+          {{ range $r := $.Relays }}
+          <li{{ if eq $r $.Current }} class="active"{{ end }}>
+            <a href="?relay={{ $r.Name }}" title="{{ $r.Status }}">{{ $r.Name }}
+            {{ if not $r.Connected }}<span class="badge">!</span>{{ end }}</a>
+          </li>
+          {{ end }}
+        </ul>
         <ul class="nav nav-list" id="buffers">
-          {{ range $buf := $ }}
+          {{ range $buf := $.Buffers }}
           <li addr="{{ $buf.Self | printf "%x" }}"><a href="javascript:void(0);">{{ $buf.Name }}</a></li>
           {{ end }}
         </ul>
@@ -99,10 +241,18 @@ const homeTplStr = `
       <div class="col-lg-9">
         <div class="row">
         <div class="col-12 well well-large"><!-- title -->
-          <h1>Weechat</h1>
+          <h1>Weechat <small>{{ $.Current.Name }}</small></h1>
+          <span id="status" class="label {{ if $.Current.Connected }}label-success{{ else }}label-danger{{ end }}">{{ $.Current.Status }}</span>
+          {{ if $.Err }}<div class="alert alert-danger">{{ $.Err }}</div>{{ end }}
         </div>
         </div>
 
+        <div class="row">
+        <form class="col-12" id="input">
+          <input type="text" class="form-control" id="input-text" autocomplete="off">
+        </form>
+        </div>
+
         <div class="row">
         <div class="col-12" id="lines">
         <!-- buffer lines -->
@@ -117,24 +267,38 @@ const homeTplStr = `
 
 var homeTpl = template.Must(template.New("home").Parse(homeTplStr))
 
-func handleHome(w http.ResponseWriter, req *http.Request) {
-	initOnce.Do(initWeechat)
-	bufs, err := weechatConn.ListBuffers()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+type homeData struct {
+	Relays  []*relay
+	Current *relay
+	Buffers []weechat.Buffer
+	Err     error
+}
+
+func (s *Server) handleHome(w http.ResponseWriter, req *http.Request) {
+	r := s.relay(req)
+	if r == nil {
+		http.Error(w, "no such relay", http.StatusNotFound)
 		return
 	}
-	homeTpl.Execute(w, bufs)
+	data := homeData{Relays: s.relays, Current: r}
+	conn, err := r.Conn()
+	if err == nil {
+		data.Buffers, err = conn.ListBuffers()
+	}
+	data.Err = err
+	if err := homeTpl.Execute(w, data); err != nil {
+		log.Printf("template error: %s", err)
+	}
 }
 
 const linesTplStr = `
 {{ range $line := $ }}
 {{ if $line.Displayed }}
-<div class="row">
+<div class="row{{ if $line.Highlight }} irc-highlight{{ end }}">
   <div class="col-lg-10">
-  {{ if isAction $line }}<span class="label label-success">{{ htmlMessage $line }}</span>
-  {{ else }}{{ if isSystem $line }}<span class="label label-info">{{ $line.Prefix }} {{ $line.Message }}</span>
-  {{ else }}<span class="label">{{ $line.Prefix }}</span> {{ htmlMessage $line }}
+  {{ if isAction $line }}<span class="label label-success">{{ htmlText $line.Message }}</span>
+  {{ else }}{{ if isSystem $line }}<span class="label label-info">{{ htmlText $line.Prefix }} {{ htmlText $line.Message }}</span>
+  {{ else }}<span class="label">{{ htmlText $line.Prefix }}</span> {{ htmlText $line.Message }}
   {{ end }}{{ end }}
   </div>
   <div class="col-lg-2 irc-date">{{ humanTime $line.Date }}</div>
@@ -145,14 +309,17 @@ const linesTplStr = `
 var linesTpl = template.Must(template.New("lines").
 	Funcs(template.FuncMap{
 		"isAction": isAction, "isSystem": isSystem,
-		"humanTime": humanTime, "htmlMessage": htmlMessage}).
+		"humanTime": humanTime, "htmlText": htmlText}).
 	Parse(linesTplStr))
 
-func isAction(line weechat.LineData) bool { return line.Prefix == " *" }
+func isAction(line weechat.LineData) bool {
+	return weechat.ParseColors(line.Prefix).String() == " *"
+}
 
 func isSystem(line weechat.LineData) bool {
-	return line.Prefix == "" ||
-		len(line.Prefix) <= 3 && strings.Contains(line.Prefix, "--")
+	prefix := weechat.ParseColors(line.Prefix).String()
+	return prefix == "" ||
+		len(prefix) <= 3 && strings.Contains(prefix, "--")
 }
 
 func humanTime(t time.Time) string {
@@ -171,23 +338,32 @@ func humanTime(t time.Time) string {
 	return t.Format("Mon 2, 15:04")
 }
 
-func htmlMessage(line weechat.LineData) template.HTML {
-	if !strings.Contains(line.Message, "://") {
+// htmlText renders a string with WeeChat color codes as HTML,
+// turning URLs into links.
+func htmlText(s string) template.HTML {
+	buf := new(bytes.Buffer)
+	weechat.ParseColors(s).WriteHTML(buf, linkify)
+	return template.HTML(buf.String())
+}
+
+// linkify escapes text for HTML and turns URLs into links.
+func linkify(msg string) string {
+	if !strings.Contains(msg, "://") {
 		// fast path.
-		return template.HTML(template.HTMLEscapeString(line.Message))
+		return template.HTMLEscapeString(msg)
 	}
 	buf := new(bytes.Buffer)
-	for msg := line.Message; len(msg) > 0; {
+	for len(msg) > 0 {
 		idx := strings.Index(msg, "://")
 		switch {
 		case idx >= 4 && msg[idx-4:idx] == "http":
-			buf.WriteString(msg[:idx-4])
+			buf.WriteString(template.HTMLEscapeString(msg[:idx-4]))
 			msg = msg[idx-4:]
 		case idx >= 5 && msg[idx-5:idx] == "https":
-			buf.WriteString(msg[:idx-5])
+			buf.WriteString(template.HTMLEscapeString(msg[:idx-5]))
 			msg = msg[idx-5:]
 		default:
-			buf.WriteString(msg)
+			buf.WriteString(template.HTMLEscapeString(msg))
 			msg = ""
 			continue
 		}
@@ -198,16 +374,29 @@ func htmlMessage(line weechat.LineData) template.HTML {
 		u := msg[:space]
 		msg = msg[space:]
 		if _, err := url.Parse(u); err == nil {
+			u = template.HTMLEscapeString(u)
 			fmt.Fprintf(buf, `<a href="%s">%s</a>`, u, u)
 		} else {
-			buf.WriteString(u)
+			buf.WriteString(template.HTMLEscapeString(u))
 		}
 	}
-	return template.HTML(buf.String())
+	return buf.String()
 }
 
-func handleLines(w http.ResponseWriter, req *http.Request) {
-	initOnce.Do(initWeechat)
+// pageSize is the number of lines loaded at once when scrolling.
+const pageSize = 64
+
+func (s *Server) handleLines(w http.ResponseWriter, req *http.Request) {
+	r := s.relay(req)
+	if r == nil {
+		http.Error(w, "no such relay", http.StatusNotFound)
+		return
+	}
+	conn, err := r.Conn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
 	req.ParseForm()
 	bufHex := req.Form.Get("buffer")
 	bufId, err := strconv.ParseUint(bufHex, 16, 64)
@@ -215,19 +404,24 @@ func handleLines(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	// Get latest lines in reverse order.
-	lines, err := weechatConn.BufferData(bufId, -256, "date,prefix,message,displayed")
-	revlines := make([]weechat.LineData, 0, 256)
-	for i := range lines {
-		l := lines[len(lines)-1-i]
-		l.Clean()
-		revlines = append(revlines, l)
+	cursor := weechat.Cursor{Buffer: bufId}
+	if before := req.Form.Get("before"); before != "" {
+		cursor.Line, err = strconv.ParseUint(before, 16, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
-	err = linesTpl.Execute(w, revlines)
+	lines, next, err := conn.LinesBefore(cursor, pageSize, "date,prefix,message,displayed,highlight")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if !next.Done {
+		w.Header().Set("X-Weechat-Before", fmt.Sprintf("%x", next.Line))
+	}
+	err = linesTpl.Execute(w, lines)
 	if err != nil {
 		log.Printf("template error: %s", err)
 	}
 }
-
-func handleWebsocket(conn *ws.Conn) {
-}
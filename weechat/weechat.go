@@ -5,13 +5,17 @@ import (
 	"bufio"
 	"bytes"
 	"compress/zlib"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Reference: http://www.weechat.org/files/doc/stable/weechat_relay_protocol.en.html
@@ -19,7 +23,8 @@ import (
 type command int
 
 const (
-	cmdInit command = iota
+	cmdHandshake command = iota
+	cmdInit
 	cmdHdata
 	cmdInfo
 	cmdInfolist
@@ -32,32 +37,80 @@ const (
 )
 
 var cmdStrings = [cmdCount]string{
-	cmdInit:     "init",
-	cmdHdata:    "hdata",
-	cmdInfo:     "info",
-	cmdInfolist: "infolist",
-	cmdNicklist: "nicklist",
-	cmdInput:    "input",
-	cmdSync:     "sync",
-	cmdDesync:   "desync",
-	cmdQuit:     "quit",
+	cmdHandshake: "handshake",
+	cmdInit:      "init",
+	cmdHdata:     "hdata",
+	cmdInfo:      "info",
+	cmdInfolist:  "infolist",
+	cmdNicklist:  "nicklist",
+	cmdInput:     "input",
+	cmdSync:      "sync",
+	cmdDesync:    "desync",
+	cmdQuit:      "quit",
 }
 
 type Conn struct {
 	c    net.Conn
 	r    *bufio.Reader
-	lock sync.Mutex
+	zr   io.ReadCloser // zlib reader, reused across messages
+	lock sync.Mutex    // protects writes to c
+
+	// pending maps identifiers of in-flight requests
+	// to the channel expecting the reply.
+	plock   sync.Mutex
+	seq     uint64
+	pending map[string]chan message
+	done    chan struct{}
+	err     error // set before done is closed
+
+	evlock sync.Mutex
+	events chan Event // nil until Sync is called
+	evout  chan Event
+	closed bool // set when the read loop exits
 }
 
+// Dial connects to an unauthenticated relay over plain TCP.
 func Dial(addr string) (*Conn, error) {
-	conn, err := net.Dial("tcp", addr)
+	return DialWithConfig(addr, DialConfig{})
+}
+
+// DialWithConfig connects to the relay at addr and authenticates
+// according to cfg.
+func DialWithConfig(addr string, cfg DialConfig) (*Conn, error) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	d := &net.Dialer{Deadline: deadline}
+	conn, err := d.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TLS != nil || len(cfg.PinnedCerts) > 0 {
+		tc := tls.Client(conn, cfg.tlsConfig(addr))
+		tc.SetDeadline(deadline)
+		if err := tc.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tc
+	}
+	conn.SetDeadline(deadline)
+	wc := &Conn{
+		c:       conn,
+		r:       bufio.NewReader(conn),
+		pending: make(map[string]chan message),
+		done:    make(chan struct{}),
+	}
+	go wc.readLoop()
+	err = wc.login(cfg)
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
-	wc := &Conn{c: conn, r: bufio.NewReader(conn)}
-	// say hello
-	err = wc.send(cmdInit, "compression=off")
-	return wc, err
+	conn.SetDeadline(time.Time{})
+	return wc, nil
 }
 
 func (conn *Conn) Close() error {
@@ -67,76 +120,193 @@ func (conn *Conn) Close() error {
 	return nil
 }
 
-func (conn *Conn) send(cmd command, args ...string) error {
+var errClosed = errors.New("connection closed")
+
+// readLoop reads incoming messages until the connection fails.
+// Messages whose identifier starts with an underscore are
+// unsolicited events and are never mixed with replies.
+func (conn *Conn) readLoop() {
+	defer close(conn.done)
+	defer conn.closeEvents()
+	for {
+		s, err := conn.recv()
+		if err != nil {
+			if err == io.EOF {
+				err = errClosed
+			}
+			conn.err = err
+			return
+		}
+		msg := message(s)
+		idb, err := msg.Buffer()
+		if err != nil {
+			debugf("dropping invalid message: %s", err)
+			continue
+		}
+		id := string(idb)
+		if len(id) > 0 && id[0] == '_' {
+			conn.dispatch(id, msg)
+			continue
+		}
+		conn.plock.Lock()
+		c, ok := conn.pending[id]
+		delete(conn.pending, id)
+		conn.plock.Unlock()
+		if ok {
+			c <- msg
+		} else {
+			debugf("dropping reply with unknown id %q", id)
+		}
+	}
+}
+
+// roundTrip sends a command and waits for its reply. It can be
+// called concurrently: each request is tagged with a unique identifier
+// used to route the reply.
+func (conn *Conn) roundTrip(cmd command, args ...string) (message, error) {
+	c := make(chan message, 1)
+	conn.plock.Lock()
+	conn.seq++
+	id := strconv.FormatUint(conn.seq, 10)
+	conn.pending[id] = c
+	conn.plock.Unlock()
+
+	err := conn.send(id, cmd, args...)
+	if err != nil {
+		conn.plock.Lock()
+		delete(conn.pending, id)
+		conn.plock.Unlock()
+		return nil, err
+	}
+	select {
+	case msg := <-c:
+		return msg, nil
+	case <-conn.done:
+		return nil, conn.err
+	}
+}
+
+// send writes a command to the relay, prefixed with identifier
+// id if it is not empty.
+func (conn *Conn) send(id string, cmd command, args ...string) error {
 	buf := make([]byte, 0, 80)
+	if id != "" {
+		buf = append(buf, '(')
+		buf = append(buf, id...)
+		buf = append(buf, ") "...)
+	}
 	buf = append(buf, cmdStrings[cmd]...)
 	for _, a := range args {
 		buf = append(buf, ' ')
 		buf = append(buf, a...)
 	}
 	buf = append(buf, '\n')
+	conn.lock.Lock()
 	_, err := conn.c.Write(buf)
+	conn.lock.Unlock()
 	return err
 }
 
-var errMsgTooLarge = errors.New("message too large")
+var (
+	errMsgTooLarge = errors.New("message too large")
+	errMsgInvalid  = errors.New("invalid message length")
+)
+
+// maxMessageSize is the maximal size of a decompressed message.
+const maxMessageSize = 32 << 20
 
 // recv gets a message from the connection.
 func (conn *Conn) recv() (s []byte, err error) {
 	// A message is:
 	// - a uint32 length
-	// - a byte boolean for compression
-	// - length-5 bytes of data (plain or zlib compressed)
+	// - a byte for compression (0: none, 1: zlib, 2: zstd)
+	// - length-5 bytes of data (plain or compressed)
 	var buf [5]byte
 	_, err = io.ReadFull(conn.r, buf[:])
 	if err != nil {
 		return nil, err
 	}
 	length := binary.BigEndian.Uint32(buf[:4])
-	isCompressed := buf[4] == 1
-	if length >= 32<<20 {
+	flag := buf[4]
+	switch {
+	case length < 5:
+		return nil, errMsgInvalid
+	case length >= maxMessageSize:
 		return nil, errMsgTooLarge
 	}
 
-	s = make([]byte, length-5)
-	_, err = io.ReadFull(conn.r, s)
-	if err != nil {
-		return
+	// The buffer grows as data is read, so that a bogus length
+	// does not cause a large allocation.
+	var out bytes.Buffer
+	if flag == 0 {
+		_, err = io.CopyN(&out, conn.r, int64(length-5))
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return out.Bytes(), err
 	}
-	if isCompressed {
-		zr, err := zlib.NewReader(bytes.NewBuffer(s))
-		if err != nil {
-			return s, err
+	// Decompress directly from the connection.
+	body := io.LimitReader(conn.r, int64(length-5))
+	dec, ok := getDecompressor(flag)
+	if !ok {
+		return nil, fmt.Errorf("unknown compression %d", flag)
+	}
+	var zr io.ReadCloser
+	if dec.name == CompressZlib && conn.zr != nil {
+		err = conn.zr.(zlib.Resetter).Reset(body, nil)
+		zr = conn.zr
+	} else {
+		zr, err = dec.newReader(body)
+		if err == nil && dec.name == CompressZlib {
+			conn.zr = zr
 		}
-		return ioutil.ReadAll(zr)
 	}
-	return s, nil
-}
-
-func (conn *Conn) ListBuffers() ([]Buffer, error) {
-	conn.lock.Lock()
-	defer conn.lock.Unlock()
-	var s []byte
-	err := conn.send(cmdHdata, "buffer:gui_buffers(*)")
-	if err == nil {
-		s, err = conn.recv()
+	if err != nil {
+		return nil, err
+	}
+	n, err := out.ReadFrom(io.LimitReader(zr, maxMessageSize))
+	if err == nil && n == maxMessageSize {
+		err = errMsgTooLarge
+	}
+	if dec.name != CompressZlib {
+		zr.Close()
 	}
 	if err != nil {
 		return nil, err
 	}
-	msg := message(s)
-	id, typ := msg.Buffer(), msg.GetType()
-	//t.Logf("id=%s type=%v", id, typ)
-	_, _ = id, typ
+	// Skip trailing data, if any.
+	_, err = io.Copy(ioutil.Discard, body)
+	return out.Bytes(), err
+}
+
+// request sends a command and decodes its reply into v.
+func (conn *Conn) request(v interface{}, cmd command, args ...string) error {
+	msg, err := conn.roundTrip(cmd, args...)
+	if err != nil {
+		return err
+	}
+	return msg.Decode(v)
+}
+
+// Hdata requests the hdata at path (for example
+// "buffer:gui_buffers(*)/lines/last_line(-10)/data") and decodes it
+// into v. If keys is not empty, only the listed variables are
+// returned. v must be a pointer to a slice of structs with weechat
+// tags, a slice of maps, a HData or an empty interface.
+func (conn *Conn) Hdata(v interface{}, path string, keys string) error {
+	if keys == "" {
+		return conn.request(v, cmdHdata, path)
+	}
+	return conn.request(v, cmdHdata, path, keys)
+}
+
+func (conn *Conn) ListBuffers() ([]Buffer, error) {
 	var buflist []Buffer
-	msg.HData(&buflist)
-	return buflist, nil
+	err := conn.Hdata(&buflist, "buffer:gui_buffers(*)", "")
+	return buflist, err
 }
 
 func (conn *Conn) BufferData(ptr uint64, limit int, filter string) (lines []LineData, err error) {
-	conn.lock.Lock()
-	defer conn.lock.Unlock()
-	var s []byte
 	var path string
 	if limit == 0 {
 		path = fmt.Sprintf("buffer:0x%x/lines/first_line(*)/data", ptr)
@@ -145,36 +315,96 @@ func (conn *Conn) BufferData(ptr uint64, limit int, filter string) (lines []Line
 	} else if limit < 0 {
 		path = fmt.Sprintf("buffer:0x%x/lines/last_line(%d)/data", ptr, limit)
 	}
-	err = conn.send(cmdHdata, path, filter)
-	if err == nil {
-		s, err = conn.recv()
+	err = conn.Hdata(&lines, path, filter)
+	return lines, err
+}
+
+func (conn *Conn) BuffersData() (lines []LineData, err error) {
+	err = conn.Hdata(&lines, "buffer:gui_buffers(*)/lines/first_line(*)/data", "")
+	return lines, err
+}
+
+// Info returns the value of the named info (for example "version").
+func (conn *Conn) Info(name string) (string, error) {
+	var value string
+	err := conn.request(&value, cmdInfo, name)
+	return value, err
+}
+
+// Infolist returns the named infolist. Pointer ptr and arguments
+// are optional and restrict the returned items.
+func (conn *Conn) Infolist(name string, ptr uint64, args string) (Infolist, error) {
+	var list Infolist
+	var err error
+	switch {
+	case args != "":
+		err = conn.request(&list, cmdInfolist, name, fmt.Sprintf("0x%x", ptr), args)
+	case ptr != 0:
+		err = conn.request(&list, cmdInfolist, name, fmt.Sprintf("0x%x", ptr))
+	default:
+		err = conn.request(&list, cmdInfolist, name)
+	}
+	return list, err
+}
+
+// Nicklist returns the nicklist of the given buffer (full name or
+// pointer like "0x1234"), or of all buffers if buffer is empty.
+// Groups and nicks are listed in tree order, and the Parent field
+// of each item is set to the name of its group.
+func (conn *Conn) Nicklist(buffer string) ([]Nick, error) {
+	var nicks []Nick
+	var err error
+	if buffer == "" {
+		err = conn.request(&nicks, cmdNicklist)
+	} else {
+		err = conn.request(&nicks, cmdNicklist, buffer)
 	}
 	if err != nil {
 		return nil, err
 	}
-	msg := message(s)
-	id, typ := msg.Buffer(), msg.GetType()
-	//t.Logf("id=%s type=%v", id, typ)
-	_, _ = id, typ
-	msg.HData(&lines)
-	return lines, nil
+	nestNicks(nicks)
+	return nicks, nil
 }
 
-func (conn *Conn) BuffersData() (lines []LineData, err error) {
-	conn.lock.Lock()
-	defer conn.lock.Unlock()
-	var s []byte
-	err = conn.send(cmdHdata, "buffer:gui_buffers(*)/lines/first_line(*)/data")
-	if err == nil {
-		s, err = conn.recv()
+// nestNicks fills the Parent field of nicklist items. Groups are
+// followed by their contents, and have a level one more than their
+// parent group (the root group has level 0).
+func nestNicks(nicks []Nick) {
+	var groups []string // groups[i] is the current group of level i
+	var buffer uintptr
+	for i := range nicks {
+		n := &nicks[i]
+		if n.Buffer != buffer {
+			buffer, groups = n.Buffer, groups[:0]
+		}
+		if n.Group == 0 {
+			if len(groups) > 0 {
+				n.Parent = groups[len(groups)-1]
+			}
+			continue
+		}
+		if n.Level < 0 || n.Level > len(groups) {
+			// inconsistent level, attach to the root.
+			groups = groups[:0]
+			n.Level = 0
+		}
+		groups = groups[:n.Level]
+		if n.Level > 0 {
+			n.Parent = groups[n.Level-1]
+		}
+		groups = append(groups, n.Name)
 	}
-	if err != nil {
-		return nil, err
+}
+
+// Input sends text to a buffer (full name or pointer like "0x1234")
+// as if it was typed by the user: it can be a message or a command.
+// Multiple lines are sent as separate inputs.
+func (conn *Conn) Input(buffer, text string) error {
+	for _, line := range strings.Split(text, "\n") {
+		err := conn.send("", cmdInput, buffer, strings.TrimSuffix(line, "\r"))
+		if err != nil {
+			return err
+		}
 	}
-	msg := message(s)
-	id, typ := msg.Buffer(), msg.GetType()
-	//t.Logf("id=%s type=%v", id, typ)
-	_, _ = id, typ
-	msg.HData(&lines)
-	return lines, nil
+	return nil
 }
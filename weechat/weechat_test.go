@@ -1,12 +1,165 @@
 package weechat
 
 import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/binary"
 	"flag"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
 )
 
+func TestRecvCompressed(t *testing.T) {
+	var stream bytes.Buffer
+	for i := 0; i < 3; i++ {
+		var body bytes.Buffer
+		w := zlib.NewWriter(&body)
+		w.Write([]byte(strings.Repeat("hello ", 100*(i+1))))
+		w.Close()
+		var h [5]byte
+		binary.BigEndian.PutUint32(h[:4], uint32(body.Len()+5))
+		h[4] = 1
+		stream.Write(h[:])
+		stream.Write(body.Bytes())
+	}
+	conn := &Conn{r: bufio.NewReader(&stream)}
+	for i := 0; i < 3; i++ {
+		s, err := conn.recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := strings.Repeat("hello ", 100*(i+1)); string(s) != exp {
+			t.Errorf("message %d: got %d bytes, expected %d", i, len(s), len(exp))
+		}
+	}
+}
+
+func TestCompressionOptions(t *testing.T) {
+	for _, test := range []struct {
+		handshake bool
+		algos     []string
+		hs, init  string
+	}{
+		{false, nil, "", "off"},
+		{false, []string{CompressZlib}, "", "zlib"},
+		{true, nil, "off", ""},
+		{true, []string{CompressZlib, CompressOff}, "zlib:off", ""},
+	} {
+		cfg := DialConfig{Handshake: test.handshake, Compression: test.algos}
+		hs, init, err := cfg.compressionOptions()
+		if err != nil {
+			t.Errorf("%v: %s", test.algos, err)
+		}
+		if hs != test.hs || init != test.init {
+			t.Errorf("%v: got %q/%q, expected %q/%q",
+				test.algos, hs, init, test.hs, test.init)
+		}
+	}
+	// zstd is not registered by default.
+	cfg := DialConfig{Handshake: true, Compression: []string{CompressZstd}}
+	if _, _, err := cfg.compressionOptions(); err == nil {
+		t.Errorf("expected error for zstd")
+	}
+}
+
+func TestZstd(t *testing.T) {
+	// The package has no zstd encoder: frames are compressed
+	// with flate, and decoded by a flate reader registered as
+	// the zstd decompressor.
+	RegisterDecompressor(CompressZstd, 2, func(r io.Reader) (io.ReadCloser, error) {
+		return flate.NewReader(r), nil
+	})
+	defer func() {
+		decompLock.Lock()
+		delete(decompressors, 2)
+		decompLock.Unlock()
+	}()
+
+	cfg := DialConfig{Handshake: true, Compression: []string{CompressZstd, CompressZlib, CompressOff}}
+	hs, init, err := cfg.compressionOptions()
+	if err != nil || hs != "zstd:zlib:off" || init != "" {
+		t.Errorf("got %q/%q, %v", hs, init, err)
+	}
+	// zstd needs a handshake.
+	cfg.Handshake = false
+	if _, init, err := cfg.compressionOptions(); err != nil || init != CompressZlib {
+		t.Errorf("got %q, %v without handshake", init, err)
+	}
+
+	var stream bytes.Buffer
+	for i := 0; i < 2; i++ {
+		var body bytes.Buffer
+		w, _ := flate.NewWriter(&body, flate.BestCompression)
+		w.Write([]byte(strings.Repeat("zstd ", 100*(i+1))))
+		w.Close()
+		var h [5]byte
+		binary.BigEndian.PutUint32(h[:4], uint32(body.Len()+5))
+		h[4] = 2
+		stream.Write(h[:])
+		stream.Write(body.Bytes())
+	}
+	conn := &Conn{r: bufio.NewReader(&stream)}
+	for i := 0; i < 2; i++ {
+		s, err := conn.recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := strings.Repeat("zstd ", 100*(i+1)); string(s) != exp {
+			t.Errorf("message %d: got %q", i, s)
+		}
+	}
+}
+
+func TestRecvTruncated(t *testing.T) {
+	// The length claims 16MB but the stream ends early.
+	stream := bytes.NewBufferString("\x01\x00\x00\x00\x00hello")
+	conn := &Conn{r: bufio.NewReader(stream)}
+	if _, err := conn.recv(); err != io.ErrUnexpectedEOF {
+		t.Errorf("got error %v, expected %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestSyncAfterClose(t *testing.T) {
+	conn := &Conn{
+		r:    bufio.NewReader(strings.NewReader("")),
+		done: make(chan struct{}),
+	}
+	conn.readLoop()
+	if _, err := conn.Sync(); err != errClosed {
+		t.Errorf("got error %v, expected %v", err, errClosed)
+	}
+	if conn.events != nil {
+		t.Errorf("Sync created an event channel on a closed connection")
+	}
+}
+
 var external = flag.Bool("external", false, "use external")
 
+func TestNestNicks(t *testing.T) {
+	nicks := []Nick{
+		{Group: 1, Level: 0, Name: "root", Buffer: 1},
+		{Group: 1, Level: 1, Name: "000|o", Buffer: 1},
+		{Name: "alice", Buffer: 1},
+		{Group: 1, Level: 1, Name: "999|...", Buffer: 1},
+		{Name: "bob", Buffer: 1},
+		{Group: 1, Level: 0, Name: "root", Buffer: 2},
+		{Name: "carol", Buffer: 2},
+	}
+	nestNicks(nicks)
+	var parents []string
+	for _, n := range nicks {
+		parents = append(parents, n.Parent)
+	}
+	expected := []string{"", "root", "000|o", "root", "999|...", "", "root"}
+	if strings.Join(parents, ",") != strings.Join(expected, ",") {
+		t.Errorf("got parents %q, expected %q", parents, expected)
+	}
+}
+
 func TestExternal(t *testing.T) {
 	if !*external {
 		t.Logf("skipping.")
@@ -20,20 +173,10 @@ func TestExternal(t *testing.T) {
 	defer c.Close()
 
 	// nicklist.
-	err = c.send(cmdNicklist)
+	nicks, err := c.Nicklist("")
 	if err != nil {
-		t.Errorf("nicklist: %s", err)
+		t.Fatalf("nicklist: %s", err)
 	}
-
-	s, err := c.recv()
-	if err != nil {
-		t.Fatalf("read: %s", err)
-	}
-	msg := message(s)
-	id, typ := msg.Buffer(), msg.GetType()
-	t.Logf("id=%s type=%v", id, typ)
-	var nicks []Nick
-	msg.HData(&nicks)
 	if len(nicks) > 50 {
 		nicks = nicks[:50]
 	}
@@ -50,3 +193,51 @@ func TestExternal(t *testing.T) {
 		t.Logf("%+v", lines[i])
 	}
 }
+
+func TestParseColors(t *testing.T) {
+	for _, test := range []struct {
+		in  string
+		out RichText
+	}{
+		{"plain", RichText{{Text: "plain"}}},
+		// option color (chat_nick), then reset.
+		{"\x1913bob\x1C: hi", RichText{
+			{Style{Fg: OptionColor(13)}, "bob"},
+			{Text: ": hi"},
+		}},
+		// bold red on extended blue, then remove bold.
+		{"\x19F*03\x19B@00021a\x1B*b", RichText{
+			{Style{Fg: TermColor(1), Bg: TermColor(21), Attrs: AttrBold}, "a"},
+			{Style{Fg: TermColor(1), Bg: TermColor(21)}, "b"},
+		}},
+		// fg and bg, keeping attributes.
+		{"\x1A_\x19*|/05,09x\x19\x1Cy", RichText{
+			{Style{Fg: TermColor(2), Bg: TermColor(4), Attrs: AttrUnderline | AttrItalic}, "x"},
+			{Style{Attrs: AttrUnderline | AttrItalic}, "y"},
+		}},
+		// truncated codes.
+		{"a\x19", RichText{{Text: "a"}}},
+		{"a\x19F", RichText{{Text: "a"}}},
+		{"a\x19*0", RichText{{Text: "a"}}},
+		{"a\x19B@001", RichText{{Text: "a"}}},
+		{"a\x191", RichText{{Text: "a"}}},
+		{"a\x19*01,2", RichText{{Text: "a"}}},
+		{"a\x1A", RichText{{Text: "a"}}},
+	} {
+		got := ParseColors(test.in)
+		if !reflect.DeepEqual(got, test.out) {
+			t.Errorf("ParseColors(%q) = %+v, expected %+v", test.in, got, test.out)
+		}
+	}
+
+	text := ParseColors("\x19F*03<b>\x1Cok")
+	if s := text.String(); s != "<b>ok" {
+		t.Errorf("got %q", s)
+	}
+	if s := text.HTML(); s != `<span style="color:#800000;font-weight:bold">&lt;b&gt;</span>ok` {
+		t.Errorf("got HTML %q", s)
+	}
+	if s := text.ANSI(); s != "\x1b[1;38;5;1m<b>\x1b[0mok" {
+		t.Errorf("got ANSI %q", s)
+	}
+}
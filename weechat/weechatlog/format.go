@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/weechat"
+)
+
+// A logWriter writes the lines of a buffer.
+type logWriter interface {
+	WriteLine(l weechat.LineData) error
+	Close() error
+}
+
+// formats maps format names to constructors of writers. If
+// truncate is true, existing logs are overwritten, otherwise
+// lines are appended.
+var formats = map[string]func(dir string, b weechat.Buffer, truncate bool) (logWriter, error){
+	"irssi":   newIrssiWriter,
+	"znc":     newZNCWriter,
+	"json":    newJSONWriter,
+	"archive": newArchiveWriter,
+}
+
+// logFile is a buffered output file.
+type logFile struct {
+	f *os.File
+	*bufio.Writer
+}
+
+func createLog(path string, truncate bool) (*logFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if truncate {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &logFile{f: f, Writer: bufio.NewWriter(f)}, nil
+}
+
+func (f *logFile) Close() error {
+	err := f.Flush()
+	if err2 := f.f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// fileName turns a buffer name into a file name.
+func fileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == os.PathSeparator || r == 0 {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+type lineKind int
+
+const (
+	kindMessage lineKind = iota
+	kindAction
+	kindSystem
+)
+
+// classify returns the kind of a line, the nick of its author
+// and its text without colors.
+func classify(l weechat.LineData) (kind lineKind, nick, text string) {
+	prefix := weechat.ParseColors(l.Prefix).String()
+	text = weechat.ParseColors(l.Message).String()
+	nick = prefix
+	for _, tag := range l.Tags {
+		switch {
+		case tag == "irc_action":
+			kind = kindAction
+		case strings.HasPrefix(tag, "nick_"):
+			nick = tag[len("nick_"):]
+		}
+	}
+	if kind == kindAction {
+		// the message starts with the nick.
+		text = strings.TrimPrefix(text, nick+" ")
+		return kindAction, nick, text
+	}
+	switch prefix {
+	case "", "--", "-->", "<--", "=!=", " *", "*":
+		return kindSystem, "", text
+	}
+	return kindMessage, nick, text
+}
+
+// irssi logs: one file per buffer.
+//
+//	--- Log opened Mon Jan 02 15:04:05 2006
+//	15:04 <nick> message
+//	15:05  * nick action
+//	15:06 -!- nick has joined #channel
+//	--- Day changed Tue Jan 03 2006
+//	--- Log closed Tue Jan 03 10:00:00 2006
+type irssiWriter struct {
+	*logFile
+	last time.Time
+}
+
+func newIrssiWriter(dir string, b weechat.Buffer, truncate bool) (logWriter, error) {
+	f, err := createLog(filepath.Join(dir, fileName(b.FullName)+".log"), truncate)
+	if err != nil {
+		return nil, err
+	}
+	return &irssiWriter{logFile: f}, nil
+}
+
+func (w *irssiWriter) WriteLine(l weechat.LineData) error {
+	date := l.Date.Local()
+	if w.last.IsZero() {
+		fmt.Fprintf(w, "--- Log opened %s\n", date.Format("Mon Jan 02 15:04:05 2006"))
+	} else if y, m, d := date.Date(); y != w.last.Year() || m != w.last.Month() || d != w.last.Day() {
+		fmt.Fprintf(w, "--- Day changed %s\n", date.Format("Mon Jan 02 2006"))
+	}
+	w.last = date
+	kind, nick, text := classify(l)
+	var err error
+	switch kind {
+	case kindMessage:
+		_, err = fmt.Fprintf(w, "%s <%s> %s\n", date.Format("15:04"), nick, text)
+	case kindAction:
+		_, err = fmt.Fprintf(w, "%s  * %s %s\n", date.Format("15:04"), nick, text)
+	case kindSystem:
+		_, err = fmt.Fprintf(w, "%s -!- %s\n", date.Format("15:04"), text)
+	}
+	return err
+}
+
+func (w *irssiWriter) Close() error {
+	if !w.last.IsZero() {
+		fmt.Fprintf(w, "--- Log closed %s\n", w.last.Format("Mon Jan 02 15:04:05 2006"))
+	}
+	return w.logFile.Close()
+}
+
+// ZNC logs: one file per day, in a directory per network and
+// channel (network/channel/2006-01-02.log).
+//
+//	[15:04:05] <nick> message
+//	[15:04:05] * nick action
+//	[15:04:05] *** nick has joined #channel
+type zncWriter struct {
+	dir      string
+	truncate bool
+	day      string
+	cur      *logFile
+}
+
+func newZNCWriter(dir string, b weechat.Buffer, truncate bool) (logWriter, error) {
+	// irc.libera.#go is stored in libera/#go.
+	parts := strings.SplitN(b.FullName, ".", 3)
+	if len(parts) == 3 && parts[0] == "irc" {
+		dir = filepath.Join(dir, fileName(parts[1]), fileName(parts[2]))
+	} else {
+		dir = filepath.Join(dir, fileName(b.FullName))
+	}
+	return &zncWriter{dir: dir, truncate: truncate}, nil
+}
+
+func (w *zncWriter) WriteLine(l weechat.LineData) error {
+	date := l.Date.Local()
+	if day := date.Format("2006-01-02"); day != w.day {
+		if w.cur != nil {
+			if err := w.cur.Close(); err != nil {
+				return err
+			}
+		}
+		f, err := createLog(filepath.Join(w.dir, day+".log"), w.truncate)
+		if err != nil {
+			w.cur = nil
+			return err
+		}
+		w.cur, w.day = f, day
+	}
+	kind, nick, text := classify(l)
+	var err error
+	switch kind {
+	case kindMessage:
+		_, err = fmt.Fprintf(w.cur, "[%s] <%s> %s\n", date.Format("15:04:05"), nick, text)
+	case kindAction:
+		_, err = fmt.Fprintf(w.cur, "[%s] * %s %s\n", date.Format("15:04:05"), nick, text)
+	case kindSystem:
+		_, err = fmt.Fprintf(w.cur, "[%s] *** %s\n", date.Format("15:04:05"), text)
+	}
+	return err
+}
+
+func (w *zncWriter) Close() error {
+	if w.cur == nil {
+		return nil
+	}
+	return w.cur.Close()
+}
+
+// JSON lines: one object per line, one file per buffer.
+type jsonWriter struct {
+	*logFile
+	buffer string
+	enc    *json.Encoder
+}
+
+type jsonLine struct {
+	Buffer    string    `json:"buffer"`
+	Date      time.Time `json:"date"`
+	Prefix    string    `json:"prefix"`
+	Message   string    `json:"message"`
+	Tags      []string  `json:"tags,omitempty"`
+	Highlight bool      `json:"highlight,omitempty"`
+}
+
+func newJSONWriter(dir string, b weechat.Buffer, truncate bool) (logWriter, error) {
+	f, err := createLog(filepath.Join(dir, fileName(b.FullName)+".jsonl"), truncate)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonWriter{logFile: f, buffer: b.FullName, enc: json.NewEncoder(f)}, nil
+}
+
+func (w *jsonWriter) WriteLine(l weechat.LineData) error {
+	return w.enc.Encode(jsonLine{
+		Buffer:    w.buffer,
+		Date:      l.Date,
+		Prefix:    weechat.ParseColors(l.Prefix).String(),
+		Message:   weechat.ParseColors(l.Message).String(),
+		Tags:      l.Tags,
+		Highlight: l.Highlight != 0,
+	})
+}
+
+// The archive format keeps lines as sent by the relay, with
+// color codes, one file per buffer. Each line holds tab-separated
+// fields: Unix date, comma-separated tags, prefix and message,
+// where backslashes, tabs and newlines are escaped as \\, \t
+// and \n.
+type archiveWriter struct {
+	*logFile
+}
+
+func newArchiveWriter(dir string, b weechat.Buffer, truncate bool) (logWriter, error) {
+	f, err := createLog(filepath.Join(dir, fileName(b.FullName)+".wla"), truncate)
+	if err != nil {
+		return nil, err
+	}
+	return archiveWriter{f}, nil
+}
+
+var archiveEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`)
+
+func (w archiveWriter) WriteLine(l weechat.LineData) error {
+	_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+		strconv.FormatInt(l.Date.Unix(), 10),
+		archiveEscaper.Replace(strings.Join(l.Tags, ",")),
+		archiveEscaper.Replace(l.Prefix),
+		archiveEscaper.Replace(l.Message))
+	return err
+}
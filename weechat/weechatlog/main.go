@@ -0,0 +1,136 @@
+// weechatlog dumps the history of WeeChat buffers, fetched from
+// a relay, to log files.
+//
+// Supported formats are irssi and ZNC text logs, JSON lines and
+// an archive format keeping color codes. In incremental mode,
+// the last exported line of each buffer is remembered in a state
+// file, and only newer lines are appended on the next run.
+//
+// Usage:
+//
+//	weechatlog -relay host:port [-password pass] -dir logs/ [-format irssi] [-incremental]
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/remyoudompheng/go-misc/weechat"
+)
+
+type options struct {
+	Dir         string
+	Format      string
+	Incremental bool
+	Buffers     []string // full names, all buffers if empty
+}
+
+func main() {
+	var relay, password, buffers string
+	var useTLS bool
+	var opts options
+	flag.StringVar(&relay, "relay", "", "address of Weechat relay")
+	flag.StringVar(&password, "password", "", "relay password")
+	flag.BoolVar(&useTLS, "tls", false, "connect to relay using TLS")
+	flag.StringVar(&opts.Dir, "dir", ".", "output directory")
+	flag.StringVar(&opts.Format, "format", "irssi", "log format (irssi, znc, json, archive)")
+	flag.BoolVar(&opts.Incremental, "incremental", false, "only export lines newer than the previous run")
+	flag.StringVar(&buffers, "buffers", "", "comma-separated full names of buffers to export (default all)")
+	flag.Parse()
+
+	if relay == "" {
+		flag.Usage()
+		return
+	}
+	if _, ok := formats[opts.Format]; !ok {
+		log.Fatalf("unknown format %q", opts.Format)
+	}
+	if buffers != "" {
+		opts.Buffers = strings.Split(buffers, ",")
+	}
+
+	cfg := weechat.DialConfig{Password: password}
+	if useTLS {
+		cfg.TLS = new(tls.Config)
+	}
+	weechat.DEBUG = false
+	conn, err := weechat.DialWithConfig(relay, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := export(conn, opts); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// export writes logs of buffers according to opts.
+func export(conn *weechat.Conn, opts options) error {
+	var st state
+	if opts.Incremental {
+		var err error
+		st, err = loadState(opts.Dir)
+		if err != nil {
+			return err
+		}
+	}
+	bufs, err := conn.ListBuffers()
+	if err != nil {
+		return err
+	}
+	for _, b := range bufs {
+		if !selected(b, opts.Buffers) {
+			continue
+		}
+		var lines []weechat.LineData
+		if opts.Incremental {
+			lines, err = st.fetch(conn, b)
+		} else {
+			lines, err = conn.BufferData(uint64(b.Self), 0, "")
+		}
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		w, err := formats[opts.Format](opts.Dir, b, !opts.Incremental)
+		if err != nil {
+			return err
+		}
+		for _, l := range lines {
+			if err := w.WriteLine(l); err != nil {
+				w.Close()
+				return err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		log.Printf("exported %d lines from %s", len(lines), b.FullName)
+		if opts.Incremental {
+			// Save the state now: if a later buffer fails, the
+			// lines of this one must not be exported again.
+			st.update(b.FullName, lines[len(lines)-1])
+			if err := st.save(opts.Dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func selected(b weechat.Buffer, names []string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for _, name := range names {
+		if b.FullName == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/weechat"
+	"github.com/remyoudompheng/go-misc/weechat/relaytest"
+)
+
+func TestExportIncremental(t *testing.T) {
+	dir, err := ioutil.TempDir("", "weechatlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	relay := relaytest.NewServer()
+	defer relay.Close()
+	b := relay.AddBuffer("irc.libera.#go")
+	day := time.Date(2020, 3, 1, 23, 58, 0, 0, time.Local)
+	relay.AddLine(b, relaytest.Line{Date: day, Prefix: "-->", Message: "bob has joined #go"})
+	relay.AddLine(b, relaytest.Line{Date: day.Add(time.Minute), Prefix: "\x1913bob", Message: "hello",
+		Tags: []string{"irc_privmsg", "nick_bob"}})
+
+	weechat.DEBUG = false
+	conn, err := weechat.Dial(relay.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	opts := options{Dir: dir, Format: "irssi", Incremental: true, Buffers: []string{b.FullName}}
+	if err := export(conn, opts); err != nil {
+		t.Fatal(err)
+	}
+	relay.AddLine(b, relaytest.Line{Date: day.Add(2 * time.Minute), Prefix: " *", Message: "bob waves",
+		Tags: []string{"irc_action", "nick_bob"}})
+	if err := export(conn, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "irc.libera.#go.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `--- Log opened Sun Mar 01 23:58:00 2020
+23:58 -!- bob has joined #go
+23:59 <bob> hello
+--- Log closed Sun Mar 01 23:59:00 2020
+--- Log opened Mon Mar 02 00:00:00 2020
+00:00  * bob waves
+--- Log closed Mon Mar 02 00:00:00 2020
+`
+	if string(data) != expected {
+		t.Errorf("got log:\n%s\nexpected:\n%s", data, expected)
+	}
+
+	// A stale line pointer falls back to dates.
+	st, err := loadState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := st[b.FullName]
+	last.Line = 0xdead
+	st[b.FullName] = last
+	if err := st.save(dir); err != nil {
+		t.Fatal(err)
+	}
+	relay.AddLine(b, relaytest.Line{Date: day.Add(3 * time.Minute), Prefix: "\x1913bob", Message: "bye",
+		Tags: []string{"irc_privmsg", "nick_bob"}})
+	if err := export(conn, opts); err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadFile(filepath.Join(dir, "irc.libera.#go.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "00:00  * bob waves\n--- Log closed Mon Mar 02 00:00:00 2020\n"+
+		"--- Log opened Mon Mar 02 00:01:00 2020\n00:01 <bob> bye\n--- Log closed Mon Mar 02 00:01:00 2020\n") {
+		t.Errorf("got log after stale pointer:\n%s", data)
+	}
+
+	// ZNC logs are split by day.
+	opts = options{Dir: dir, Format: "znc", Buffers: []string{b.FullName}}
+	if err := export(conn, opts); err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadFile(filepath.Join(dir, "libera", "#go", "2020-03-02.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(data); s != "[00:00:00] * bob waves\n[00:01:00] <bob> bye\n" {
+		t.Errorf("got ZNC log %q", s)
+	}
+}
+
+func TestExportStateOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "weechatlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	relay := relaytest.NewServer()
+	defer relay.Close()
+	good := relay.AddBuffer("irc.libera.#go")
+	bad := relay.AddBuffer("irc.libera.#rust")
+	relay.AddLine(good, relaytest.Line{Prefix: "bob", Message: "hello"})
+	relay.AddLine(bad, relaytest.Line{Prefix: "alice", Message: "hi"})
+	// The log of the second buffer cannot be written.
+	if err := os.Mkdir(filepath.Join(dir, "irc.libera.#rust.log"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	weechat.DEBUG = false
+	conn, err := weechat.Dial(relay.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	opts := options{Dir: dir, Format: "irssi", Incremental: true,
+		Buffers: []string{good.FullName, bad.FullName}}
+	if err := export(conn, opts); err == nil {
+		t.Fatal("expected error")
+	}
+	st, err := loadState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st[good.FullName]; !ok {
+		t.Errorf("state of %s was not saved: %+v", good.FullName, st)
+	}
+	if _, ok := st[bad.FullName]; ok {
+		t.Errorf("state of %s was saved", bad.FullName)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/remyoudompheng/go-misc/weechat"
+)
+
+const stateFile = ".weechatlog-state.json"
+
+// bufferState records the last exported line of a buffer.
+type bufferState struct {
+	Line uint64    // pointer to the line
+	Date time.Time // date of the line
+}
+
+// state maps full names of buffers to their state.
+type state map[string]bufferState
+
+func loadState(dir string) (state, error) {
+	st := make(state)
+	data, err := ioutil.ReadFile(filepath.Join(dir, stateFile))
+	switch {
+	case os.IsNotExist(err):
+		return st, nil
+	case err != nil:
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func (st state) save(dir string) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, stateFile+".tmp")
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, stateFile))
+}
+
+// pageSize is the number of lines requested at once when fetching
+// the lines following the last exported one.
+const pageSize = 256
+
+// fetch returns the lines of buffer b following its last exported
+// line. Only new lines are requested from the relay, unless the
+// saved line is no longer available (the buffer was cleared or
+// WeeChat restarted): lines are then selected by date.
+func (st state) fetch(conn *weechat.Conn, b weechat.Buffer) ([]weechat.LineData, error) {
+	last, ok := st[b.FullName]
+	if !ok {
+		return conn.BufferData(uint64(b.Self), 0, "")
+	}
+	var cur []weechat.LineData
+	err := conn.Hdata(&cur, fmt.Sprintf("line:0x%x/data", last.Line), "")
+	if err != nil || len(cur) != 1 || uint64(cur[0].Line) != last.Line || !cur[0].Date.Equal(last.Date) {
+		lines, err := conn.BufferData(uint64(b.Self), 0, "")
+		if err != nil {
+			return nil, err
+		}
+		return linesAfter(lines, last.Date), nil
+	}
+	var lines []weechat.LineData
+	c := weechat.Cursor{Buffer: uint64(b.Self), Line: last.Line}
+	for !c.Done {
+		page, next, err := conn.LinesAfter(c, pageSize, "")
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, page...)
+		c = next
+	}
+	return lines, nil
+}
+
+// linesAfter returns the lines dated after t.
+func linesAfter(lines []weechat.LineData, t time.Time) []weechat.LineData {
+	var out []weechat.LineData
+	for _, l := range lines {
+		if l.Date.After(t) {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+func (st state) update(name string, l weechat.LineData) {
+	st[name] = bufferState{Line: uint64(l.Line), Date: l.Date}
+}